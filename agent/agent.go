@@ -1,23 +1,43 @@
 package agent
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"github.com/czx-lab/czx/container/cmap"
 	"github.com/czx-lab/czx/eventbus"
 	gnetcp "github.com/czx-lab/czx/gnetx/tcp"
+	"github.com/czx-lab/czx/metrics"
 	"github.com/czx-lab/czx/network"
+	netmetrics "github.com/czx-lab/czx/network/metrics"
 	xtcp "github.com/czx-lab/czx/network/tcp"
+	"github.com/czx-lab/czx/network/udp"
 	"github.com/czx-lab/czx/network/ws"
 	"github.com/czx-lab/czx/network/xkcp"
+	"github.com/czx-lab/czx/prometheus"
 	"github.com/czx-lab/czx/xlog"
 
 	"go.uber.org/zap"
 )
 
+const (
+	// defaultDrainTimeout is the default maximum time spent draining connections on shutdown.
+	defaultDrainTimeout = 10 * time.Second
+	// defaultAuthCloseCode is the default close code of the connections failing authentication,
+	// in the WebSocket application range.
+	defaultAuthCloseCode uint16 = 4001
+	// defaultAuthCloseReason is the default close reason of the connections failing authentication
+	defaultAuthCloseReason = "authentication failed"
+)
+
 var (
 	ErrProcessorNotFound = errors.New("processor not found")
 )
@@ -28,6 +48,15 @@ type (
 		xtcp.TcpServerConf
 		xkcp.KcpServerConf
 		gnetcp.GnetTcpServerConf
+		udp.UdpServerConf
+		// DrainTimeout is the maximum time spent running shutdown hooks before the servers are stopped.
+		DrainTimeout time.Duration
+		// Metrics is the metrics configuration of the gate itself.
+		Metrics netmetrics.SvrMetricsConf
+		// AuthCloseCode and AuthCloseReason are sent to the connections failing authentication,
+		// see Gate.WithAuth. They default to 4001 and "authentication failed".
+		AuthCloseCode   uint16
+		AuthCloseReason string
 	}
 	Gate struct {
 		option    GateConf
@@ -35,17 +64,58 @@ type (
 		gnetcpSrv *gnetcp.GnetTcpServer
 		eventBus  *eventbus.EventBus
 		preConn   network.PreConnHandler
+		auth      network.AuthHandler
+		tracer    network.Tracer
+		shutdown  []ShutdownHook
+		// agents holds the live agents of all servers
+		agents *cmap.CMap[*agent, struct{}]
+		// seq numbers the agents, it picks their dispatch worker
+		seq atomic.Uint64
+
+		// handler dispatch pool, disabled when the size is zero
+		dispatchSize int
+		dispatch     *dispatcher
+
+		// inbound rate limiting
+		inboundRate   int
+		inboundBurst  int
+		maxViolations int
+		throttled     metrics.Counter
+
+		// onError decides whether a connection survives a bad message, disconnects when nil
+		onError ErrorPolicy
 
 		flag chan struct{}
 	}
 	// agent implements network.Agent interface
 	// It is used to handle the connection and process messages.
 	agent struct {
+		id         uint64
 		conn       network.Conn
 		gate       *Gate
 		clientAddr network.ClientAddrMessage
 		userdata   any
+		limiter    *limiter
+		// violations counts the throttled messages since the last one let through
+		violations int
+		// ctx is the connection context passed to the handlers, cancelled when the message loop ends
+		ctx context.Context
+		// batch holds the messages encoded by Buffer until Flush
+		batch   [][][]byte
+		batchMu sync.Mutex
+	}
+	// AgentError is the data of the eventbus.EvtAgentError event, e.g. to count the protocol
+	// errors of a client and ban it.
+	AgentError struct {
+		Agent network.Agent
+		Err   error
 	}
+	// ErrorPolicy is called when an inbound message fails to be decoded or processed.
+	// It returns true to skip the message and keep reading, false to disconnect the client.
+	ErrorPolicy func(agent network.Agent, err error) bool
+	// ShutdownHook is called when the gate starts its graceful shutdown.
+	// The context is cancelled once the drain timeout expires.
+	ShutdownHook func(ctx context.Context) error
 )
 
 var _ network.Agent = (*agent)(nil)
@@ -53,6 +123,7 @@ var _ network.Agent = (*agent)(nil)
 func NewGate(opt GateConf) *Gate {
 	return &Gate{
 		option: opt,
+		agents: cmap.New[*agent, struct{}](),
 	}
 }
 
@@ -75,6 +146,64 @@ func (g *Gate) WithPreConn(fn network.PreConnHandler) *Gate {
 	return g
 }
 
+// WithAuth sets the authentication function for the Gate instance.
+// It runs before the message loop of every connection; returning an error closes the connection
+// with GateConf.AuthCloseCode and AuthCloseReason, the error itself is only logged, while on success the user id is stored and can be read with GetUserData.
+// For WebSocket connections the original request is available in ClientAddrMessage.Req.
+func (g *Gate) WithAuth(fn network.AuthHandler) *Gate {
+	g.auth = fn
+	return g
+}
+
+// WithTracer sets the tracer for the Gate instance.
+// A span is started around the decoding and processing of every inbound message and its context
+// is passed to the handlers, see network.HandlerContext. Without tracer no span is created.
+func (g *Gate) WithTracer(tracer network.Tracer) *Gate {
+	g.tracer = tracer
+	return g
+}
+
+// WithInboundRate sets the inbound message rate limit for every agent of the Gate instance.
+// Messages exceeding msgsPerSec (with the given burst) are dropped before being processed.
+// A rate less than or equal to zero disables the limiter.
+func (g *Gate) WithInboundRate(msgsPerSec, burst int) *Gate {
+	g.inboundRate = msgsPerSec
+	g.inboundBurst = burst
+	return g
+}
+
+// WithInboundMaxViolations sets how many throttled messages in a row an agent may send before it is disconnected,
+// the count restarts with every message let through, so a client is only disconnected for a sustained flood.
+// A value less than or equal to zero only drops the messages and never disconnects.
+func (g *Gate) WithInboundMaxViolations(n int) *Gate {
+	g.maxViolations = n
+	return g
+}
+
+// WithDispatchPool runs the message handlers on a pool of size workers instead of the read loop
+// of each connection, so that a handler doing I/O does not hold back the next messages of its client.
+// The messages of a connection are always handled by the same worker and thus stay in order.
+// Decoding and rate limiting still happen in the read loop, which blocks when its worker is busy.
+// The handler context is cancelled once the connection ends, possibly before its last messages are handled.
+func (g *Gate) WithDispatchPool(size int) *Gate {
+	g.dispatchSize = size
+	return g
+}
+
+// WithErrorPolicy sets how the agents react to an inbound message failing to be decoded or processed,
+// e.g. SkipMessage to keep the session of a client sending a bad payload. The default is DisconnectOnError.
+// Read errors always disconnect, the stream cannot be recovered.
+func (g *Gate) WithErrorPolicy(policy ErrorPolicy) *Gate {
+	g.onError = policy
+	return g
+}
+
+// DisconnectOnError is the ErrorPolicy closing the connection on the first bad message.
+func DisconnectOnError(network.Agent, error) bool { return false }
+
+// SkipMessage is the ErrorPolicy dropping the bad messages and keeping the connection.
+func SkipMessage(network.Agent, error) bool { return true }
+
 // WithEventBus sets the event bus for the Gate instance.
 // The event bus is used for publishing and subscribing to events.
 func (g *Gate) WithEventBus(bus *eventbus.EventBus) *Gate {
@@ -82,18 +211,47 @@ func (g *Gate) WithEventBus(bus *eventbus.EventBus) *Gate {
 	return g
 }
 
+// OnShutdown registers a hook that runs when the gate starts its graceful shutdown.
+// Hooks run in registration order after new connections stop being accepted,
+// and before the active connections are closed. Each hook gets an equal share of the time left
+// of the drain timeout, the time a hook does not use goes to the next ones. A hook overrunning its
+// share is left running and the next one starts, so a slow hook does not keep the others from running.
+func (g *Gate) OnShutdown(fn ShutdownHook) *Gate {
+	g.shutdown = append(g.shutdown, fn)
+	return g
+}
+
+// ConnCount returns the number of live connections across all servers of the Gate instance.
+func (g *Gate) ConnCount() int {
+	return g.agents.Len()
+}
+
+// Range calls fn for every live agent of the Gate instance.
+// The agents are snapshotted before iterating, so fn may safely close them.
+func (g *Gate) Range(fn func(network.Agent)) {
+	for _, a := range g.agents.Keys() {
+		fn(a)
+	}
+}
+
+// newAgent creates an agent for the connection, registers it and publishes the new agent event.
+func (g *Gate) newAgent(conn network.Conn) *agent {
+	a := &agent{id: g.seq.Add(1), conn: conn, gate: g}
+	g.agents.Set(a, struct{}{})
+	if g.eventBus != nil {
+		g.eventBus.PublishWithQueue(eventbus.EvtNewAgent, a)
+	}
+
+	return a
+}
+
 func (g *Gate) server() []network.ServerFace {
 	var servers []network.ServerFace
 
 	// Create WebSocket server if the address is provided in the configuration
 	if len(g.option.WsServerConf.Addr) > 0 {
 		wsSrv := ws.NewServer(&g.option.WsServerConf, func(wc *ws.WsConn) network.Agent {
-			a := &agent{conn: wc, gate: g}
-			if a.gate.eventBus != nil {
-				a.gate.eventBus.PublishWithQueue(eventbus.EvtNewAgent, a)
-			}
-
-			return a
+			return g.newAgent(wc)
 		})
 
 		servers = append(servers, wsSrv)
@@ -103,23 +261,13 @@ func (g *Gate) server() []network.ServerFace {
 	// If both GNet TCP server and regular TCP server are configured, GNet TCP server will be used.
 	if len(g.option.GnetTcpServerConf.Addr) > 0 {
 		gnetcpSrv := gnetcp.NewGNetTcpServer(&g.option.GnetTcpServerConf, func(c network.Conn) network.Agent {
-			a := &agent{conn: c, gate: g}
-			if a.gate.eventBus != nil {
-				a.gate.eventBus.PublishWithQueue(eventbus.EvtNewAgent, a)
-			}
-
-			return a
+			return g.newAgent(c)
 		})
 
 		servers = append(servers, gnetcpSrv)
 	} else if len(g.option.TcpServerConf.Addr) > 0 {
 		tcpSrv := xtcp.NewServer(&g.option.TcpServerConf, func(tc *xtcp.TcpConn) network.Agent {
-			a := &agent{conn: tc, gate: g}
-			if a.gate.eventBus != nil {
-				a.gate.eventBus.PublishWithQueue(eventbus.EvtNewAgent, a)
-			}
-
-			return a
+			return g.newAgent(tc)
 		})
 
 		servers = append(servers, tcpSrv)
@@ -128,17 +276,21 @@ func (g *Gate) server() []network.ServerFace {
 	// Create KCP server if the address is provided in the configuration
 	if len(g.option.KcpServerConf.Addr) > 0 {
 		kcpSrv := xkcp.NewKcpServer(g.option.KcpServerConf, func(tc *xtcp.TcpConn) network.Agent {
-			a := &agent{conn: tc, gate: g}
-			if a.gate.eventBus != nil {
-				a.gate.eventBus.PublishWithQueue(eventbus.EvtNewAgent, a)
-			}
-
-			return a
+			return g.newAgent(tc)
 		})
 
 		servers = append(servers, kcpSrv)
 	}
 
+	// Create UDP server if the address is provided in the configuration
+	if len(g.option.UdpServerConf.Addr) > 0 {
+		udpSrv := udp.NewServer(g.option.UdpServerConf, func(uc *udp.UdpConn) network.Agent {
+			return g.newAgent(uc)
+		})
+
+		servers = append(servers, udpSrv)
+	}
+
 	return servers
 }
 
@@ -149,6 +301,19 @@ func (g *Gate) Start() {
 		g.eventBus = eventbus.NewEventBus(0, eventbus.EvtXqueueType)
 	}
 
+	if g.inboundRate > 0 && prometheus.Enabled() {
+		g.throttled = metrics.NewCounter(&metrics.VectorOption{
+			Namespace: g.option.Metrics.Namespace,
+			Subsystem: g.option.Metrics.Subsystem,
+			Name:      "throttled_messages_total",
+			Help:      "total inbound messages dropped by the rate limiter",
+		})
+	}
+
+	if g.dispatchSize > 0 {
+		g.dispatch = newDispatcher(g.dispatchSize)
+	}
+
 	servers := g.server()
 
 	for _, srv := range servers {
@@ -167,13 +332,66 @@ func (g *Gate) Start() {
 		<-sig
 	}
 
+	g.drain(servers)
+
 	for _, srv := range servers {
 		srv.Stop()
 	}
+	if g.dispatch != nil {
+		g.dispatch.stop()
+	}
+}
+
+// drain stops accepting new connections, publishes the shutdown event
+// and runs the shutdown hooks within the drain timeout.
+func (g *Gate) drain(servers []network.ServerFace) {
+	for _, srv := range servers {
+		if gs, ok := srv.(network.GracefulServer); ok {
+			gs.StopAccept()
+		}
+	}
+
+	if g.eventBus != nil {
+		g.eventBus.PublishWithQueue(eventbus.EvtGateShutdown, g)
+	}
+
+	timeout := g.option.DrainTimeout
+	if timeout <= 0 {
+		timeout = defaultDrainTimeout
+	}
+
+	deadline := time.Now().Add(timeout)
+	for i, fn := range g.shutdown {
+		share := time.Until(deadline) / time.Duration(len(g.shutdown)-i)
+		g.runHook(fn, share)
+	}
+}
+
+// runHook runs the shutdown hook within its share of the drain timeout.
+// The hook is not waited for past its share, a hook ignoring its context cannot block the shutdown.
+func (g *Gate) runHook(fn ShutdownHook, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			xlog.Write().Error("gate shutdown hook error", zap.Error(err))
+		}
+	case <-ctx.Done():
+		xlog.Write().Warn("gate shutdown hook timeout exceeded", zap.Duration("timeout", timeout))
+	}
 }
 
 // OnClose implements network.Agent.
 func (a *agent) OnClose() {
+	a.gate.agents.Delete(a)
+
 	if a.gate.eventBus == nil {
 		return
 	}
@@ -182,25 +400,195 @@ func (a *agent) OnClose() {
 }
 
 func (a *agent) Run() {
+	if !a.authenticate() {
+		return
+	}
+
+	if a.gate.inboundRate > 0 {
+		a.limiter = newLimiter(a.gate.inboundRate, a.gate.inboundBurst)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a.ctx = ctx
+
 	for {
 		data, err := a.conn.ReadMessage()
 		if err != nil {
-			xlog.Write().Debug("network read message error", zap.Error(err))
+			xlog.Write().Debug("network read message error", zap.Error(err), zap.Any("labels", a.Labels()))
+			break
+		}
+
+		ok, dispatched := a.handle(data)
+		// The message has been processed, its buffer can be reused.
+		// A dispatched message may still be read by its worker, which releases it.
+		if !dispatched {
+			a.release(data)
+		}
+		if !ok {
 			break
 		}
+	}
+}
+
+// release hands the buffer of an inbound message back to the connection, if it pools them.
+// The decoded message may alias the buffer, e.g. with flatbuffers, so it must not be used afterwards.
+func (a *agent) release(data []byte) {
+	if releaser, ok := a.conn.(network.MessageReleaser); ok {
+		releaser.ReleaseMessage(data)
+	}
+}
 
-		if a.gate.processor != nil {
-			msg, err := a.gate.processor.Unmarshal(data)
+// handle decodes and processes an inbound message, in a span if the gate has a tracer.
+// It returns false when the connection must be closed, and whether the message was
+// queued on the dispatch pool, in which case its buffer is released by the worker.
+func (a *agent) handle(data []byte) (ok bool, dispatched bool) {
+	if a.gate.processor == nil {
+		return true, false
+	}
+	if a.gate.tracer == nil {
+		return a.handleCtx(a.ctx, data, nil)
+	}
+
+	ctx, span := a.gate.tracer.Start(a.ctx, len(data))
+	return a.handleCtx(ctx, data, span)
+}
+
+// handleCtx decodes and processes an inbound message with the context, ending the span if any.
+func (a *agent) handleCtx(ctx context.Context, data []byte, span network.Span) (bool, bool) {
+	var err error
+	// The span is handed over to the dispatch worker once the message is queued
+	dispatched := false
+	if span != nil {
+		defer func() {
+			if !dispatched {
+				span.End(err)
+			}
+		}()
+	}
+
+	msg, err := a.gate.processor.Unmarshal(data)
+	if err != nil {
+		xlog.Write().Debug("network processor message decoding error", zap.Error(err), zap.Any("labels", a.Labels()))
+		a.reportError(err)
+		return a.keep(err), false
+	}
+	if span != nil {
+		span.SetName(a.messageName(msg))
+	}
+	if !a.allow() {
+		if a.gate.maxViolations > 0 && a.violations >= a.gate.maxViolations {
+			xlog.Write().Debug("network inbound rate limit exceeded", zap.Int("violations", a.violations))
+			return false, false
+		}
+		return true, false
+	}
+	if a.gate.dispatch != nil {
+		dispatched = a.gate.dispatch.submit(a.id, func() {
+			err := a.process(ctx, msg)
 			if err != nil {
-				xlog.Write().Debug("network processor message decoding error", zap.Error(err))
-				break
+				xlog.Write().Debug("network message processor error", zap.Error(err), zap.Any("labels", a.Labels()))
+				a.reportError(err)
+				// Ends the read loop like a synchronous handler error
+				if !a.keep(err) {
+					a.conn.Close()
+				}
 			}
-			if err = a.gate.processor.Process(msg, a); err != nil {
-				xlog.Write().Debug("network message processor error", zap.Error(err))
-				break
+			if span != nil {
+				span.End(err)
 			}
+			a.release(data)
+		})
+		return dispatched, dispatched
+	}
+	if err = a.process(ctx, msg); err != nil {
+		xlog.Write().Debug("network message processor error", zap.Error(err), zap.Any("labels", a.Labels()))
+		a.reportError(err)
+		return a.keep(err), false
+	}
+	return true, false
+}
+
+// keep reports whether the read loop goes on after a bad message, see Gate.WithErrorPolicy.
+func (a *agent) keep(err error) bool {
+	if a.gate.onError == nil {
+		return false
+	}
+	return a.gate.onError(a, err)
+}
+
+// reportError publishes the decoding or processing error of an inbound message, see eventbus.EvtAgentError.
+func (a *agent) reportError(err error) {
+	if a.gate.eventBus == nil {
+		return
+	}
+
+	a.gate.eventBus.PublishWithQueue(eventbus.EvtAgentError, AgentError{Agent: a, Err: err})
+}
+
+// process runs the message handler, with the connection context if the processor supports it.
+func (a *agent) process(ctx context.Context, msg any) error {
+	if p, ok := a.gate.processor.(network.ContextProcessor); ok {
+		return p.ProcessCtx(ctx, msg, a)
+	}
+	return a.gate.processor.Process(msg, a)
+}
+
+// messageName returns the name of a decoded message given by the processor, or its type.
+func (a *agent) messageName(msg any) string {
+	if n, ok := a.gate.processor.(network.MessageNamer); ok {
+		return n.MessageName(msg)
+	}
+	return fmt.Sprintf("%T", msg)
+}
+
+// allow reports whether the inbound message can be processed under the gate rate limit.
+func (a *agent) allow() bool {
+	if a.limiter == nil {
+		return true
+	}
+	if a.limiter.Allow() {
+		a.violations = 0
+		return true
+	}
+
+	a.violations++
+	if a.gate.throttled != nil {
+		a.gate.throttled.Inc()
+	}
+	return false
+}
+
+// authenticate runs the gate authentication function, if any.
+// It returns false when the connection must be closed.
+func (a *agent) authenticate() bool {
+	if a.gate.auth == nil {
+		return true
+	}
+
+	userID, err := a.gate.auth(a, a.clientAddr)
+	if err != nil {
+		xlog.Write().Debug("network connection authentication failed",
+			zap.String("ip", a.clientAddr.IP),
+			zap.String("port", a.clientAddr.Port),
+			zap.Any("labels", a.Labels()),
+			zap.Error(err),
+		)
+
+		// The error may tell about the backend, the client only gets the configured reason
+		code, reason := a.gate.option.AuthCloseCode, a.gate.option.AuthCloseReason
+		if code == 0 {
+			code = defaultAuthCloseCode
+		}
+		if len(reason) == 0 {
+			reason = defaultAuthCloseReason
 		}
+		a.CloseWithReason(code, nil, reason)
+		return false
 	}
+
+	a.SetUserData(userID)
+	return true
 }
 
 // ClientAddr implements network.Agent.
@@ -246,11 +634,92 @@ func (a *agent) WriteWithCode(code uint, msg any) error {
 	return a.conn.WriteMessage(data...)
 }
 
+// Marshal implements network.Agent.
+func (a *agent) Marshal(code uint, msg any) ([][]byte, error) {
+	if a.gate.processor == nil {
+		return nil, ErrProcessorNotFound
+	}
+
+	if code == 0 {
+		return a.gate.processor.Marshal(msg)
+	}
+	return a.gate.processor.MarshalWithCode(code, msg)
+}
+
+// WriteRaw implements network.Agent.
+func (a *agent) WriteRaw(frames ...[]byte) error {
+	return a.conn.WriteMessage(frames...)
+}
+
+// Buffer implements network.Agent.
+func (a *agent) Buffer(msg any) error {
+	if a.gate.processor == nil {
+		return ErrProcessorNotFound
+	}
+
+	data, err := a.gate.processor.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	a.batchMu.Lock()
+	a.batch = append(a.batch, data)
+	a.batchMu.Unlock()
+	return nil
+}
+
+// Flush implements network.Agent.
+func (a *agent) Flush() error {
+	a.batchMu.Lock()
+	batch := a.batch
+	a.batch = nil
+	a.batchMu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	if bw, ok := a.conn.(network.BatchWriter); ok {
+		return bw.WriteBatch(batch...)
+	}
+	for _, data := range batch {
+		if err := a.conn.WriteMessage(data...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Conn implements network.Agent.
+func (a *agent) Conn() network.Conn {
+	return a.conn
+}
+
+// IsAlive implements network.Agent.
+func (a *agent) IsAlive() bool {
+	return a.conn.IsAlive()
+}
+
 // Close implements Agent.
 func (a *agent) Close() {
 	a.conn.Close()
 }
 
+// CloseWithReason implements network.Agent.
+func (a *agent) CloseWithReason(code uint16, msg any, reason string) {
+	if msg != nil {
+		if err := a.WriteWithCode(uint(code), msg); err != nil {
+			xlog.Write().Debug("network close reason write error", zap.Error(err))
+		}
+	}
+
+	if rc, ok := a.conn.(network.ReasonCloser); ok {
+		rc.CloseWithReason(code, reason)
+		return
+	}
+
+	a.conn.Close()
+}
+
 // Destroy implements network.Agent.
 func (a *agent) Destroy() {
 	a.conn.Destroy()
@@ -266,6 +735,16 @@ func (a *agent) RemoteAddr() net.Addr {
 	return a.conn.RemoteAddr()
 }
 
+// SetLabel implements network.Agent.
+func (a *agent) SetLabel(key, value string) {
+	a.conn.SetLabel(key, value)
+}
+
+// Labels implements network.Agent.
+func (a *agent) Labels() map[string]string {
+	return a.conn.Labels()
+}
+
 // GetUserData implements network.Agent.
 func (a *agent) GetUserData() any {
 	return a.userdata
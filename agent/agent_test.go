@@ -0,0 +1,236 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/czx-lab/czx/eventbus"
+	"github.com/czx-lab/czx/network"
+	"github.com/czx-lab/czx/network/flatbuffer"
+	"github.com/czx-lab/czx/network/ws"
+	fb "github.com/google/flatbuffers/go"
+	"github.com/gorilla/websocket"
+)
+
+var errDecode = errors.New("bad message")
+
+// failProc fails to decode every message
+type failProc struct {
+	network.Processor
+}
+
+func (p *failProc) Unmarshal(data []byte) (any, error) { return nil, errDecode }
+
+// stubConn is a connection without labels
+type stubConn struct {
+	network.Conn
+}
+
+func (c *stubConn) Labels() map[string]string { return nil }
+
+func TestAgentErrorEvent(t *testing.T) {
+	bus := eventbus.NewEventBus(10, eventbus.EvtXqueueType)
+	queue := bus.SubscribeOnQueue(eventbus.EvtAgentError)
+
+	g := NewGate(GateConf{}).WithProcessor(&failProc{}).WithEventBus(bus)
+	a := &agent{gate: g, conn: &stubConn{}, ctx: context.Background()}
+	if ok, _ := a.handle([]byte("garbage")); ok {
+		t.Fatal("a message failing to decode must close the connection")
+	}
+
+	v, ok := queue.Pop()
+	if !ok {
+		t.Fatal("no agent error published")
+	}
+	evt := v.(AgentError)
+	if evt.Agent != a || !errors.Is(evt.Err, errDecode) {
+		t.Fatalf("got %+v, want the agent and errDecode", evt)
+	}
+}
+
+func TestErrorPolicy(t *testing.T) {
+	var skipped []error
+	g := NewGate(GateConf{}).WithProcessor(&failProc{}).WithErrorPolicy(func(_ network.Agent, err error) bool {
+		skipped = append(skipped, err)
+		return true
+	})
+	a := &agent{gate: g, conn: &stubConn{}, ctx: context.Background()}
+	if ok, _ := a.handle([]byte("garbage")); !ok {
+		t.Fatal("the policy keeps the connection")
+	}
+	if len(skipped) != 1 || !errors.Is(skipped[0], errDecode) {
+		t.Fatalf("got %v, want errDecode", skipped)
+	}
+
+	g.WithErrorPolicy(DisconnectOnError)
+	if ok, _ := a.handle([]byte("garbage")); ok {
+		t.Fatal("DisconnectOnError closes the connection")
+	}
+}
+
+// pingMsg is a flatbuffers table with a single byte field, its accessor reads the decoded buffer
+type pingMsg struct {
+	tab fb.Table
+}
+
+func (m *pingMsg) Init(buf []byte, i fb.UOffsetT) {
+	m.tab.Bytes = buf
+	m.tab.Pos = i
+}
+
+func (m *pingMsg) Value() byte {
+	if o := fb.UOffsetT(m.tab.Offset(4)); o != 0 {
+		return m.tab.GetByte(o + m.tab.Pos)
+	}
+	return 0
+}
+
+// poolConn serves a single frame then fails, released buffers are wiped as if reused by the pool
+type poolConn struct {
+	stubConn
+	frames [][]byte
+}
+
+func (c *poolConn) ReadMessage() ([]byte, error) {
+	if len(c.frames) == 0 {
+		return nil, io.EOF
+	}
+	data := c.frames[0]
+	c.frames = c.frames[1:]
+	return data, nil
+}
+
+func (c *poolConn) ReleaseMessage(b []byte) { clear(b) }
+
+func TestDispatchPooledBuffer(t *testing.T) {
+	proc := flatbuffer.NewProcessor(network.ProcessorConf{IDLength: network.IDCodeLenType8})
+	err := proc.Register(network.Message{ID: 1, Data: &pingMsg{}, Fn: network.FlatbuffersSerializerFn(func(b *fb.Builder, _ any) fb.UOffsetT {
+		b.StartObject(1)
+		b.PrependByteSlot(0, 42, 0)
+		return b.EndObject()
+	})})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := make(chan struct{})
+	got := make(chan byte, 1)
+	proc.RegisterHandler(&pingMsg{}, func(args []any) {
+		<-start
+		got <- args[0].(*pingMsg).Value()
+	})
+
+	frames, err := proc.Marshal(&pingMsg{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := NewGate(GateConf{}).WithProcessor(proc).WithDispatchPool(1)
+	g.dispatch = newDispatcher(g.dispatchSize)
+	defer g.dispatch.stop()
+
+	a := &agent{gate: g, conn: &poolConn{frames: [][]byte{slices.Concat(frames...)}}}
+	// The read loop ends before the handler runs, the buffer must not be released yet
+	a.Run()
+	close(start)
+
+	if v := <-got; v != 42 {
+		t.Fatalf("value = %d, want 42", v)
+	}
+}
+
+func TestAuthCloseReason(t *testing.T) {
+	errToken := errors.New("redis: connection refused")
+	g := NewGate(GateConf{}).WithAuth(func(network.Agent, network.ClientAddrMessage) (string, error) {
+		return "", errToken
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		wsconn := ws.NewConn(conn, &ws.WsConnConf{MaxMsgSize: 1024, PendingWriteNum: 8})
+		a := &agent{gate: g, conn: wsconn}
+		a.Run()
+	}))
+	defer srv.Close()
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = peer.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) {
+		t.Fatalf("got %v, want a close frame", err)
+	}
+	// The backend error stays on the server
+	if closeErr.Code != int(defaultAuthCloseCode) || closeErr.Text != defaultAuthCloseReason {
+		t.Fatalf("got %d %q, want %d %q", closeErr.Code, closeErr.Text, defaultAuthCloseCode, defaultAuthCloseReason)
+	}
+}
+
+func TestInboundViolationsReset(t *testing.T) {
+	a := &agent{gate: NewGate(GateConf{}), limiter: newLimiter(1, 1)}
+	// Throttles spread over the session must not add up
+	for range 3 {
+		a.limiter.tokens = 1
+		if !a.allow() {
+			t.Fatal("the message must be allowed with a token left")
+		}
+		if a.allow() {
+			t.Fatal("the message must be throttled without token")
+		}
+	}
+	if a.violations != 1 {
+		t.Fatalf("violations = %d, want 1", a.violations)
+	}
+
+	a.allow()
+	if a.violations != 2 {
+		t.Fatalf("violations = %d, want 2 in a row", a.violations)
+	}
+}
+
+func TestDrainSlowHook(t *testing.T) {
+	ran := make(chan error, 1)
+	block := make(chan struct{})
+	defer close(block)
+	g := NewGate(GateConf{DrainTimeout: 100 * time.Millisecond}).
+		OnShutdown(func(context.Context) error {
+			// Ignores its context
+			<-block
+			return nil
+		}).
+		OnShutdown(func(ctx context.Context) error {
+			ran <- ctx.Err()
+			return nil
+		})
+
+	start := time.Now()
+	g.drain(nil)
+	if took := time.Since(start); took > time.Second {
+		t.Fatalf("drain took %v, want it bounded by the drain timeout", took)
+	}
+
+	select {
+	case err := <-ran:
+		if err != nil {
+			t.Fatalf("the hook after the slow one got an expired context: %v", err)
+		}
+	default:
+		t.Fatal("the hook after the slow one must run")
+	}
+}
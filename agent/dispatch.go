@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"sync"
+)
+
+// defaultDispatchPending is the number of messages queued per dispatch worker before readers block.
+const defaultDispatchPending = 128
+
+// dispatcher runs the message handlers on a fixed set of workers.
+// All the messages of a connection go to the same worker, so they are processed in order,
+// while slow handlers only delay the connections sharing their worker.
+type dispatcher struct {
+	queues []chan func()
+	done   chan struct{}
+	once   sync.Once
+	wg     sync.WaitGroup
+}
+
+func newDispatcher(size int) *dispatcher {
+	d := &dispatcher{
+		queues: make([]chan func(), size),
+		done:   make(chan struct{}),
+	}
+	for i := range d.queues {
+		d.queues[i] = make(chan func(), defaultDispatchPending)
+		d.wg.Add(1)
+		go d.worker(d.queues[i])
+	}
+
+	return d
+}
+
+// submit queues the task on the worker of the key, blocking while the worker queue is full.
+// It reports false if the dispatcher is stopped.
+func (d *dispatcher) submit(key uint64, task func()) bool {
+	select {
+	case <-d.done:
+		return false
+	default:
+	}
+
+	select {
+	case d.queues[key%uint64(len(d.queues))] <- task:
+		return true
+	case <-d.done:
+		return false
+	}
+}
+
+func (d *dispatcher) worker(queue chan func()) {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case task := <-queue:
+			task()
+		case <-d.done:
+			// Run what was queued before the stop
+			for {
+				select {
+				case task := <-queue:
+					task()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// stop runs the queued tasks and stops the workers.
+func (d *dispatcher) stop() {
+	d.once.Do(func() {
+		close(d.done)
+	})
+	d.wg.Wait()
+}
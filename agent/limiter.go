@@ -0,0 +1,42 @@
+package agent
+
+import (
+	"time"
+)
+
+// limiter is a token bucket used to rate limit the inbound messages of a single agent.
+// It is only used from the agent read loop, so it is not safe for concurrent use.
+type limiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate, burst int) *limiter {
+	if burst <= 0 {
+		burst = rate
+	}
+	return &limiter{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Allow reports whether a message may be processed now, consuming a token if so.
+func (l *limiter) Allow() bool {
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
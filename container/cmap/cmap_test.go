@@ -3,6 +3,7 @@ package cmap
 import (
 	"fmt"
 	"runtime"
+	"slices"
 	"sync"
 	"testing"
 
@@ -74,3 +75,65 @@ func TestCmapMemoStats(t *testing.T) {
 	runtime.ReadMemStats(&m)
 	fmt.Printf("After Shrink: Alloc = %v MB, Len = %d\n", m.Alloc/(1024*1024), q.Len())
 }
+
+func TestShardedConcurrentLen(t *testing.T) {
+	m := NewSharded[int, int](Option[int]{Count: 8}, nil)
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 1000 {
+				m.Set(g*1000+i, i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := m.Len(); n != 8000 {
+		t.Fatalf("Len() = %d, want 8000", n)
+	}
+}
+
+func TestShardOf(t *testing.T) {
+	t.Run("TestPointerKeys", func(t *testing.T) {
+		m := NewSharded[*Data, struct{}](Option[*Data]{Count: 4}, nil)
+
+		d := &Data{ID: 1}
+		shard := m.ShardOf(d)
+		// Mutating the pointed value must not move the key to another shard
+		d.Content = "changed"
+		if m.ShardOf(d) != shard {
+			t.Fatal("pointer key changed shard after mutation")
+		}
+	})
+
+	t.Run("TestNegativeHash", func(t *testing.T) {
+		m := NewSharded[int, struct{}](Option[int]{
+			Count: 4,
+			Hash:  func(k int) int { return -k },
+		}, nil)
+
+		for i := range 100 {
+			if idx := m.ShardOf(i); idx < 0 || idx >= 4 {
+				t.Fatalf("ShardOf(%d) = %d out of range", i, idx)
+			}
+			m.Set(i, struct{}{})
+		}
+	})
+}
+
+func TestShardStats(t *testing.T) {
+	m := NewSharded[int, struct{}](Option[int]{Count: 4, Hash: func(k int) int { return k }}, nil)
+	for i := range 10 {
+		m.Set(i, struct{}{})
+	}
+
+	if got := m.ShardStats(); !slices.Equal(got, []int{3, 3, 2, 2}) {
+		t.Fatalf("got %v, want [3 3 2 2]", got)
+	}
+	if got := NewSharded[int, int](Option[int]{}, nil).ShardStats(); len(got) != defaultShardCount {
+		t.Fatalf("got %d shards, want the default %d", len(got), defaultShardCount)
+	}
+}
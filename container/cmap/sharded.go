@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"hash/fnv"
+	"reflect"
 
 	"github.com/czx-lab/czx/container/recycler"
 )
@@ -11,9 +12,19 @@ import (
 const defaultShardCount = 32
 
 type (
+	// Option configures a sharded map.
+	// Hash is optional: without it, string and integer keys are hashed with FNV-1a,
+	// pointer keys by their address, and any other key by its %v representation,
+	// which is slow and only stable for values whose formatting never changes.
+	// Provide Hash for struct keys, e.g. by combining HashString/HashInt on their fields.
+	//
+	// Count is the number of shards, a value less than or equal to zero uses 32. Each shard has its
+	// own lock: pick a few times the number of cores writing concurrently, more shards cost memory
+	// and slow down the iterations. A power of two is not required. Check ShardStats for skew,
+	// a hot shard usually means a poor Hash.
 	Option[K comparable] struct {
 		Count int         // Number of shards
-		Hash  func(K) int // Optional custom hash function
+		Hash  func(K) int // Optional custom hash function, negative results are allowed
 	}
 	// Shareded is a sharded concurrent map implementation.
 	// It divides the key space into multiple shards to reduce lock contention.
@@ -37,27 +48,77 @@ func NewSharded[K comparable, V any](opt Option[K], r recycler.Recycler) *Shared
 	}
 }
 
-// shard returns the shard corresponding to the given key.
-func (s *Shareded[K, V]) shard(key K) *CMap[K, V] {
-	var hash int
+// HashString hashes a string key with FNV-1a.
+func HashString(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32())
+}
+
+// HashInt hashes an int key with FNV-1a.
+func HashInt(key int) int {
+	return HashUint64(uint64(key))
+}
+
+// HashUint64 hashes an uint64 key with FNV-1a.
+func HashUint64(key uint64) int {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], key)
+
+	h := fnv.New32a()
+	h.Write(b[:])
+	return int(h.Sum32())
+}
+
+// hash is the default hash function.
+func hash[K comparable](key K) int {
+	switch k := any(key).(type) {
+	case string:
+		return HashString(k)
+	case int:
+		return HashInt(k)
+	case int64:
+		return HashUint64(uint64(k))
+	case int32:
+		return HashUint64(uint64(k))
+	case uint:
+		return HashUint64(uint64(k))
+	case uint64:
+		return HashUint64(k)
+	case uint32:
+		return HashUint64(uint64(k))
+	}
+
+	// Pointers are hashed by address, formatting them would hash the pointed value
+	if v := reflect.ValueOf(key); v.Kind() == reflect.Pointer || v.Kind() == reflect.UnsafePointer {
+		return HashUint64(uint64(v.Pointer()))
+	}
+
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%v", key)
+	return int(h.Sum32())
+}
+
+// ShardOf returns the index of the shard holding the key.
+// It is mostly useful to check the key distribution of a hash function.
+func (s *Shareded[K, V]) ShardOf(key K) int {
+	var h int
 	if s.opt.Hash != nil {
-		hash = s.opt.Hash(key)
+		h = s.opt.Hash(key)
 	} else {
-		// Default hash function using FNV
-		h := fnv.New32a()
-		switch k := any(key).(type) {
-		case string:
-			h.Write([]byte(k))
-		case int:
-			b := make([]byte, 8)
-			binary.LittleEndian.PutUint64(b, uint64(k))
-			h.Write(b)
-		default:
-			fmt.Fprintf(h, "%v", key)
-		}
-		hash = int(h.Sum32())
+		h = hash(key)
+	}
+
+	idx := h % len(s.shards)
+	if idx < 0 {
+		idx += len(s.shards)
 	}
-	return s.shards[hash%len(s.shards)]
+	return idx
+}
+
+// shard returns the shard corresponding to the given key.
+func (s *Shareded[K, V]) shard(key K) *CMap[K, V] {
+	return s.shards[s.ShardOf(key)]
 }
 
 // Has checks if the key exists in the map.
@@ -105,6 +166,29 @@ func (s *Shareded[K, V]) Iterator(fn func(K, V) bool) {
 	}
 }
 
+// Count returns the number of shards.
+func (s *Shareded[K, V]) Count() int {
+	return len(s.shards)
+}
+
+// ShardStats returns the number of entries of every shard, indexed like ShardOf.
+// Sizes far apart reveal a hash that does not spread the keys evenly.
+func (s *Shareded[K, V]) ShardStats() []int {
+	stats := make([]int, len(s.shards))
+	for i, shard := range s.shards {
+		stats[i] = shard.Len()
+	}
+	return stats
+}
+
+// ShardIterator iterates over the key-value pairs of the shard at index idx, see ShardOf.
+func (s *Shareded[K, V]) ShardIterator(idx int, fn func(K, V) bool) {
+	if idx < 0 || idx >= len(s.shards) {
+		return
+	}
+	s.shards[idx].Iterator(fn)
+}
+
 // Keys returns a slice of all keys in the map.
 func (s *Shareded[K, V]) Keys() []K {
 	var keys []K
@@ -116,6 +200,8 @@ func (s *Shareded[K, V]) Keys() []K {
 }
 
 // Len returns the total number of key-value pairs in the map.
+// Each shard is read under its own lock, so under concurrent writes the result reflects
+// every completed write but may miss writes racing with the call.
 func (s *Shareded[K, V]) Len() int {
 	total := 0
 	for _, shard := range s.shards {
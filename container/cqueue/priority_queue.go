@@ -4,7 +4,6 @@ import (
 	"container/heap"
 	"slices"
 	"sync"
-	"time"
 
 	"github.com/czx-lab/czx/container/recycler"
 	"github.com/czx-lab/czx/utils/xslices"
@@ -23,9 +22,9 @@ type (
 	item[T any]   struct {
 		value T
 		// The priority of the item in the queue.
-		priority  int
-		index     int // The index of the item in the heap.
-		timestamp int64
+		priority int
+		index    int    // The index of the item in the heap.
+		seq      uint64 // Push order, items of equal priority are popped first in first out
 	}
 	// A PriorityQueue implements heap.Interface and holds Items.
 	// The zero value for PriorityQueue is an empty queue ready to use.
@@ -38,6 +37,7 @@ type (
 		recycler recycler.Recycler
 		mu       sync.Mutex
 		closed   bool
+		seq      uint64
 	}
 )
 
@@ -46,9 +46,9 @@ func (q qitems[T]) Len() int { return len(q) }
 
 // Less implements heap.Interface.
 func (q qitems[T]) Less(i int, j int) bool {
-	// If priorities are equal, compare timestamps
+	// If priorities are equal, the first pushed goes first
 	if q[i].priority == q[j].priority {
-		return q[i].timestamp < q[j].timestamp
+		return q[i].seq < q[j].seq
 	}
 	return q[i].priority < q[j].priority
 }
@@ -139,7 +139,8 @@ func (pq *PriorityQueue[T]) Push(value PriorityItem[T]) bool {
 	if len(pq.items) == 0 {
 		available = true
 	}
-	item := &item[T]{value: value.Value, priority: value.Priority, timestamp: time.Now().UnixMilli()}
+	pq.seq++
+	item := &item[T]{value: value.Value, priority: value.Priority, seq: pq.seq}
 	heap.Push(&pq.items, item)
 	if available {
 		pq.cond.Signal()
@@ -216,6 +217,44 @@ func (pq *PriorityQueue[T]) SearchFunc(fn func(T) bool) (T, bool) {
 	return zero, false
 }
 
+// UpdatePriority changes the priority of an element satisfying match and restores the heap order,
+// e.g. to boost an entry that has waited too long. It returns false if no element matches.
+// The element keeps its position among the elements of the same priority pushed after it.
+func (pq *PriorityQueue[T]) UpdatePriority(match func(T) bool, newPriority int) bool {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+
+	index, ok := xslices.Search(pq.items, func(item *item[T]) bool {
+		return match(item.value)
+	})
+	if !ok {
+		return false
+	}
+
+	pq.items[index].priority = newPriority
+	heap.Fix(&pq.items, index)
+	return true
+}
+
+// RemoveFunc removes and returns an element satisfying match wherever it is in the heap,
+// e.g. to cancel a queued task before it runs. It returns the zero value of T and false if no element matches.
+func (pq *PriorityQueue[T]) RemoveFunc(match func(T) bool) (T, bool) {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+
+	index, ok := xslices.Search(pq.items, func(item *item[T]) bool {
+		return match(item.value)
+	})
+	if !ok {
+		var zero T
+		return zero, false
+	}
+
+	val := heap.Remove(&pq.items, pq.items[index].index).(*item[T])
+	pq.shrink()
+	return val.value, true
+}
+
 // Clear removes all elements from the priority queue.
 func (pq *PriorityQueue[T]) Clear() {
 	pq.mu.Lock()
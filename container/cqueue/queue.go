@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"slices"
 	"sync"
+	"time"
+	"unsafe"
 
 	"github.com/czx-lab/czx/container/recycler"
 	"github.com/czx-lab/czx/utils/xslices"
@@ -19,6 +21,7 @@ type Queue[T any] struct {
 	maxCapacity int
 	recycler    recycler.Recycler // Optional recycler for memory management
 	closed      bool
+	lastShrink  time.Time
 }
 
 // NewQueue creates a new instance of Queue for the specified type T.
@@ -72,10 +75,31 @@ func (q *Queue[T]) shrink() {
 	}
 
 	if q.recycler.Shrink(len(q.queue), cap(q.queue)) {
-		q.queue = slices.Clip(q.queue) // Shrink the slice to fit its length
+		q.clip()
 	}
 }
 
+// clip reallocates the queue to fit its length and reports the reclaimed memory to the recycler.
+func (q *Queue[T]) clip() {
+	var zero T
+	reclaimed := (cap(q.queue) - len(q.queue)) * int(unsafe.Sizeof(zero))
+
+	q.queue = slices.Clone(q.queue) // Copy so the old backing array can be released
+	q.lastShrink = time.Now()
+
+	if r, ok := q.recycler.(recycler.Reclaimer); ok {
+		r.Reclaimed(reclaimed)
+	}
+}
+
+// LastShrink returns the time of the last shrink, zero if the queue was never shrunk.
+func (q *Queue[T]) LastShrink() time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.lastShrink
+}
+
 // Search searches for an element in the queue using a custom function.
 func (q *Queue[T]) SearchFunc(fn func(T) bool) (T, bool) {
 	q.mu.Lock()
@@ -241,6 +265,33 @@ func (q *Queue[T]) PopBatch(n int) ([]T, bool) {
 	return data, true
 }
 
+// Drain removes the elements one by one from the front of the queue and calls fn for each of them,
+// until the queue is empty. fn is called without the lock, so it may use the queue.
+// After Close, no element can be pushed anymore and Drain flushes the remaining ones, e.g. on shutdown.
+func (q *Queue[T]) Drain(fn func(T)) {
+	for {
+		data, ok := q.Pop()
+		if !ok {
+			return
+		}
+		fn(data)
+	}
+}
+
+// ForEach calls fn for each element of the queue, from the front, until fn returns false.
+// The elements are not removed, fn is called on a snapshot taken under the lock.
+func (q *Queue[T]) ForEach(fn func(T) bool) {
+	q.mu.Lock()
+	snapshot := slices.Clone(q.queue)
+	q.mu.Unlock()
+
+	for _, data := range snapshot {
+		if !fn(data) {
+			return
+		}
+	}
+}
+
 // Clear removes all elements from the queue.
 // It locks the queue to ensure thread safety while clearing.
 func (q *Queue[T]) Clear() {
@@ -265,5 +316,5 @@ func (q *Queue[T]) Shrink() {
 		return // No need to shrink if capacity is already equal to length
 	}
 
-	q.queue = slices.Clip(q.queue)
+	q.clip()
 }
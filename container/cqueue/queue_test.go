@@ -1,6 +1,7 @@
 package cqueue
 
 import (
+	"context"
 	"fmt"
 	"runtime"
 	"sync"
@@ -128,6 +129,46 @@ func TestQueueMemStats(t *testing.T) {
 	fmt.Printf("After Shrink: Alloc = %v MB, Len = %d\n", m.Alloc/(1024*1024), q.Len())
 }
 
+func TestXchanClose(t *testing.T) {
+	xch := NewXchan[int](context.Background(), XchanConf{Bufsize: 4, Insize: 1, Outsize: 1})
+
+	const count = 10000
+	go func() {
+		// Burst while nothing reads so that most elements go through the buffer
+		for i := 0; i < count; i++ {
+			xch.In() <- i
+		}
+		xch.Close()
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	var next int
+	for v := range xch.Out() {
+		if v != next {
+			t.Fatalf("out of order: got %d, want %d", v, next)
+		}
+		next++
+	}
+	if next != count {
+		t.Fatalf("drained %d elements, want %d", next, count)
+	}
+	if xch.BufferLen() != 0 {
+		t.Fatalf("buffer len: got %d, want 0", xch.BufferLen())
+	}
+	if xch.Overflows() == 0 || xch.HighWaterMark() <= 4 {
+		t.Fatalf("expected the buffer to grow: overflows %d, high water mark %d", xch.Overflows(), xch.HighWaterMark())
+	}
+
+	select {
+	case <-xch.Closed():
+	case <-time.After(time.Second):
+		t.Fatal("worker did not stop")
+	}
+	// Close is idempotent
+	xch.Close()
+}
+
 func BenchmarkQueue(b *testing.B) {
 
 	queue := NewQueue[*Data](0)
@@ -170,3 +211,78 @@ func BenchmarkQueue(b *testing.B) {
 		b.Fatal("timeout waiting for consumer")
 	}
 }
+
+func TestQueueDrain(t *testing.T) {
+	q := NewQueue[int](0)
+	q.Push(1, 2, 3, 4)
+
+	var seen []int
+	q.ForEach(func(v int) bool {
+		seen = append(seen, v)
+		return v < 2
+	})
+	if fmt.Sprint(seen) != "[1 2]" || q.Len() != 4 {
+		t.Fatalf("ForEach saw %v, queue len %d", seen, q.Len())
+	}
+
+	q.Close()
+	if err := q.Push(5); err == nil {
+		t.Fatal("push on a closed queue")
+	}
+
+	var drained []int
+	q.Drain(func(v int) {
+		drained = append(drained, v)
+	})
+	if fmt.Sprint(drained) != "[1 2 3 4]" || !q.IsEmpty() {
+		t.Fatalf("drained %v, queue len %d", drained, q.Len())
+	}
+}
+
+func TestPriorityQueueUpdatePriority(t *testing.T) {
+	pq := NewPriorityQueue[string](0)
+	for i, v := range []string{"a", "b", "c", "d"} {
+		pq.Push(PriorityItem[string]{Value: v, Priority: i + 1})
+	}
+
+	// d waited too long, it goes first
+	if !pq.UpdatePriority(func(v string) bool { return v == "d" }, 0) {
+		t.Fatal("d not found")
+	}
+	// a is demoted behind c
+	pq.UpdatePriority(func(v string) bool { return v == "a" }, 5)
+	if pq.UpdatePriority(func(v string) bool { return v == "x" }, 0) {
+		t.Fatal("missing item updated")
+	}
+
+	var order []string
+	for v, ok := pq.Pop(); ok; v, ok = pq.Pop() {
+		order = append(order, v)
+	}
+	if fmt.Sprint(order) != "[d b c a]" {
+		t.Fatalf("pop order %v, want [d b c a]", order)
+	}
+}
+
+func TestPriorityQueueRemoveFunc(t *testing.T) {
+	pq := NewPriorityQueue[int](0)
+	for _, p := range []int{5, 3, 8, 1, 9, 4, 7, 2, 6} {
+		pq.Push(PriorityItem[int]{Value: p, Priority: p})
+	}
+
+	// 4 sits in the middle of the heap
+	if v, ok := pq.RemoveFunc(func(v int) bool { return v == 4 }); !ok || v != 4 {
+		t.Fatalf("removed %d %v, want 4", v, ok)
+	}
+	if _, ok := pq.RemoveFunc(func(v int) bool { return v == 4 }); ok {
+		t.Fatal("removed twice")
+	}
+
+	var order []int
+	for v, ok := pq.Pop(); ok; v, ok = pq.Pop() {
+		order = append(order, v)
+	}
+	if fmt.Sprint(order) != "[1 2 3 5 6 7 8 9]" {
+		t.Fatalf("pop order %v, want [1 2 3 5 6 7 8 9]", order)
+	}
+}
@@ -2,6 +2,8 @@ package cqueue
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 
 	"github.com/czx-lab/czx/container/ringbuffer"
 )
@@ -16,11 +18,23 @@ type (
 	// It uses a ring buffer to manage the flow of data between the input and output channels.
 	// It supports burst writes and ensures that the output channel is not blocked by full buffers.
 	// The buffer size is configurable, and it can handle concurrent writes and reads efficiently.
+	//
+	// Elements are delivered to Out in the order they were written to In (FIFO), whether they
+	// went straight to the output channel or through the buffer.
+	// The worker goroutine stops when Close is called and everything has been drained,
+	// or when the context is cancelled, in which case buffered elements are dropped.
 	Xchan[T any] struct {
-		conf   XchanConf
-		in     chan<- T // channel for write
-		out    <-chan T // channel for read
-		buffer *ringbuffer.RingBuffer[T]
+		conf      XchanConf
+		in        chan<- T // channel for write
+		out       <-chan T // channel for read
+		buffer    *ringbuffer.RingBuffer[T]
+		closeOnce sync.Once
+		done      chan struct{}
+
+		// buffer statistics, written by the worker only
+		bufLen    atomic.Int64
+		highWater atomic.Int64
+		overflows atomic.Uint64
 	}
 )
 
@@ -32,6 +46,7 @@ func NewXchan[T any](ctx context.Context, conf XchanConf) *Xchan[T] {
 		in:     in,
 		out:    out,
 		buffer: ringbuffer.NewRingBuffer[T](conf.Bufsize),
+		done:   make(chan struct{}),
 	}
 
 	go xch.worker(ctx, in, out)
@@ -49,7 +64,40 @@ func (x *Xchan[T]) Out() <-chan T {
 	return x.out
 }
 
+// BufferLen returns the number of elements currently held in the internal buffer.
+func (x *Xchan[T]) BufferLen() int {
+	return int(x.bufLen.Load())
+}
+
+// HighWaterMark returns the largest number of elements the internal buffer has held.
+// A value growing far beyond Bufsize points to a slow or stuck consumer.
+func (x *Xchan[T]) HighWaterMark() int {
+	return int(x.highWater.Load())
+}
+
+// Overflows returns how many elements could not be sent straight to Out
+// and had to be stored in the internal buffer.
+func (x *Xchan[T]) Overflows() uint64 {
+	return x.overflows.Load()
+}
+
+// Close closes the input channel and waits until every element written before it
+// has been received from Out, or the context is cancelled. Out is closed afterwards.
+// Writing to In after Close panics, as with any closed channel. Close is idempotent.
+func (x *Xchan[T]) Close() {
+	x.closeOnce.Do(func() {
+		close(x.in)
+	})
+	<-x.done
+}
+
+// Closed returns a channel closed once the worker has stopped and Out has been closed.
+func (x *Xchan[T]) Closed() <-chan struct{} {
+	return x.done
+}
+
 func (x *Xchan[T]) worker(ctx context.Context, in, out chan T) {
+	defer close(x.done)
 	defer close(out)
 
 	drain := func() {
@@ -61,6 +109,7 @@ func (x *Xchan[T]) worker(ctx context.Context, in, out chan T) {
 			select {
 			case out <- val:
 				x.buffer.Pop()
+				x.bufLen.Add(-1)
 			case <-ctx.Done():
 				return
 			}
@@ -82,7 +131,7 @@ func (x *Xchan[T]) worker(ctx context.Context, in, out chan T) {
 				select {
 				case out <- v:
 				default:
-					x.buffer.Write(v)
+					x.spill(v)
 				}
 			}
 
@@ -103,12 +152,25 @@ func (x *Xchan[T]) worker(ctx context.Context, in, out chan T) {
 				return
 			}
 
-			x.buffer.Write(v)
+			x.spill(v)
 		case out <- val:
 			x.buffer.Pop()
+			x.bufLen.Add(-1)
 			if x.buffer.IsEmpty() && x.buffer.Cap() > x.conf.Bufsize {
 				x.buffer.Reset()
 			}
 		}
 	}
 }
+
+// spill stores v in the buffer and updates the buffer statistics.
+func (x *Xchan[T]) spill(v T) {
+	x.buffer.Write(v)
+	x.overflows.Add(1)
+
+	n := int64(x.buffer.Len())
+	x.bufLen.Store(n)
+	if n > x.highWater.Load() {
+		x.highWater.Store(n)
+	}
+}
@@ -0,0 +1,71 @@
+package recycler
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Stats is a snapshot of the shrink activity observed by a Monitor.
+	Stats struct {
+		// Decisions is the number of times the recycler was asked whether to shrink
+		Decisions uint64
+		// Shrinks is the number of times the recycler decided to shrink
+		Shrinks uint64
+		// ReclaimedBytes is the estimated number of bytes released by the shrinks
+		ReclaimedBytes uint64
+		// LastShrink is the time of the last shrink decision, zero if none
+		LastShrink time.Time
+	}
+	// Monitor wraps a Recycler and records its decisions, so the shrink policy can be tuned
+	// from real reclamation. It is safe for concurrent use and can be shared by many containers.
+	Monitor struct {
+		r          Recycler
+		decisions  atomic.Uint64
+		shrinks    atomic.Uint64
+		reclaimed  atomic.Uint64
+		lastShrink atomic.Int64
+	}
+)
+
+var (
+	_ Recycler  = (*Monitor)(nil)
+	_ Reclaimer = (*Monitor)(nil)
+)
+
+// NewMonitor returns a Monitor delegating the shrink decisions to r.
+func NewMonitor(r Recycler) *Monitor {
+	return &Monitor{r: r}
+}
+
+// Shrink implements Recycler.
+func (m *Monitor) Shrink(len_ int, cap_ int) bool {
+	m.decisions.Add(1)
+	if !m.r.Shrink(len_, cap_) {
+		return false
+	}
+
+	m.shrinks.Add(1)
+	m.lastShrink.Store(time.Now().UnixNano())
+	return true
+}
+
+// Reclaimed implements Reclaimer.
+func (m *Monitor) Reclaimed(bytes int) {
+	if bytes > 0 {
+		m.reclaimed.Add(uint64(bytes))
+	}
+}
+
+// Stats returns a snapshot of the recorded shrink activity.
+func (m *Monitor) Stats() Stats {
+	stats := Stats{
+		Decisions:      m.decisions.Load(),
+		Shrinks:        m.shrinks.Load(),
+		ReclaimedBytes: m.reclaimed.Load(),
+	}
+	if last := m.lastShrink.Load(); last > 0 {
+		stats.LastShrink = time.Unix(0, last)
+	}
+	return stats
+}
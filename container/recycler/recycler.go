@@ -6,3 +6,10 @@ type Recycler interface {
 	// It returns true if the container was successfully shrunk.
 	Shrink(len_ int, cap_ int) bool
 }
+
+// Reclaimer is optionally implemented by recyclers that want to be told how much memory
+// the containers released after a shrink.
+type Reclaimer interface {
+	// Reclaimed reports the estimated number of bytes released by a shrink.
+	Reclaimed(bytes int)
+}
@@ -1,3 +1,7 @@
+// Package ringbuffer provides a generic FIFO ring buffer.
+// By default the buffer grows when it is full; in overwrite mode it keeps a fixed capacity
+// and drops the oldest element instead, which suits sliding windows such as RTT samples or frame history.
+// A RingBuffer is not safe for concurrent use, guard it with a mutex when shared between goroutines.
 package ringbuffer
 
 const (
@@ -11,7 +15,9 @@ type RingBuffer[T any] struct {
 	// Size of the buffer
 	init, size int
 	r          int // Read index
-	w          int // Write index
+	n          int // Number of elements
+	// overwrite drops the oldest element instead of growing when the buffer is full
+	overwrite bool
 }
 
 func NewRingBuffer[T any](cap int) *RingBuffer[T] {
@@ -26,16 +32,25 @@ func NewRingBuffer[T any](cap int) *RingBuffer[T] {
 	}
 }
 
+// WithOverwrite enables the overwrite mode: the capacity is fixed and writing to a full buffer
+// overwrites the oldest element.
+func (rb *RingBuffer[T]) WithOverwrite() *RingBuffer[T] {
+	rb.overwrite = true
+	return rb
+}
+
 // Read reads an element from the ring buffer.
 // It returns the element and a boolean indicating whether the read was successful.
 func (rb *RingBuffer[T]) Read() (T, bool) {
 	var zero T
-	if rb.r == rb.w {
+	if rb.n == 0 {
 		return zero, false // Buffer is empty
 	}
 
 	item := rb.buf[rb.r]
+	rb.buf[rb.r] = zero         // Release the reference held by the slot
 	rb.r = (rb.r + 1) % rb.size // Move read index forward
+	rb.n--
 
 	return item, true
 }
@@ -43,17 +58,13 @@ func (rb *RingBuffer[T]) Read() (T, bool) {
 // Pop removes and returns the first element from the ring buffer.
 // It returns the element and a boolean indicating whether the pop was successful.
 func (rb *RingBuffer[T]) Pop() (T, bool) {
-	v, ok := rb.Read()
-	if !ok {
-		return v, false // Buffer is empty
-	}
-	return v, true
+	return rb.Read()
 }
 
 // Peek returns the first element from the ring buffer without removing it.
 // It returns the element and a boolean indicating whether the peek was successful.
 func (rb *RingBuffer[T]) Peek() (T, bool) {
-	if rb.r == rb.w {
+	if rb.n == 0 {
 		var zero T
 		return zero, false // Buffer is empty
 	}
@@ -62,16 +73,31 @@ func (rb *RingBuffer[T]) Peek() (T, bool) {
 }
 
 // Write adds an element to the end of the ring buffer.
-// If the buffer is full, it grows the buffer to accommodate more elements.
+// If the buffer is full, it grows the buffer to accommodate more elements,
+// or overwrites the oldest element in overwrite mode.
 func (rb *RingBuffer[T]) Write(data T) {
-	nextW := (rb.w + 1) % rb.size
-	if nextW == rb.r {
-		rb.grow() // Buffer is full, grow it
-		nextW = (rb.w + 1) % rb.size
+	rb.Push(data)
+}
+
+// Push adds an element to the end of the ring buffer, see Write.
+// It returns true if an element was overwritten to make room for it.
+func (rb *RingBuffer[T]) Push(data T) bool {
+	var overwritten bool
+	if rb.n == rb.size {
+		if rb.overwrite {
+			// Drop the oldest element
+			rb.r = (rb.r + 1) % rb.size
+			rb.n--
+			overwritten = true
+		} else {
+			rb.grow() // Buffer is full, grow it
+		}
 	}
 
-	rb.buf[rb.w] = data
-	rb.w = nextW
+	rb.buf[(rb.r+rb.n)%rb.size] = data
+	rb.n++
+
+	return overwritten
 }
 
 // grow increases the size of the ring buffer.
@@ -84,42 +110,41 @@ func (rb *RingBuffer[T]) grow() {
 		size = rb.size + rb.size/4
 	}
 	buf := make([]T, size)
-	n := rb.Len()
-	for i := range n {
+	for i := range rb.n {
 		buf[i] = rb.buf[(rb.r+i)%rb.size]
 	}
 	rb.r = 0
-	rb.w = n
 	rb.size = size
 	rb.buf = buf
 }
 
 // IsEmpty checks if the ring buffer is empty.
 func (rb *RingBuffer[T]) IsEmpty() bool {
-	return rb.r == rb.w
+	return rb.n == 0
+}
+
+// IsFull checks if the ring buffer is full.
+// A full buffer grows on the next write, or overwrites its oldest element in overwrite mode.
+func (rb *RingBuffer[T]) IsFull() bool {
+	return rb.n == rb.size
 }
 
 // Cap returns the capacity of the ring buffer.
-// It returns the size of the buffer.
+// It returns the number of elements the buffer can hold without growing.
 func (rb *RingBuffer[T]) Cap() int {
 	return rb.size
 }
 
 // Len returns the number of elements in the ring buffer.
-// It calculates the length based on the read and write indices.
 func (rb *RingBuffer[T]) Len() int {
-	if rb.w >= rb.r {
-		return rb.w - rb.r
-	}
-
-	return rb.size - rb.r + rb.w
+	return rb.n
 }
 
 // Reset resets the ring buffer to its initial state.
-// It clears the read and write indices and reinitializes the buffer.
+// It clears the read index and the elements, and reinitializes the buffer.
 func (rb *RingBuffer[T]) Reset() {
 	rb.r = 0
-	rb.w = 0
+	rb.n = 0
 	rb.size = rb.init
 	rb.buf = make([]T, rb.init)
 }
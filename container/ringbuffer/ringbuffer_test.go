@@ -0,0 +1,84 @@
+package ringbuffer
+
+import (
+	"testing"
+)
+
+func TestRingBuffer(t *testing.T) {
+	t.Run("TestWraparound", func(t *testing.T) {
+		rb := NewRingBuffer[int](4)
+
+		// Move the read index forward so the following writes wrap around
+		for i := range 3 {
+			rb.Push(i)
+		}
+		for range 3 {
+			rb.Pop()
+		}
+
+		for i := range 4 {
+			if rb.Push(i) {
+				t.Fatalf("unexpected overwrite at %d", i)
+			}
+		}
+		if !rb.IsFull() || rb.Len() != 4 || rb.Cap() != 4 {
+			t.Fatalf("unexpected state: full=%v len=%d cap=%d", rb.IsFull(), rb.Len(), rb.Cap())
+		}
+
+		// Grow while wrapped around
+		rb.Push(4)
+		if rb.Cap() <= 4 || rb.Len() != 5 {
+			t.Fatalf("buffer did not grow: len=%d cap=%d", rb.Len(), rb.Cap())
+		}
+
+		for i := range 5 {
+			v, ok := rb.Pop()
+			if !ok || v != i {
+				t.Fatalf("pop %d: got %d, %v", i, v, ok)
+			}
+		}
+		if _, ok := rb.Pop(); ok || !rb.IsEmpty() {
+			t.Fatal("buffer should be empty")
+		}
+	})
+
+	t.Run("TestOverwrite", func(t *testing.T) {
+		rb := NewRingBuffer[int](3).WithOverwrite()
+
+		for i := range 3 {
+			if rb.Push(i) {
+				t.Fatalf("unexpected overwrite at %d", i)
+			}
+		}
+		for i := 3; i < 7; i++ {
+			if !rb.Push(i) {
+				t.Fatalf("expected overwrite at %d", i)
+			}
+		}
+		if rb.Cap() != 3 || rb.Len() != 3 {
+			t.Fatalf("unexpected state: len=%d cap=%d", rb.Len(), rb.Cap())
+		}
+
+		if v, _ := rb.Peek(); v != 4 {
+			t.Fatalf("peek: got %d, want 4", v)
+		}
+		for want := 4; want < 7; want++ {
+			v, ok := rb.Pop()
+			if !ok || v != want {
+				t.Fatalf("pop: got %d, %v, want %d", v, ok, want)
+			}
+		}
+	})
+
+	t.Run("TestReset", func(t *testing.T) {
+		rb := NewRingBuffer[int](2)
+		for i := range 10 {
+			rb.Push(i)
+		}
+
+		rb.Reset()
+		if !rb.IsEmpty() || rb.Cap() != 2 {
+			t.Fatalf("unexpected state after reset: len=%d cap=%d", rb.Len(), rb.Cap())
+		}
+	})
+}
@@ -3,14 +3,17 @@ package container
 import (
 	"slices"
 	"sync"
+	"time"
+	"unsafe"
 
 	"github.com/czx-lab/czx/container/recycler"
 )
 
 type Xslices[T comparable] struct {
-	mu       sync.RWMutex
-	data     []T
-	recycler recycler.Recycler
+	mu         sync.RWMutex
+	data       []T
+	recycler   recycler.Recycler
+	lastShrink time.Time
 }
 
 func New[T comparable]() *Xslices[T] {
@@ -19,6 +22,14 @@ func New[T comparable]() *Xslices[T] {
 	}
 }
 
+// NewWithCap creates an Xslices with room for n items, avoiding the reallocations
+// while the slice grows to a known size.
+func NewWithCap[T comparable](n int) *Xslices[T] {
+	return &Xslices[T]{
+		data: make([]T, 0, n),
+	}
+}
+
 func (xs *Xslices[T]) WithRecycler(r recycler.Recycler) *Xslices[T] {
 	xs.recycler = r
 	return xs
@@ -30,10 +41,31 @@ func (xs *Xslices[T]) shrink() {
 	}
 
 	if xs.recycler.Shrink(len(xs.data), cap(xs.data)) {
-		xs.data = slices.Clip(xs.data) // Shrink the slice to fit its length
+		xs.clip()
 	}
 }
 
+// clip reallocates the data slice to fit its length and reports the reclaimed memory to the recycler.
+func (xs *Xslices[T]) clip() {
+	var zero T
+	reclaimed := (cap(xs.data) - len(xs.data)) * int(unsafe.Sizeof(zero))
+
+	xs.data = slices.Clone(xs.data) // Copy so the old backing array can be released
+	xs.lastShrink = time.Now()
+
+	if r, ok := xs.recycler.(recycler.Reclaimer); ok {
+		r.Reclaimed(reclaimed)
+	}
+}
+
+// LastShrink returns the time of the last shrink, zero if the slice was never shrunk.
+func (xs *Xslices[T]) LastShrink() time.Time {
+	xs.mu.RLock()
+	defer xs.mu.RUnlock()
+
+	return xs.lastShrink
+}
+
 // Append adds new items to the Xslices data slice.
 // It locks the mutex to ensure thread safety while appending items.
 // After appending, it records the new length in the wins slice.
@@ -45,6 +77,14 @@ func (xs *Xslices[T]) Append(items ...T) {
 	xs.data = append(xs.data, items...)
 }
 
+// AppendBatch adds all the items of a slice with a single lock, growing the data slice at most once.
+func (xs *Xslices[T]) AppendBatch(items []T) {
+	xs.mu.Lock()
+	defer xs.mu.Unlock()
+
+	xs.data = append(xs.data, items...)
+}
+
 // Get retrieves an item from the Xslices data slice by index.
 func (xs *Xslices[T]) Get(index int) (T, bool) {
 	xs.mu.RLock()
@@ -57,6 +97,32 @@ func (xs *Xslices[T]) Get(index int) (T, bool) {
 	return xs.data[index], true
 }
 
+// Set replaces the item at index in place, keeping the order of the others.
+// If the index is out of bounds, it returns false.
+func (xs *Xslices[T]) Set(index int, value T) bool {
+	xs.mu.Lock()
+	defer xs.mu.Unlock()
+
+	if index < 0 || index >= len(xs.data) {
+		return false
+	}
+	xs.data[index] = value
+	return true
+}
+
+// Swap exchanges the items at indexes i and j atomically.
+// If one of the indexes is out of bounds, it returns false.
+func (xs *Xslices[T]) Swap(i, j int) bool {
+	xs.mu.Lock()
+	defer xs.mu.Unlock()
+
+	if i < 0 || i >= len(xs.data) || j < 0 || j >= len(xs.data) {
+		return false
+	}
+	xs.data[i], xs.data[j] = xs.data[j], xs.data[i]
+	return true
+}
+
 // Remove deletes an item from the Xslices data slice by index.
 // It locks the mutex to ensure thread safety while removing the item.
 // If the index is out of bounds, it returns false.
@@ -97,6 +163,17 @@ func (xs *Xslices[T]) Clear() {
 	xs.data = nil
 }
 
+// Reset removes all items but keeps the capacity of the data slice, unlike Clear,
+// so that a list rebuilt every frame does not reallocate.
+func (xs *Xslices[T]) Reset() {
+	xs.mu.Lock()
+	defer xs.mu.Unlock()
+
+	// Zero the items so that the pointers they hold can be collected
+	clear(xs.data)
+	xs.data = xs.data[:0]
+}
+
 // SearchFunc searches for an item in the Xslices data slice using a provided function.
 func (xs *Xslices[T]) SearchFunc(fn func(v T) bool) (v T, ok bool) {
 	xs.mu.RLock()
@@ -147,5 +224,5 @@ func (xs *Xslices[T]) Shrink() {
 		return
 	}
 
-	xs.data = slices.Clip(xs.data)
+	xs.clip()
 }
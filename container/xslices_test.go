@@ -0,0 +1,65 @@
+package container
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestXslicesSetSwap(t *testing.T) {
+	xs := New[string]()
+	xs.Append("a", "b", "c")
+
+	if !xs.Set(1, "B") || xs.Set(3, "D") || xs.Set(-1, "Z") {
+		t.Fatal("Set bounds check failed")
+	}
+	if !xs.Swap(0, 2) || xs.Swap(0, 3) {
+		t.Fatal("Swap bounds check failed")
+	}
+
+	if got := xs.Clone(); !slices.Equal(got, []string{"c", "B", "a"}) {
+		t.Fatalf("got %v, want [c B a]", got)
+	}
+}
+
+func TestXslicesReset(t *testing.T) {
+	xs := NewWithCap[int](8)
+	xs.AppendBatch([]int{1, 2, 3})
+	xs.Reset()
+	if xs.Len() != 0 || cap(xs.data) != 8 {
+		t.Fatalf("len %d cap %d after Reset, want 0 and 8", xs.Len(), cap(xs.data))
+	}
+
+	xs.AppendBatch([]int{4, 5})
+	if got := xs.Clone(); !slices.Equal(got, []int{4, 5}) {
+		t.Fatalf("got %v, want [4 5]", got)
+	}
+}
+
+// BenchmarkXslicesRebuild rebuilds a list of 1000 entities every frame.
+func BenchmarkXslicesRebuild(b *testing.B) {
+	const entities = 1000
+
+	frame := make([]int, entities)
+	for i := range frame {
+		frame[i] = i
+	}
+
+	b.Run("clear_append", func(b *testing.B) {
+		b.ReportAllocs()
+		xs := New[int]()
+		for b.Loop() {
+			xs.Clear()
+			for _, v := range frame {
+				xs.Append(v)
+			}
+		}
+	})
+	b.Run("reset_batch", func(b *testing.B) {
+		b.ReportAllocs()
+		xs := NewWithCap[int](entities)
+		for b.Loop() {
+			xs.Reset()
+			xs.AppendBatch(frame)
+		}
+	})
+}
@@ -1,10 +1,13 @@
 package eventbus
 
 import (
+	"errors"
+	"fmt"
 	"slices"
 	"sync"
 	"sync/atomic"
 
+	"github.com/czx-lab/czx/container/cmap"
 	"github.com/czx-lab/czx/container/cqueue"
 	"github.com/czx-lab/czx/container/recycler"
 	"github.com/czx-lab/czx/xlog"
@@ -15,9 +18,16 @@ const (
 	EvtAgentClose = "AgentClose"
 	//	Event name for when an agent starts.
 	EvtNewAgent = "AgentNew"
+	// EvtAgentError is the event name for when an inbound message of an agent fails to be decoded or processed.
+	EvtAgentError = "AgentError"
+	// EvtGateShutdown is the event name for when a gate starts its graceful shutdown.
+	EvtGateShutdown = "GateShutdown"
 	// EvtDefaultType is the default name for the event bus.
 	EvtDefaultType EvtType = "channel"
 	EvtXqueueType  EvtType = "xqueue"
+
+	// orderedStripes is the number of locks serializing PublishOrdered, keys are spread over them
+	orderedStripes = 64
 )
 
 type (
@@ -29,6 +39,10 @@ type (
 		capacity      int32
 		typ           EvtType
 		recycler      recycler.Recycler
+		// sticky holds the last value of the events published with PublishSticky
+		sticky map[string]any
+		// ordered serializes the publications sharing a key, see PublishOrdered
+		ordered [orderedStripes]sync.Mutex
 	}
 )
 
@@ -57,6 +71,7 @@ func NewEventBus(cap int32, typ EvtType) *EventBus {
 	return &EventBus{
 		chanHandlers:  make(map[string][]chan any),
 		queueHandlers: make(map[string][]*cqueue.Queue[any]),
+		sticky:        make(map[string]any),
 		capacity:      cap,
 		typ:           typ,
 	}
@@ -80,6 +95,7 @@ func (eb *EventBus) SubscribeOnChannel(event string) <-chan any {
 
 	ch := make(chan any, eb.capacity)
 	eb.chanHandlers[event] = append(eb.chanHandlers[event], ch)
+	eb.replay(event, ch)
 
 	return ch
 }
@@ -91,6 +107,7 @@ func (eb *EventBus) Subscribe(event string, callback func(message any)) (cancel
 	ch := make(chan any, eb.capacity)
 	eb.mu.Lock()
 	eb.chanHandlers[event] = append(eb.chanHandlers[event], ch)
+	eb.replay(event, ch)
 	eb.mu.Unlock()
 
 	done := make(chan struct{})
@@ -116,6 +133,7 @@ func (eb *EventBus) QueueSubscribe(event string, callback func(message any)) (ca
 	eb.mu.Lock()
 	queue := cqueue.NewQueue[any](int(eb.capacity)).WithRecycler(eb.recycler)
 	eb.queueHandlers[event] = append(eb.queueHandlers[event], queue)
+	eb.replayQueue(event, queue)
 	eb.mu.Unlock()
 
 	done := make(chan struct{})
@@ -147,6 +165,7 @@ func (eb *EventBus) SubscribeOnQueue(event string) *cqueue.Queue[any] {
 
 	queue := cqueue.NewQueue[any](int(eb.capacity)).WithRecycler(eb.recycler)
 	eb.queueHandlers[event] = append(eb.queueHandlers[event], queue)
+	eb.replayQueue(event, queue)
 
 	return queue
 }
@@ -221,10 +240,16 @@ func (eb *EventBus) UnsubscribenChannel(event string, ch <-chan any) {
 }
 
 // UnsubscribeQueue removes the specified queue for the given event from the queue handlers map.
+// The queue is closed even if it is no longer subscribed, which wakes up its consumers blocked in WaitPop.
 func (eb *EventBus) UnsubscribeQueue(event string, queue *cqueue.Queue[any]) {
 	eb.mu.Lock()
 	defer eb.mu.Unlock()
 
+	defer func() {
+		queue.Clear()
+		queue.Close()
+	}()
+
 	queues, ok := eb.queueHandlers[event]
 	if !ok {
 		return
@@ -240,8 +265,6 @@ func (eb *EventBus) UnsubscribeQueue(event string, queue *cqueue.Queue[any]) {
 	if len(eb.queueHandlers[event]) == 0 {
 		delete(eb.queueHandlers, event)
 	}
-	queue.Clear()
-	queue.Close()
 }
 
 // SubscribeOnce creates a new subscription for the given event.
@@ -251,6 +274,7 @@ func (eb *EventBus) SubscribeOnce(event string, callback func(message any)) (can
 	ch := make(chan any, eb.capacity)
 	eb.mu.Lock()
 	eb.chanHandlers[event] = append(eb.chanHandlers[event], ch)
+	eb.replay(event, ch)
 	eb.mu.Unlock()
 
 	done := make(chan struct{})
@@ -277,6 +301,7 @@ func (eb *EventBus) SubscribeWithFilter(event string, filter func(data any) bool
 	ch := make(chan any, eb.capacity)
 	eb.mu.Lock()
 	eb.chanHandlers[event] = append(eb.chanHandlers[event], ch)
+	eb.replay(event, ch)
 	eb.mu.Unlock()
 
 	done := make(chan struct{})
@@ -297,21 +322,47 @@ func (eb *EventBus) SubscribeWithFilter(event string, filter func(data any) bool
 
 // PublishWithQueue sends the data to all queues subscribed to the given event.
 // If there are no queues, it does nothing.
-func (eb *EventBus) PublishWithQueue(event string, data any) {
+// The data is still pushed to the other queues when a queue rejects it, e.g. because it is full:
+// the returned error joins the failures so that the caller can retry or alert.
+func (eb *EventBus) PublishWithQueue(event string, data any) error {
 	eb.mu.RLock()
 	defer eb.mu.RUnlock()
 
+	return eb.publishQueue(event, data)
+}
+
+// publishQueue sends the data to the queues of the event, the caller holds the lock.
+func (eb *EventBus) publishQueue(event string, data any) error {
 	queues, ok := eb.queueHandlers[event]
 	if !ok {
-		return
+		return nil
 	}
 
+	var errs []error
 	for _, queue := range queues {
 		if err := queue.Push(data); err != nil {
 			xlog.Write().Sugar().Errorf("EventBus: failed to push data to queue for event %s: %v", event, err)
+			errs = append(errs, fmt.Errorf("event %s: %w", event, err))
 			continue
 		}
 	}
+	return errors.Join(errs...)
+}
+
+// PublishOrdered sends the data to all subscribers of the given event, channels and queues alike,
+// with the publications sharing the same key serialized: even with concurrent publishers,
+// every subscriber receives the messages of a key in the same order.
+// Messages dropped by full channels are skipped as with Publish, without reordering the others.
+// The queue push failures are returned as with PublishWithQueue.
+func (eb *EventBus) PublishOrdered(key string, event string, data any) error {
+	idx := cmap.HashString(key) % orderedStripes
+	mu := &eb.ordered[idx]
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	eb.Publish(event, data)
+	return eb.PublishWithQueue(event, data)
 }
 
 // Publish sends the data to all subscribers of the given event.
@@ -321,6 +372,11 @@ func (eb *EventBus) Publish(event string, data any) {
 	eb.mu.RLock()
 	defer eb.mu.RUnlock()
 
+	eb.publish(event, data)
+}
+
+// publish sends the data to the channels of the event, the caller holds the lock.
+func (eb *EventBus) publish(event string, data any) {
 	subscribers := eb.chanHandlers[event]
 	if len(subscribers) == 0 {
 		return
@@ -337,3 +393,49 @@ func (eb *EventBus) Publish(event string, data any) {
 		}
 	}
 }
+
+// PublishSticky sends the data to all subscribers of the given event, channels and queues alike,
+// and keeps it as the current value of the event: every later subscription to the event
+// receives it first, until it is replaced or cleared with ClearSticky.
+func (eb *EventBus) PublishSticky(event string, data any) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	eb.sticky[event] = data
+	eb.publish(event, data)
+	eb.publishQueue(event, data)
+}
+
+// ClearSticky forgets the current value of the event, later subscriptions receive nothing on subscribe.
+func (eb *EventBus) ClearSticky(event string) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	delete(eb.sticky, event)
+}
+
+// replay sends the sticky value of the event to a new channel, the caller holds the lock.
+func (eb *EventBus) replay(event string, ch chan any) {
+	data, ok := eb.sticky[event]
+	if !ok {
+		return
+	}
+
+	select {
+	case ch <- data:
+	default:
+		xlog.Write().Sugar().Warnf("EventBus: channel full, skipping sticky message for event %s", event)
+	}
+}
+
+// replayQueue sends the sticky value of the event to a new queue, the caller holds the lock.
+func (eb *EventBus) replayQueue(event string, queue *cqueue.Queue[any]) {
+	data, ok := eb.sticky[event]
+	if !ok {
+		return
+	}
+
+	if err := queue.Push(data); err != nil {
+		xlog.Write().Sugar().Errorf("EventBus: failed to push sticky data to queue for event %s: %v", event, err)
+	}
+}
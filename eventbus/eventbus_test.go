@@ -1,6 +1,7 @@
 package eventbus
 
 import (
+	"runtime"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -112,6 +113,63 @@ func TestQueueSubscribe(t *testing.T) {
 	}
 }
 
+func TestQueueSubscribeCancelIdle(t *testing.T) {
+	eb := NewEventBus(10, EvtXqueueType)
+	before := runtime.NumGoroutine()
+
+	cancels := []func(){
+		eb.QueueSubscribe("test-idle", nil),
+		eb.QueueSubscribe("test-idle", nil),
+	}
+	// The event is dropped before the second subscription is cancelled
+	cancelWithin(t, cancels[0])
+	eb.Unsubscribe("test-idle")
+	cancelWithin(t, cancels[1])
+
+	waitFor(t, time.Second, func() bool {
+		return runtime.NumGoroutine() <= before
+	}, "QueueSubscribe consumer goroutines leaked")
+}
+
+// cancelWithin fails the test if cancel blocks
+func cancelWithin(t *testing.T, cancel func()) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		cancel()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cancel blocked, the consumer goroutine is not woken up")
+	}
+}
+
+func TestPublishWithQueueFull(t *testing.T) {
+	eb := NewEventBus(1, EvtXqueueType)
+
+	full := eb.SubscribeOnQueue("test-full")
+	other := eb.SubscribeOnQueue("test-full")
+	if err := full.Push("pending"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := eb.PublishWithQueue("test-full", "msg"); err == nil {
+		t.Fatal("expected an error for the full queue")
+	}
+	// The other queues still get the data
+	if v, ok := other.Pop(); !ok || v != "msg" {
+		t.Fatalf("got %v, %v, want msg", v, ok)
+	}
+
+	if err := eb.PublishWithQueue("test-none", "msg"); err != nil {
+		t.Fatalf("publish without queues: %v", err)
+	}
+}
+
 func TestSubscribeOnce(t *testing.T) {
 	eb := NewEventBus(10, EvtDefaultType)
 
@@ -397,3 +455,86 @@ func TestSubscribeWithNilCallback(t *testing.T) {
 		t.Error("Cancel function blocked for too long")
 	}
 }
+
+func TestPublishOrdered(t *testing.T) {
+	eb := NewEventBus(1000, EvtDefaultType)
+
+	var mu sync.Mutex
+	received := make([][]int, 2)
+	for i := range received {
+		cancel := eb.QueueSubscribe("test-ordered", func(message any) {
+			mu.Lock()
+			received[i] = append(received[i], message.(int))
+			mu.Unlock()
+		})
+		defer cancel()
+	}
+
+	var wg sync.WaitGroup
+	for p := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range 100 {
+				eb.PublishOrdered("player_1", "test-ordered", p*100+n)
+			}
+		}()
+	}
+	wg.Wait()
+
+	waitFor(t, time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received[0]) == 400 && len(received[1]) == 400
+	}, "Expected 400 messages per subscriber")
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range received[0] {
+		if received[0][i] != received[1][i] {
+			t.Fatalf("subscribers diverge at %d: %d != %d", i, received[0][i], received[1][i])
+		}
+	}
+}
+
+func TestPublishSticky(t *testing.T) {
+	eb := NewEventBus(10, EvtDefaultType)
+
+	eb.PublishSticky("test-sticky", "lobby")
+	eb.PublishSticky("test-sticky", "playing")
+
+	ch := eb.SubscribeOnChannel("test-sticky")
+	select {
+	case msg := <-ch:
+		if msg != "playing" {
+			t.Fatalf("got %v, want the last sticky value", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("sticky value not replayed")
+	}
+
+	var received atomic.Int32
+	cancel := eb.QueueSubscribe("test-sticky", func(message any) {
+		received.Add(1)
+	})
+	defer cancel()
+	waitFor(t, time.Second, func() bool {
+		return received.Load() == 1
+	}, "Expected the sticky value on the queue")
+
+	eb.ClearSticky("test-sticky")
+	late := eb.SubscribeOnChannel("test-sticky")
+	select {
+	case msg := <-late:
+		t.Fatalf("unexpected message after ClearSticky: %v", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Normal events are not replayed
+	eb.Publish("test-normal", "msg")
+	select {
+	case msg := <-eb.SubscribeOnChannel("test-normal"):
+		t.Fatalf("unexpected replay of a normal event: %v", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
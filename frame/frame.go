@@ -2,6 +2,7 @@ package frame
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"maps"
 	"sync"
@@ -9,25 +10,67 @@ import (
 	"time"
 )
 
+const (
+	// EmptyFrameFill sends an empty message for players without input, this is the default
+	EmptyFrameFill EmptyFramePolicy = iota
+	// EmptyFrameRepeat repeats the last input of players without input (input prediction),
+	// players that never sent any input get an empty message
+	EmptyFrameRepeat
+	// EmptyFrameOmit leaves players without input out of the frame
+	EmptyFrameOmit
+)
+
 type (
+	// EmptyFramePolicy defines how a frame is built for players that sent no input for it.
+	EmptyFramePolicy uint8
+
+	// frameState is the portable bookkeeping of a frame loop, see FrameLoop.Snapshot.
+	frameState struct {
+		FrameID uint64               `json:"frame_id"`
+		Players map[string]uint      `json:"players"`
+		Queue   map[string][]Message `json:"queue"`
+		Last    map[string]Message   `json:"last,omitempty"`
+	}
+
 	FrameConf struct {
 		Frequency uint // Frequency of game logic frame processing (in Hz)
+		// EmptyFrame is the policy for players without input in a frame
+		EmptyFrame EmptyFramePolicy
+		// ChecksumInterval computes the checksum every N frames when the processor implements
+		// ChecksumProcessor and a handler is set with WithChecksum. Zero means every frame.
+		ChecksumInterval uint64
 	}
 	FrameLoop struct {
-		conf   FrameConf
-		mu     sync.RWMutex
-		proc   FrameProcessor
-		adjust chan struct{} // Channel for adjusting the frequency dynamically
+		conf    FrameConf
+		mu      sync.RWMutex
+		proc    FrameProcessor
+		adjust  chan struct{} // Channel for adjusting the frequency dynamically
+		metrics Metrics
+		// overrun detection
+		overruns  atomic.Uint64
+		onOverrun OverrunHandler
+		// desync detection
+		onChecksum ChecksumHandler
+		onTickEnd  TickHandler
+		// validate rejects invalid inputs in Write
+		validate InputValidator
+		// idle detection, idle is the time of the last input or of the last onEmpty call
+		onEmpty EmptyProcessor
+		idle    time.Time
 
 		frameId uint64 // Current frame ID
 
 		// Input queue for each player
 		queue map[string][]Message
 		ids   map[string]uint // Last processed frame ID for each player
-		done  chan struct{}
-		flag  atomic.Uint32
-		once  sync.Once
-		wg    sync.WaitGroup
+		// Last input of each player, only kept with EmptyFrameRepeat
+		last map[string]Message
+		done chan struct{}
+		flag atomic.Uint32
+		once sync.Once
+		wg   sync.WaitGroup
+		// held by a shared ticker while processing a frame, see NewManagerShared
+		stepMu sync.Mutex
 	}
 )
 
@@ -35,12 +78,82 @@ func NewFrameLoop(conf FrameConf) *FrameLoop {
 	defaultFrameConf(&conf)
 
 	return &FrameLoop{
-		conf:   conf,
-		adjust: make(chan struct{}, 1), // Add buffer to avoid blocking
-		queue:  make(map[string][]Message),
-		ids:    make(map[string]uint),
-		done:   make(chan struct{}),
+		conf:    conf,
+		adjust:  make(chan struct{}, 1), // Add buffer to avoid blocking
+		metrics: &NoopMetrics{},
+		queue:   make(map[string][]Message),
+		ids:     make(map[string]uint),
+		last:    make(map[string]Message),
+		done:    make(chan struct{}),
+	}
+}
+
+// WithMetrics sets the metrics for the frame loop.
+// The tick processing duration and the dropped inputs are reported to it.
+func (f *FrameLoop) WithMetrics(m Metrics) *FrameLoop {
+	f.mu.Lock()
+	f.metrics = m
+	f.mu.Unlock()
+
+	return f
+}
+
+// WithOverrunHandler sets the function called when processing a frame takes longer than the frame interval.
+func (f *FrameLoop) WithOverrunHandler(fn OverrunHandler) *FrameLoop {
+	f.mu.Lock()
+	f.onOverrun = fn
+	f.mu.Unlock()
+
+	return f
+}
+
+// WithChecksum sets the function receiving the game state checksum every ChecksumInterval frames.
+// It is only called if the frame processor implements ChecksumProcessor.
+func (f *FrameLoop) WithChecksum(fn ChecksumHandler) *FrameLoop {
+	f.mu.Lock()
+	f.onChecksum = fn
+	f.mu.Unlock()
+
+	return f
+}
+
+// WithTickEnd sets the function called after every processed frame.
+func (f *FrameLoop) WithTickEnd(fn TickHandler) *FrameLoop {
+	f.mu.Lock()
+	f.onTickEnd = fn
+	f.mu.Unlock()
+
+	return f
+}
+
+// WithInputValidator sets the function checking the inputs before they are queued.
+// Rejected inputs are reported to the metrics as DropInvalid.
+func (f *FrameLoop) WithInputValidator(fn InputValidator) *FrameLoop {
+	f.mu.Lock()
+	f.validate = fn
+	f.mu.Unlock()
+
+	return f
+}
+
+// WithEmptyHandler sets the function called when no input was written to the loop for e.Frequency,
+// e.g. to close abandoned rooms. The idle time starts when the handler is set.
+func (f *FrameLoop) WithEmptyHandler(e EmptyProcessor) *FrameLoop {
+	if e.Frequency <= 0 {
+		e.Frequency = time.Second
 	}
+
+	f.mu.Lock()
+	f.onEmpty = e
+	f.idle = time.Now()
+	f.mu.Unlock()
+
+	return f
+}
+
+// OverrunCount returns the number of frames whose processing took longer than the frame interval.
+func (f *FrameLoop) OverrunCount() uint64 {
+	return f.overruns.Load()
 }
 
 // Frequency implements [LoopFace].
@@ -133,10 +246,53 @@ func (f *FrameLoop) Reset(id uint64) {
 	}
 
 	f.queue = make(map[string][]Message)
+	f.last = make(map[string]Message)
 
 	f.mu.Unlock()
 }
 
+// Snapshot serializes the loop bookkeeping: the current frame ID, the registered players with their
+// last processed frame IDs and the pending inputs. A loop on another node can resume from it with Restore.
+// The state of the frame processor is not included.
+func (f *FrameLoop) Snapshot() ([]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return json.Marshal(frameState{
+		FrameID: f.frameId,
+		Players: f.ids,
+		Queue:   f.queue,
+		Last:    f.last,
+	})
+}
+
+// Restore replaces the loop bookkeeping with a snapshot taken by Snapshot.
+func (f *FrameLoop) Restore(data []byte) error {
+	var state frameState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	if state.Players == nil {
+		state.Players = make(map[string]uint)
+	}
+	if state.Queue == nil {
+		state.Queue = make(map[string][]Message)
+	}
+	if state.Last == nil {
+		state.Last = make(map[string]Message)
+	}
+
+	f.mu.Lock()
+	f.frameId = state.FrameID
+	f.ids = state.Players
+	f.queue = state.Queue
+	f.last = state.Last
+	f.mu.Unlock()
+
+	return nil
+}
+
 // exec processes the current frame using the frame processor.
 func (f *FrameLoop) exec() {
 	f.mu.Lock()
@@ -155,30 +311,107 @@ func (f *FrameLoop) exec() {
 			frame.Inputs[playerId] = input
 			// Update the last processed frame ID for the player
 			f.ids[playerId] = uint(input[len(input)-1].FrameID)
+			if f.conf.EmptyFrame == EmptyFrameRepeat {
+				f.last[playerId] = input[len(input)-1]
+			}
 			continue
 		}
-		// If no input from the player, create an empty message
-		emptyMessage := []Message{
-			{
-				PlayerID:  playerId,
-				FrameID:   f.frameId,
-				Timestamp: time.Now(),
-			},
+
+		if empty, ok := f.empty(playerId); ok {
+			frame.Inputs[playerId] = []Message{empty}
 		}
-		frame.Inputs[playerId] = emptyMessage
 	}
 
 	// Clear the frame queue for the next frame
 	f.queue = make(map[string][]Message)
 
 	proc := f.proc
+	m := f.metrics
+	onOverrun := f.onOverrun
+	onChecksum := f.onChecksum
+	onTickEnd := f.onTickEnd
+	period := time.Second / time.Duration(f.conf.Frequency)
+	onEmpty := f.idleHandler()
 	f.mu.Unlock()
 
 	if proc != nil {
+		start_t := time.Now()
 		proc.Process(frame)
+		took := time.Since(start_t)
+		m.ObserveTick(took)
+
+		// The loop falls behind when a frame takes longer than the frame interval
+		if took > period {
+			f.overruns.Add(1)
+			if onOverrun != nil {
+				onOverrun(frame.FrameID, took)
+			}
+		}
+
+		f.checksum(proc, frame.FrameID, onChecksum)
+		if onTickEnd != nil {
+			onTickEnd(frame.FrameID)
+		}
+	}
+
+	if onEmpty != nil {
+		onEmpty()
 	}
 }
 
+// idleHandler returns the empty handler if the loop has been idle for its frequency, the lock must be held.
+func (f *FrameLoop) idleHandler() func() {
+	if f.onEmpty.Handler == nil {
+		return nil
+	}
+
+	now := time.Now()
+	if now.Sub(f.idle) < f.onEmpty.Frequency {
+		return nil
+	}
+
+	f.idle = now
+	return f.onEmpty.Handler
+}
+
+// checksum reports the game state checksum of the frame if it is due.
+func (f *FrameLoop) checksum(proc FrameProcessor, frameID uint64, fn ChecksumHandler) {
+	if fn == nil {
+		return
+	}
+	cp, ok := proc.(ChecksumProcessor)
+	if !ok {
+		return
+	}
+	if n := f.conf.ChecksumInterval; n > 1 && frameID%n != 0 {
+		return
+	}
+
+	fn(frameID, cp.Checksum(frameID))
+}
+
+// empty returns the message used for a player without input according to the empty frame policy.
+// It returns false if the player must be left out of the frame.
+func (f *FrameLoop) empty(playerId string) (Message, bool) {
+	switch f.conf.EmptyFrame {
+	case EmptyFrameOmit:
+		return Message{}, false
+	case EmptyFrameRepeat:
+		if last, ok := f.last[playerId]; ok {
+			last.FrameID = f.frameId
+			last.Timestamp = time.Now()
+			return last, true
+		}
+	}
+
+	// If no input from the player, create an empty message
+	return Message{
+		PlayerID:  playerId,
+		FrameID:   f.frameId,
+		Timestamp: time.Now(),
+	}, true
+}
+
 // Stop implements [LoopFace].
 func (f *FrameLoop) Stop() {
 	f.once.Do(func() {
@@ -186,6 +419,8 @@ func (f *FrameLoop) Stop() {
 
 		// Wait for the loop to finish processing before stopping
 		f.wg.Wait()
+		f.stepMu.Lock()
+		f.stepMu.Unlock()
 
 		f.stop()
 	})
@@ -209,6 +444,54 @@ func (f *FrameLoop) stop() {
 	proc.OnClose()
 }
 
+// attach implements [sharedLoop].
+func (f *FrameLoop) attach() error {
+	if !f.flag.CompareAndSwap(0, flagStarted) {
+		return errors.New("loop already started")
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.proc == nil {
+		f.flag.Store(0)
+		return errors.New("processor is not set")
+	}
+
+	return nil
+}
+
+// detach implements [sharedLoop].
+func (f *FrameLoop) detach() {
+	f.flag.Store(0)
+}
+
+// interval implements [sharedLoop].
+func (f *FrameLoop) interval() time.Duration {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return time.Second / time.Duration(f.conf.Frequency)
+}
+
+// step implements [sharedLoop].
+func (f *FrameLoop) step() bool {
+	f.stepMu.Lock()
+	defer f.stepMu.Unlock()
+
+	select {
+	case <-f.done:
+		return false
+	default:
+	}
+
+	if f.flag.Load() != flagPaused {
+		f.exec()
+	}
+
+	return true
+}
+
 // Pause implements [FrameFace].
 func (f *FrameLoop) Pause() bool {
 	return f.flag.CompareAndSwap(flagStarted, flagPaused)
@@ -260,37 +543,55 @@ func (f *FrameLoop) DeletePlayer(playerId string) {
 
 	delete(f.ids, playerId)
 	delete(f.queue, playerId)
+	delete(f.last, playerId)
 }
 
 // Write implements [LoopFace].
 func (f *FrameLoop) Write(in Message) error {
+	// The validator runs without the lock, it must not slow down the other writers
+	f.mu.RLock()
+	validate, m := f.validate, f.metrics
+	f.mu.RUnlock()
+
+	if validate != nil {
+		if err := validate(in); err != nil {
+			m.IncDropped(DropInvalid)
+			return err
+		}
+	}
+
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
 	select {
 	case <-f.done:
+		f.metrics.IncDropped(DropClosed)
 		return errors.New("loop is closed")
 	default:
 	}
 
 	// Check if player is registered
 	if _, exists := f.ids[in.PlayerID]; !exists {
+		f.metrics.IncDropped(DropUnregistered)
 		return errors.New("player not registered")
 	}
 
 	// Check for stale messages
 	if existing, ok := f.queue[in.PlayerID]; ok && len(existing) > 0 {
 		if existing[len(existing)-1].FrameID >= in.FrameID {
+			f.metrics.IncDropped(DropStale)
 			return errors.New("stale or duplicate message")
 		}
 	}
 
 	// Only accept messages for current or future frames
 	if in.FrameID <= f.frameId {
+		f.metrics.IncDropped(DropPast)
 		return errors.New("message for past frame")
 	}
 
 	f.queue[in.PlayerID] = append(f.queue[in.PlayerID], in)
+	f.idle = time.Now()
 
 	return nil
 }
@@ -301,4 +602,7 @@ func defaultFrameConf(conf *FrameConf) {
 	}
 }
 
-var _ FrameFace = (*FrameLoop)(nil)
+var (
+	_ FrameFace  = (*FrameLoop)(nil)
+	_ sharedLoop = (*FrameLoop)(nil)
+)
@@ -0,0 +1,184 @@
+package frame
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFrameLoopSnapshot(t *testing.T) {
+	src := NewFrameLoop(FrameConf{})
+	src.RegisterPlayer("player_1")
+	src.RegisterPlayer("player_2")
+	src.Reset(41)
+	src.exec()
+
+	if err := src.Write(Message{PlayerID: "player_1", FrameID: 43, Data: []byte("move")}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := src.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := NewFrameLoop(FrameConf{})
+	if err := dst.Restore(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if dst.FrameId() != src.FrameId() {
+		t.Fatalf("frame id = %d, want %d", dst.FrameId(), src.FrameId())
+	}
+	if !maps.Equal(dst.PlayerIds(), src.PlayerIds()) {
+		t.Fatalf("players = %v, want %v", dst.PlayerIds(), src.PlayerIds())
+	}
+
+	// The pending input must survive and be delivered by the restored loop
+	dst.exec()
+	dst.exec()
+	if ids := dst.PlayerIds(); ids["player_1"] != 43 {
+		t.Fatalf("player_1 last frame = %d, want 43", ids["player_1"])
+	}
+}
+
+// sumProc hashes the number of inputs processed so far
+type sumProc struct {
+	inputs uint64
+}
+
+func (p *sumProc) OnClose()                            {}
+func (p *sumProc) Resend(playerId string, frameId int) {}
+func (p *sumProc) Process(frame Frame) {
+	for _, in := range frame.Inputs {
+		p.inputs += uint64(len(in))
+	}
+}
+func (p *sumProc) Checksum(frameID uint64) uint64 { return p.inputs }
+
+func TestFrameLoopChecksum(t *testing.T) {
+	sums := make(map[uint64]uint64)
+	loop := NewFrameLoop(FrameConf{ChecksumInterval: 2}).
+		WithProc(&sumProc{}).
+		WithChecksum(func(frameID, sum uint64) {
+			sums[frameID] = sum
+		})
+	loop.RegisterPlayer("player_1")
+	loop.RegisterPlayer("player_2")
+
+	for range 4 {
+		loop.exec()
+	}
+
+	want := map[uint64]uint64{2: 4, 4: 8}
+	if !maps.Equal(sums, want) {
+		t.Fatalf("checksums = %v, want %v", sums, want)
+	}
+}
+
+// dropMetrics records the dropped inputs by reason
+type dropMetrics struct {
+	NoopMetrics
+	dropped map[string]int
+}
+
+func (m *dropMetrics) IncDropped(reason string) { m.dropped[reason]++ }
+
+func TestFrameLoopInputValidator(t *testing.T) {
+	errTooLarge := errors.New("payload too large")
+	m := &dropMetrics{dropped: make(map[string]int)}
+	loop := NewFrameLoop(FrameConf{}).WithMetrics(m).WithInputValidator(func(in Message) error {
+		if len(in.Data) > 4 {
+			return errTooLarge
+		}
+		return nil
+	})
+	loop.RegisterPlayer("player_1")
+
+	if err := loop.Write(Message{PlayerID: "player_1", FrameID: 1, Data: []byte("teleport")}); err != errTooLarge {
+		t.Fatalf("got %v, want %v", err, errTooLarge)
+	}
+	if err := loop.Write(Message{PlayerID: "player_1", FrameID: 1, Data: []byte("move")}); err != nil {
+		t.Fatal(err)
+	}
+	if m.dropped[DropInvalid] != 1 {
+		t.Fatalf("invalid inputs = %d, want 1", m.dropped[DropInvalid])
+	}
+}
+
+// orderProc records the players of the processed messages
+type orderProc struct {
+	players []string
+}
+
+func (p *orderProc) OnClose()                            {}
+func (p *orderProc) Resend(playerId string, frameId int) {}
+func (p *orderProc) Process(msg Message)                 { p.players = append(p.players, msg.PlayerID) }
+
+func TestNormalPriority(t *testing.T) {
+	proc := &orderProc{}
+	loop := NewNormal(NormalConf{QueueCap: 4, Priority: true}).WithProc(proc)
+
+	writes := []struct {
+		player   string
+		priority int
+	}{
+		{"move_1", 0},
+		{"admin", 10},
+		{"move_2", 0},
+		{"disconnect", 5},
+	}
+	for _, w := range writes {
+		if err := loop.WriteWithPriority(Message{PlayerID: w.player}, w.priority); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := loop.Write(Message{PlayerID: "overflow"}); err == nil {
+		t.Fatal("write to a full queue must fail")
+	}
+
+	// Stop drains the queue
+	loop.Stop()
+
+	want := []string{"admin", "disconnect", "move_1", "move_2"}
+	if !slices.Equal(proc.players, want) {
+		t.Fatalf("got %v, want %v", proc.players, want)
+	}
+
+	if err := NewNormal(NormalConf{}).WriteWithPriority(Message{}, 1); err == nil {
+		t.Fatal("priority write without NormalConf.Priority must fail")
+	}
+}
+
+func TestFrameLoopEmptyHandler(t *testing.T) {
+	var idle int
+	loop := NewFrameLoop(FrameConf{}).WithProc(&sumProc{}).WithEmptyHandler(EmptyProcessor{
+		Handler:   func() { idle++ },
+		Frequency: 20 * time.Millisecond,
+	})
+	loop.RegisterPlayer("player_1")
+
+	loop.exec()
+	if idle != 0 {
+		t.Fatalf("idle calls = %d, want 0 before the frequency elapsed", idle)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	loop.exec()
+	loop.exec()
+	if idle != 1 {
+		t.Fatalf("idle calls = %d, want 1", idle)
+	}
+
+	// An input restarts the idle time
+	time.Sleep(30 * time.Millisecond)
+	if err := loop.Write(Message{PlayerID: "player_1", FrameID: loop.FrameId() + 1}); err != nil {
+		t.Fatal(err)
+	}
+	loop.exec()
+	if idle != 1 {
+		t.Fatalf("idle calls = %d, want 1 after an input", idle)
+	}
+}
@@ -16,6 +16,27 @@ const (
 )
 
 type (
+	// OverrunHandler is called when processing a tick takes longer than the tick interval.
+	// For a normal loop, frameID is the sequence number of the tick.
+	OverrunHandler func(frameID uint64, took time.Duration)
+	// ChecksumHandler receives the game state checksum of a frame, see ChecksumProcessor.
+	ChecksumHandler func(frameID uint64, sum uint64)
+	// TickHandler is called after a frame has been processed, e.g. to flush the messages
+	// buffered for the players during the frame with network.Agent.Flush.
+	TickHandler func(frameID uint64)
+	// InputValidator checks an input before it enters the loop, e.g. out of range moves or oversized payloads.
+	// A non nil error rejects the input and is returned to the writer.
+	InputValidator func(in Message) error
+	// EmptyProcessor is called when a frame loop received no input for Frequency.
+	// The idle time is wall clock time, it doesn't depend on the tick rate of the loop,
+	// but it is checked on every tick so the handler can be late by up to one tick interval.
+	EmptyProcessor struct {
+		Handler func()
+		// Frequency is the idle time after which Handler is called, and then again
+		// every Frequency while the loop stays idle. Zero defaults to one second.
+		Frequency time.Duration
+	}
+
 	// LoopFace defines the interface for a game loop.
 	LoopFace interface {
 		// Start starts the loop in a separate goroutine.
@@ -47,10 +68,30 @@ type (
 		DeletePlayer(string)
 	}
 
+	// sharedLoop is implemented by the loops that can be driven by the shared tickers of a LoopManager
+	// instead of their own goroutine, see NewManagerShared.
+	sharedLoop interface {
+		LoopFace
+		// attach marks the loop as started, it fails like Start if the loop cannot run.
+		attach() error
+		// detach marks the loop as no longer started.
+		detach()
+		// interval returns the tick interval of the loop for its current frequency.
+		interval() time.Duration
+		// step processes one tick, it returns false once the loop is stopped.
+		step() bool
+	}
+
 	// NormalFace defines the interface for a normal loop, which processes normal messages.
 	NormalFace interface {
 		LoopFace
 		// WriteTimeout writes a message to the loop's input queue with a timeout.
 		WriteTimeout(Message, time.Duration) error
 	}
+
+	// PriorityWriter is implemented by the loops able to process some messages ahead of the others.
+	PriorityWriter interface {
+		// WriteWithPriority writes a message to the loop's input queue, higher priorities are processed first.
+		WriteWithPriority(Message, int) error
+	}
 )
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/czx-lab/czx/container/cmap"
 	"github.com/czx-lab/czx/container/recycler"
@@ -15,6 +16,10 @@ type LoopManager struct {
 	wg    sync.WaitGroup
 	loops *cmap.CMap[string, LoopFace]
 	ctx   context.Context
+	// shared tickers by tick interval, nil unless created with NewManagerShared
+	mu     sync.Mutex
+	groups map[time.Duration]*tickGroup
+	cancel context.CancelFunc
 }
 
 func NewManager(r recycler.Recycler, ctx context.Context) *LoopManager {
@@ -25,13 +30,37 @@ func NewManager(r recycler.Recycler, ctx context.Context) *LoopManager {
 	}
 }
 
+// NewManagerShared creates a manager driving its loops from shared tickers instead of
+// one goroutine and ticker per loop: all the loops with the same frequency are processed
+// one after the other by a single goroutine. It cuts the goroutine and timer count for
+// thousands of rooms, as long as the processing of all the loops of a frequency fits in
+// one tick. Loops other than FrameLoop and Normal still run their own goroutine.
+func NewManagerShared(r recycler.Recycler, ctx context.Context) *LoopManager {
+	lm := NewManager(r, ctx)
+	lm.ctx, lm.cancel = context.WithCancel(ctx)
+	lm.groups = make(map[time.Duration]*tickGroup)
+
+	return lm
+}
+
 // Add adds a new loop to the manager.
-// It starts the loop in a separate goroutine.
+// It starts the loop in a separate goroutine, or attaches it to the shared ticker of
+// its frequency with NewManagerShared.
 func (lm *LoopManager) Add(id string, loop LoopFace) error {
 	if lm.loops.Has(id) {
 		return ErrLoopExists
 	}
 
+	if sl, ok := loop.(sharedLoop); ok && lm.groups != nil {
+		if err := sl.attach(); err != nil {
+			return err
+		}
+
+		lm.loops.Set(id, loop)
+		lm.join(sl)
+		return nil
+	}
+
 	lm.loops.Set(id, loop)
 
 	lm.wg.Add(1)
@@ -45,6 +74,29 @@ func (lm *LoopManager) Add(id string, loop LoopFace) error {
 	return nil
 }
 
+// join adds the loop to the shared ticker of its frequency, the ticker is started on first use.
+func (lm *LoopManager) join(l sharedLoop) {
+	interval := l.interval()
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	g, ok := lm.groups[interval]
+	if !ok {
+		g = newTickGroup(interval)
+		lm.groups[interval] = g
+
+		lm.wg.Add(1)
+		go func() {
+			defer lm.wg.Done()
+
+			g.run(lm.ctx, lm.join)
+		}()
+	}
+
+	g.add(l)
+}
+
 // Remove removes a loop from the manager by its ID.
 // It stops the loop and waits for it to finish processing before removing it.
 func (lm *LoopManager) Remove(id string) {
@@ -117,6 +169,10 @@ func (lm *LoopManager) Stop() {
 
 	// Clear the loops map
 	lm.loops.Clear()
+	// Stop the shared tickers
+	if lm.cancel != nil {
+		lm.cancel()
+	}
 	// Wait for all loops to finish
 	lm.wg.Wait()
 }
@@ -0,0 +1,88 @@
+package frame
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countProc counts the processed frames
+type countProc struct {
+	frames atomic.Uint64
+}
+
+func (p *countProc) OnClose()                            {}
+func (p *countProc) Resend(playerId string, frameId int) {}
+func (p *countProc) Process(frame Frame)                 { p.frames.Add(1) }
+
+func TestManagerShared(t *testing.T) {
+	lm := NewManagerShared(nil, context.Background())
+	defer lm.Stop()
+
+	procs := make([]*countProc, 3)
+	for i := range procs {
+		procs[i] = &countProc{}
+		conf := FrameConf{Frequency: 100}
+		if i == 2 {
+			conf.Frequency = 50
+		}
+		if err := lm.Add(fmt.Sprint(i), NewFrameLoop(conf).WithProc(procs[i])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lm.Add("noproc", NewFrameLoop(FrameConf{})); err == nil {
+		t.Fatal("loop without processor must be rejected")
+	}
+
+	lm.mu.Lock()
+	groups := len(lm.groups)
+	lm.mu.Unlock()
+	if groups != 2 {
+		t.Fatalf("groups = %d, want 2", groups)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	for i, p := range procs {
+		if p.frames.Load() == 0 {
+			t.Fatalf("loop %d was not ticked", i)
+		}
+	}
+
+	// A removed loop must not be ticked anymore
+	lm.Remove("0")
+	frames := procs[0].frames.Load()
+	time.Sleep(50 * time.Millisecond)
+	if n := procs[0].frames.Load(); n != frames {
+		t.Fatalf("removed loop ticked %d more frames", n-frames)
+	}
+}
+
+// BenchmarkManagerGoroutines reports the goroutines used to run 5k rooms.
+func BenchmarkManagerGoroutines(b *testing.B) {
+	const rooms = 5000
+
+	managers := map[string]func() *LoopManager{
+		"own":    func() *LoopManager { return NewManager(nil, context.Background()) },
+		"shared": func() *LoopManager { return NewManagerShared(nil, context.Background()) },
+	}
+	for name, newManager := range managers {
+		b.Run(name, func(b *testing.B) {
+			for b.Loop() {
+				base := runtime.NumGoroutine()
+
+				lm := newManager()
+				for i := range rooms {
+					lm.Add(fmt.Sprint(i), NewFrameLoop(FrameConf{}).WithProc(&countProc{}))
+				}
+				// Let the loop goroutines start
+				time.Sleep(50 * time.Millisecond)
+				b.ReportMetric(float64(runtime.NumGoroutine()-base), "goroutines")
+
+				lm.Stop()
+			}
+		})
+	}
+}
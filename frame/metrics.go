@@ -0,0 +1,37 @@
+package frame
+
+import "time"
+
+const (
+	// Reasons for dropped inputs reported to the metrics
+	DropClosed       = "closed"
+	DropFull         = "full"
+	DropUnregistered = "unregistered"
+	DropStale        = "stale"
+	DropPast         = "past"
+	DropInvalid      = "invalid"
+)
+
+// Metrics defines the interface for loop metrics tracking.
+type Metrics interface {
+	// Observe the processing duration of a single tick
+	ObserveTick(duration time.Duration)
+	// Increment the count of dropped inputs by reason
+	IncDropped(reason string)
+
+	// Shutdown the metrics tracking system
+	Close() error
+}
+
+type NoopMetrics struct{}
+
+// Close implements Metrics.
+func (n *NoopMetrics) Close() error { return nil }
+
+// IncDropped implements Metrics.
+func (n *NoopMetrics) IncDropped(reason string) {}
+
+// ObserveTick implements Metrics.
+func (n *NoopMetrics) ObserveTick(duration time.Duration) {}
+
+var _ Metrics = (*NoopMetrics)(nil)
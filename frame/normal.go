@@ -6,6 +6,8 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/czx-lab/czx/container/cqueue"
 )
 
 type (
@@ -14,31 +16,69 @@ type (
 		QueueCap  int
 		Frequency uint // Frequency of processing normal messages (in Hz)
 		BatchSize int  // Number of messages to process in each batch
+		// Priority queues the messages by priority instead of arrival order, see WriteWithPriority.
+		// WriteTimeout does not wait for room in a priority queue.
+		Priority bool
 	}
 	// Normal is a loop type that processes normal messages from the input queue.
 	// It is suitable for scenarios where the processing of messages is not time-sensitive and can be handled in a regular loop.
 	Normal struct {
-		mu     sync.RWMutex
-		conf   NormalConf
-		adjust chan struct{} // Channel for adjusting the frequency dynamically
-		queue  chan Message
-		proc   NormalProcessor
-		done   chan struct{}
-		once   sync.Once
-		flag   atomic.Uint32
-		wg     sync.WaitGroup
+		mu      sync.RWMutex
+		conf    NormalConf
+		adjust  chan struct{} // Channel for adjusting the frequency dynamically
+		queue   chan Message
+		pqueue  *cqueue.PriorityQueue[Message] // set when NormalConf.Priority is enabled
+		proc    NormalProcessor
+		metrics Metrics
+		// overrun detection
+		ticks     uint64
+		overruns  atomic.Uint64
+		onOverrun OverrunHandler
+		validate  InputValidator
+		done      chan struct{}
+		once      sync.Once
+		flag      atomic.Uint32
+		wg        sync.WaitGroup
+		// held by a shared ticker while processing a batch, see NewManagerShared
+		stepMu sync.Mutex
 	}
 )
 
 func NewNormal(conf NormalConf) *Normal {
 	defaultNormalConf(&conf)
 
-	return &Normal{
-		conf:   conf,
-		queue:  make(chan Message, conf.QueueCap),
-		adjust: make(chan struct{}, 1), // Add buffer to avoid blocking
-		done:   make(chan struct{}),
+	n := &Normal{
+		conf:    conf,
+		queue:   make(chan Message, conf.QueueCap),
+		adjust:  make(chan struct{}, 1), // Add buffer to avoid blocking
+		metrics: &NoopMetrics{},
+		done:    make(chan struct{}),
+	}
+	if conf.Priority {
+		n.pqueue = cqueue.NewPriorityQueue[Message](conf.QueueCap)
 	}
+
+	return n
+}
+
+// WithMetrics sets the metrics for the normal loop.
+// The tick processing duration and the dropped messages are reported to it.
+func (n *Normal) WithMetrics(m Metrics) *Normal {
+	n.mu.Lock()
+	n.metrics = m
+	n.mu.Unlock()
+
+	return n
+}
+
+// WithInputValidator sets the function checking the messages before they are queued.
+// Rejected messages are reported to the metrics as DropInvalid.
+func (n *Normal) WithInputValidator(fn InputValidator) *Normal {
+	n.mu.Lock()
+	n.validate = fn
+	n.mu.Unlock()
+
+	return n
 }
 
 // WithProc sets the normal processor for the normal loop.
@@ -50,6 +90,20 @@ func (n *Normal) WithProc(proc NormalProcessor) *Normal {
 	return n
 }
 
+// WithOverrunHandler sets the function called when processing a batch takes longer than the tick interval.
+func (n *Normal) WithOverrunHandler(fn OverrunHandler) *Normal {
+	n.mu.Lock()
+	n.onOverrun = fn
+	n.mu.Unlock()
+
+	return n
+}
+
+// OverrunCount returns the number of ticks whose processing took longer than the tick interval.
+func (n *Normal) OverrunCount() uint64 {
+	return n.overruns.Load()
+}
+
 // Start implements [LoopFace].
 func (n *Normal) Start(ctx context.Context) error {
 	if !n.flag.CompareAndSwap(0, flagStarted) {
@@ -104,29 +158,68 @@ func (n *Normal) exec() {
 	n.mu.RLock()
 	batchSize := n.conf.BatchSize
 	proc := n.proc
+	m := n.metrics
+	onOverrun := n.onOverrun
+	period := time.Second / time.Duration(n.conf.Frequency)
 	n.mu.RUnlock()
 
+	// exec is only called from the loop goroutine
+	n.ticks++
+	tick := n.ticks
+
+	start_t := time.Now()
+	defer func() {
+		if processed == 0 {
+			return
+		}
+
+		took := time.Since(start_t)
+		m.ObserveTick(took)
+
+		// The loop falls behind when a batch takes longer than the tick interval
+		if took > period {
+			n.overruns.Add(1)
+			if onOverrun != nil {
+				onOverrun(tick, took)
+			}
+		}
+	}()
+
 	for {
 		// If we've processed enough messages for this batch, break out of the loop
 		if batchSize > 0 && processed >= batchSize {
 			return
 		}
 
-		select {
-		case <-n.done:
-			return
-		case data, ok := <-n.queue:
-			if !ok {
-				return
-			}
-
-			// Process the message
-			proc.Process(data)
-			processed++
-		default:
+		data, ok := n.next()
+		if !ok {
 			// No more messages to process, break out of the loop
 			return
 		}
+
+		// Process the message
+		proc.Process(data)
+		processed++
+	}
+}
+
+// next returns the next queued message, false if there is none or the loop is stopped.
+func (n *Normal) next() (Message, bool) {
+	select {
+	case <-n.done:
+		return Message{}, false
+	default:
+	}
+
+	if n.pqueue != nil {
+		return n.pqueue.Pop()
+	}
+
+	select {
+	case data, ok := <-n.queue:
+		return data, ok
+	default:
+		return Message{}, false
 	}
 }
 
@@ -135,7 +228,12 @@ func (n *Normal) Stop() {
 	n.once.Do(func() {
 		close(n.done)
 		n.wg.Wait()
+		n.stepMu.Lock()
+		n.stepMu.Unlock()
 		close(n.queue)
+		if n.pqueue != nil {
+			n.pqueue.Close()
+		}
 
 		n.mu.RLock()
 		proc := n.proc
@@ -149,11 +247,64 @@ func (n *Normal) Stop() {
 		for data := range n.queue {
 			proc.Process(data)
 		}
+		if n.pqueue != nil {
+			for data, ok := n.pqueue.Pop(); ok; data, ok = n.pqueue.Pop() {
+				proc.Process(data)
+			}
+		}
 
 		proc.OnClose()
 	})
 }
 
+// attach implements [sharedLoop].
+func (n *Normal) attach() error {
+	if !n.flag.CompareAndSwap(0, flagStarted) {
+		return errors.New("loop already started")
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.proc == nil {
+		n.flag.Store(0)
+		return errors.New("processor is not set")
+	}
+
+	return nil
+}
+
+// detach implements [sharedLoop].
+func (n *Normal) detach() {
+	n.flag.Store(0)
+}
+
+// interval implements [sharedLoop].
+func (n *Normal) interval() time.Duration {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return time.Second / time.Duration(n.conf.Frequency)
+}
+
+// step implements [sharedLoop].
+func (n *Normal) step() bool {
+	n.stepMu.Lock()
+	defer n.stepMu.Unlock()
+
+	select {
+	case <-n.done:
+		return false
+	default:
+	}
+
+	if n.flag.Load() != flagPaused {
+		n.exec()
+	}
+
+	return true
+}
+
 // Pause implements [NormalFace].
 func (n *Normal) Pause() bool {
 	return n.flag.CompareAndSwap(flagStarted, flagPaused)
@@ -165,19 +316,88 @@ func (n *Normal) Resume() bool {
 }
 
 // Write implements [LoopFace].
+// With NormalConf.Priority enabled, the message is written with priority 0.
 func (n *Normal) Write(msg Message) error {
+	if n.pqueue != nil {
+		return n.WriteWithPriority(msg, 0)
+	}
+
+	if err := n.check(msg); err != nil {
+		return err
+	}
+
 	select {
 	case <-n.done:
+		n.dropped(DropClosed)
 		return errors.New("loop is closed")
 	case n.queue <- msg:
 		return nil
 	default:
+		n.dropped(DropFull)
+		return errors.New("queue is full")
+	}
+}
+
+// WriteWithPriority implements [PriorityWriter].
+// Messages with a higher priority are processed first, messages of equal priority in arrival order.
+func (n *Normal) WriteWithPriority(msg Message, priority int) error {
+	if n.pqueue == nil {
+		return errors.New("priority is not enabled")
+	}
+
+	if err := n.check(msg); err != nil {
+		return err
+	}
+
+	select {
+	case <-n.done:
+		n.dropped(DropClosed)
+		return errors.New("loop is closed")
+	default:
+	}
+
+	// The queue pops the lowest value first
+	if !n.pqueue.Push(cqueue.PriorityItem[Message]{Value: msg, Priority: -priority}) {
+		n.dropped(DropFull)
 		return errors.New("queue is full")
 	}
+	return nil
+}
+
+// check runs the input validator, if any.
+func (n *Normal) check(msg Message) error {
+	n.mu.RLock()
+	validate := n.validate
+	n.mu.RUnlock()
+
+	if validate == nil {
+		return nil
+	}
+	if err := validate(msg); err != nil {
+		n.dropped(DropInvalid)
+		return err
+	}
+	return nil
+}
+
+func (n *Normal) dropped(reason string) {
+	n.mu.RLock()
+	m := n.metrics
+	n.mu.RUnlock()
+
+	m.IncDropped(reason)
 }
 
 // WriteTimeout implements [LoopFace].
 func (n *Normal) WriteTimeout(in Message, timeout time.Duration) error {
+	if n.pqueue != nil {
+		return n.WriteWithPriority(in, 0)
+	}
+
+	if err := n.check(in); err != nil {
+		return err
+	}
+
 	timer := time.NewTimer(timeout)
 	defer timer.Stop()
 
@@ -236,4 +456,8 @@ func defaultNormalConf(conf *NormalConf) {
 	}
 }
 
-var _ NormalFace = (*Normal)(nil)
+var (
+	_ NormalFace     = (*Normal)(nil)
+	_ PriorityWriter = (*Normal)(nil)
+	_ sharedLoop     = (*Normal)(nil)
+)
@@ -16,6 +16,13 @@ type (
 		// It should be called when the input message is not received by the player.
 		Resend(playerId string, frameId int)
 	}
+	// ChecksumProcessor is implemented by frame processors able to hash their game state.
+	// The checksum must be deterministic so that clients computing it from the same inputs
+	// report the same value, a mismatch flags the first desynchronized frame.
+	ChecksumProcessor interface {
+		// Checksum returns the hash of the game state after the frame was processed.
+		Checksum(frameID uint64) uint64
+	}
 	// NormalProcessor is an interface for processing normal messages.
 	// It is responsible for processing the input message.
 	NormalProcessor interface {
@@ -0,0 +1,88 @@
+package frame
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tickGroup drives all the loops of the same tick interval from a single ticker.
+// The loops are processed one after the other, so the tick of the whole group
+// must fit in the interval.
+type tickGroup struct {
+	mu       sync.Mutex
+	interval time.Duration
+	loops    map[sharedLoop]struct{}
+}
+
+func newTickGroup(interval time.Duration) *tickGroup {
+	return &tickGroup{
+		interval: interval,
+		loops:    make(map[sharedLoop]struct{}),
+	}
+}
+
+func (g *tickGroup) add(l sharedLoop) {
+	g.mu.Lock()
+	g.loops[l] = struct{}{}
+	g.mu.Unlock()
+}
+
+func (g *tickGroup) remove(l sharedLoop) {
+	g.mu.Lock()
+	delete(g.loops, l)
+	g.mu.Unlock()
+}
+
+// snapshot appends the loops of the group to buf, the loops are stepped without the lock.
+func (g *tickGroup) snapshot(buf []sharedLoop) []sharedLoop {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for l := range g.loops {
+		buf = append(buf, l)
+	}
+	return buf
+}
+
+// run ticks the loops of the group until the context is done.
+// Stopped loops are dropped, loops whose frequency changed are moved to the matching group with join.
+func (g *tickGroup) run(ctx context.Context, join func(sharedLoop)) {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	var buf []sharedLoop
+	for {
+		select {
+		case <-ctx.Done():
+			g.release()
+			return
+		case <-ticker.C:
+			buf = g.snapshot(buf[:0])
+			for _, l := range buf {
+				if !l.step() {
+					g.remove(l)
+					l.detach()
+					continue
+				}
+
+				if l.interval() != g.interval {
+					g.remove(l)
+					join(l)
+				}
+			}
+			clear(buf)
+		}
+	}
+}
+
+// release detaches all the loops of the group.
+func (g *tickGroup) release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for l := range g.loops {
+		l.detach()
+	}
+	clear(g.loops)
+}
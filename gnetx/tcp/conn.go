@@ -2,8 +2,10 @@ package tcp
 
 import (
 	"errors"
+	"fmt"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/czx-lab/czx/network"
 	xtcp "github.com/czx-lab/czx/network/tcp"
@@ -13,6 +15,12 @@ import (
 
 var (
 	defaultPendingWrite = 100
+
+	// ErrConnClosed is returned by ReadMessage once the connection is closed.
+	ErrConnClosed = errors.New("connection is closed")
+	// ErrFraming is returned by ReadMessage when the inbound data breaks the message framing,
+	// e.g. a length out of the parser bounds or a protocol prefix mismatch. It wraps the parser error.
+	ErrFraming = errors.New("message framing error")
 )
 
 type (
@@ -22,16 +30,21 @@ type (
 	GnetTcpConnConf struct {
 		// Number of pending writes
 		PendingWrite int
+		// WritePolicy is applied when the write queue is full, see network.WritePolicy
+		WritePolicy network.WritePolicy
+		// WriteBlockTimeout is the time a write waits for room in the queue with network.WriteBlock
+		WriteBlockTimeout time.Duration
 	}
 
 	GnetConn struct {
 		sync.Mutex
+		network.LabelSet
 		conf     *GnetTcpConnConf
 		gnetconn gnet.Conn
 		done     bool
 
-		// Queue for outgoing data
-		writeQueue chan []byte
+		// Queue for outgoing data, each entry is written at once with writev
+		writeQueue chan net.Buffers
 		parse      *xtcp.MessageParser
 		gbuffer    *GBuffer
 		clientAddr network.ClientAddrMessage
@@ -47,8 +60,9 @@ func NewGnetConn(c gnet.Conn, conf *GnetTcpConnConf) *GnetConn {
 	gnetconn := &GnetConn{
 		gnetconn:   c,
 		conf:       conf,
-		writeQueue: make(chan []byte, conf.PendingWrite),
+		writeQueue: make(chan net.Buffers, conf.PendingWrite),
 		gbuffer:    NewGBuffer(),
+		metrics:    &network.NoopServerMetrics{},
 	}
 	gnetconn.init()
 
@@ -72,7 +86,7 @@ func (g *GnetConn) init() {
 				break
 			}
 
-			n, err := g.gnetconn.Write(b)
+			n, err := g.gnetconn.Writev(b)
 			if err != nil {
 				g.metrics.IncWriteErrors()
 				break
@@ -110,17 +124,35 @@ func (g *GnetConn) Close() {
 		return
 	}
 
-	g.doWrite(nil)
+	if !network.EnqueueClose(g.conf.WritePolicy, g.writeQueue, g.conf.WriteBlockTimeout) {
+		g.doDestroy()
+	}
 	g.done = true
 }
 
-func (g *GnetConn) doWrite(b []byte) {
-	if len(g.writeQueue) == cap(g.writeQueue) {
+func (g *GnetConn) doWrite(b net.Buffers) {
+	g.metrics.ObserveWriteQueueDepth(len(g.writeQueue), cap(g.writeQueue))
+	if !network.Enqueue(g.conf.WritePolicy, g.writeQueue, b, g.conf.WriteBlockTimeout) {
 		g.doDestroy()
-		return
 	}
+}
+
+// WriteQueueLen implements network.WriteQueuer.
+func (g *GnetConn) WriteQueueLen() int {
+	return len(g.writeQueue)
+}
+
+// WriteQueueCap implements network.WriteQueuer.
+func (g *GnetConn) WriteQueueCap() int {
+	return cap(g.writeQueue)
+}
+
+// IsAlive implements network.Conn.
+func (g *GnetConn) IsAlive() bool {
+	g.Lock()
+	defer g.Unlock()
 
-	g.writeQueue <- b
+	return !g.done
 }
 
 // Destroy implements network.Conn.
@@ -154,9 +186,28 @@ func (g *GnetConn) ReadMessage() (b []byte, err error) {
 	defer g.Unlock()
 
 	if g.done {
-		return nil, errors.New("connection is closed")
+		return nil, ErrConnClosed
 	}
-	return g.parse.Read(g.gbuffer)
+
+	b, err = g.parse.Read(g.gbuffer)
+	if err != nil && isFraming(err) {
+		g.metrics.IncReadErrors()
+		return nil, fmt.Errorf("%w: %w", ErrFraming, err)
+	}
+	// io.EOF is returned as is, the peer went away cleanly
+	return b, err
+}
+
+// isFraming reports whether a parser error is a protocol violation of the peer.
+func isFraming(err error) bool {
+	return errors.Is(err, xtcp.ErrMessageTooLong) ||
+		errors.Is(err, xtcp.ErrMessageTooShort) ||
+		errors.Is(err, xtcp.ErrProtocolMismatch)
+}
+
+// ReleaseMessage implements network.MessageReleaser.
+func (g *GnetConn) ReleaseMessage(b []byte) {
+	g.parse.Release(b)
 }
 
 // RemoteAddr implements network.Conn.
@@ -180,6 +231,11 @@ func (g *GnetConn) WriteMessage(args ...[]byte) error {
 	return g.parse.Write(g, args...)
 }
 
+// WriteBatch implements network.BatchWriter.
+func (g *GnetConn) WriteBatch(msgs ...[][]byte) error {
+	return g.parse.WriteBatch(g, msgs...)
+}
+
 // Write implements io.Writer.
 func (g *GnetConn) Write(p []byte) (n int, err error) {
 	g.Lock()
@@ -189,8 +245,33 @@ func (g *GnetConn) Write(p []byte) (n int, err error) {
 		return 0, errors.New("dead connection or nil data")
 	}
 
-	g.doWrite(p)
+	g.doWrite(net.Buffers{p})
 	return len(p), nil
 }
 
-var _ network.Conn = (*GnetConn)(nil)
+// WriteBuffers implements network.BuffersWriter.
+// The buffers are queued without being copied and written with a single writev call.
+func (g *GnetConn) WriteBuffers(bufs net.Buffers) (int64, error) {
+	g.Lock()
+	defer g.Unlock()
+
+	if g.done || bufs == nil {
+		return 0, errors.New("dead connection or nil data")
+	}
+
+	var n int64
+	for _, b := range bufs {
+		n += int64(len(b))
+	}
+
+	g.doWrite(bufs)
+	return n, nil
+}
+
+var (
+	_ network.Conn            = (*GnetConn)(nil)
+	_ network.WriteQueuer     = (*GnetConn)(nil)
+	_ network.MessageReleaser = (*GnetConn)(nil)
+	_ network.BuffersWriter   = (*GnetConn)(nil)
+	_ network.BatchWriter     = (*GnetConn)(nil)
+)
@@ -0,0 +1,53 @@
+package tcp
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/czx-lab/czx/network"
+	xtcp "github.com/czx-lab/czx/network/tcp"
+)
+
+// readMetrics counts the read errors
+type readMetrics struct {
+	network.NoopServerMetrics
+	readErrors int
+}
+
+func (m *readMetrics) IncReadErrors() { m.readErrors++ }
+
+func TestGnetConnReadErrors(t *testing.T) {
+	m := &readMetrics{}
+	conn := NewGnetConn(nil, &GnetTcpConnConf{}).WithMetrics(m)
+	conn.WithParse(xtcp.NewParse(&xtcp.MessageParserConf{MsgLengthType: xtcp.LenType8, MsgMaxSize: 4}))
+
+	// Nothing received yet
+	if _, err := conn.ReadMessage(); !errors.Is(err, io.EOF) {
+		t.Fatalf("got %v, want io.EOF", err)
+	}
+
+	conn.WriteBuffer([]byte{2, 'o', 'k'})
+	if b, err := conn.ReadMessage(); err != nil || string(b) != "ok" {
+		t.Fatalf("got %q, %v, want ok", b, err)
+	}
+
+	conn.WriteBuffer([]byte{8})
+	_, err := conn.ReadMessage()
+	if !errors.Is(err, ErrFraming) || !errors.Is(err, xtcp.ErrMessageTooLong) {
+		t.Fatalf("got %v, want a framing error", err)
+	}
+	if m.readErrors != 1 {
+		t.Fatalf("read errors = %d, want 1", m.readErrors)
+	}
+
+	conn.Lock()
+	conn.done = true
+	conn.Unlock()
+	if _, err := conn.ReadMessage(); !errors.Is(err, ErrConnClosed) {
+		t.Fatalf("got %v, want ErrConnClosed", err)
+	}
+	if m.readErrors != 1 {
+		t.Fatalf("read errors = %d, a closed connection is not a read error", m.readErrors)
+	}
+}
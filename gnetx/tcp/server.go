@@ -25,11 +25,22 @@ type (
 	GnetTcpServerConf struct {
 		GnetTcpConnConf
 		xtcp.MessageParserConf
+		// Addr is the listen address, e.g. "tcp://:9000". Several comma separated addresses are
+		// all accepted on by the server, e.g. "tcp://:9000,tcp://:9001". The scheme defaults to tcp.
 		Addr      string
 		KeepAlive uint64
 		NoDelay   gnet.TCPSocketOpt
 		Multicore bool
 		Ticker    bool
+		// ReusePort sets SO_REUSEPORT on the listeners, see gnet.WithReusePort
+		ReusePort bool
+		// LoadBalancing is the strategy spreading the new connections over the event loops:
+		// gnet.RoundRobin (default), gnet.LeastConnections or gnet.SourceAddrHash
+		LoadBalancing gnet.LoadBalancing
+		// NumEventLoop is the number of event loops, zero lets gnet decide from Multicore
+		NumEventLoop int
+		// ReadBufferCap is the size of the read buffer of each connection, zero uses the gnet default
+		ReadBufferCap int
 		// Maximum number of connections
 		MaxConn int
 		// If ImmediateRelease is true, the server will release resources immediately after stopping.
@@ -37,7 +48,10 @@ type (
 		// If false, the server will wait for all active connections to close gracefully before releasing resources.
 		// Default is false.
 		ImmediateRelease bool
-		Metrics          metrics.SvrMetricsConf
+		// StopTimeout bounds the time Stop waits for the active connections to finish,
+		// the remaining ones are then destroyed. Zero waits indefinitely.
+		StopTimeout time.Duration
+		Metrics     metrics.SvrMetricsConf
 	}
 	GnetTcpServer struct {
 		mu       sync.Mutex
@@ -50,6 +64,8 @@ type (
 		connWait sync.WaitGroup
 		conns    Conns
 		metrics  network.ServerMetrics
+		// closed once the engine is listening, see Start
+		booted chan struct{}
 	}
 )
 
@@ -59,7 +75,9 @@ func NewGNetTcpServer(conf *GnetTcpServerConf, agent func(network.Conn) network.
 	defaultConf(conf)
 	var m network.ServerMetrics
 	if prometheus.Enabled() {
-		m = metrics.NewSvrMetrics(conf.Metrics)
+		mconf := conf.Metrics
+		mconf.Transport = "gnet"
+		m = metrics.NewSvrMetrics(mconf)
 	} else {
 		m = &network.NoopServerMetrics{}
 	}
@@ -80,20 +98,52 @@ func (g *GnetTcpServer) WithTick(delay time.Duration, fn func()) {
 	g.tickFn = fn
 }
 
+// Start runs the engine on all the addresses of the configuration.
+// It returns once the server is listening, or the error if an address cannot be bound.
 func (g *GnetTcpServer) Start() error {
-	addrs := strings.Split(g.conf.Addr, ":")
 	opts := []gnet.Option{
 		gnet.WithMulticore(g.conf.Multicore),
 		gnet.WithTCPKeepAlive(time.Duration(g.conf.KeepAlive) * time.Second),
 		gnet.WithTicker(g.conf.Ticker),
 		gnet.WithTCPNoDelay(g.conf.NoDelay),
+		gnet.WithReusePort(g.conf.ReusePort),
+		gnet.WithLoadBalancing(g.conf.LoadBalancing),
+		gnet.WithNumEventLoop(g.conf.NumEventLoop),
+		gnet.WithReadBufferCap(g.conf.ReadBufferCap),
 	}
 
-	go gnet.Run(g, strings.TrimSpace(addrs[0]), opts...)
+	// A new channel for every start, the server may be restarted after Stop
+	g.booted = make(chan struct{})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- gnet.Rotate(g, listenAddrs(g.conf.Addr), opts...)
+	}()
 
-	return nil
+	select {
+	case err := <-errc:
+		return err
+	case <-g.booted:
+		return nil
+	}
+}
+
+// listenAddrs splits the comma separated addresses, adding the tcp scheme when missing.
+func listenAddrs(addr string) []string {
+	var addrs []string
+	for a := range strings.SplitSeq(addr, ",") {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			continue
+		}
+		if !strings.Contains(a, "://") {
+			a = "tcp://" + a
+		}
+		addrs = append(addrs, a)
+	}
+	return addrs
 }
 
+// Stop stops the engine and waits for the connections to finish, at most StopTimeout if set.
 func (g *GnetTcpServer) Stop() {
 	if g.conf.ImmediateRelease {
 		// Immediately close all connections
@@ -108,7 +158,15 @@ func (g *GnetTcpServer) Stop() {
 	g.eng.Stop(context.Background())
 
 	// Wait for all agent goroutines to finish
-	g.connWait.Wait()
+	if !network.WaitTimeout(&g.connWait, g.conf.StopTimeout) {
+		g.mu.Lock()
+		for conn := range g.conns {
+			conn.Destroy()
+		}
+		n := len(g.conns)
+		g.mu.Unlock()
+		xlog.Write().Warn("gnet tcp server stop timeout, connections destroyed", zap.Int("count", n))
+	}
 
 	// Clear the connection map
 	g.mu.Lock()
@@ -140,8 +198,7 @@ func (es *GnetTcpServer) OnOpen(c gnet.Conn) (out []byte, action gnet.Action) {
 	}
 	conn := NewGnetConn(c, &es.conf.GnetTcpConnConf).WithParse(es.parse)
 
-	ip, port, _ := network.GetClientIPFromProxyProtocol(c)
-	clientAddr := network.ClientAddrMessage{IP: *ip, Port: *port}
+	clientAddr := network.ConnClientAddr(c)
 	conn.withClientAddr(clientAddr)
 
 	// Store conn in context for fast lookup in OnTraffic
@@ -200,6 +257,7 @@ func (es *GnetTcpServer) OnTick() (delay time.Duration, action gnet.Action) {
 // OnBoot implements gnet.EventHandler.
 func (es *GnetTcpServer) OnBoot(eng gnet.Engine) gnet.Action {
 	es.eng = eng
+	close(es.booted)
 	return gnet.None
 }
 
@@ -207,7 +265,8 @@ func (es *GnetTcpServer) OnBoot(eng gnet.Engine) gnet.Action {
 func (es *GnetTcpServer) OnTraffic(c gnet.Conn) gnet.Action {
 	buf, err := c.Next(-1)
 	if err != nil {
-		xlog.Write().Error("gnet tcp server read error: %v", zap.Error(err))
+		es.metrics.IncReadErrors()
+		xlog.Write().Error("gnet tcp server read error", zap.Error(err))
 		return gnet.Close
 	}
 
@@ -0,0 +1,116 @@
+package tcp
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/czx-lab/czx/network"
+)
+
+// holdAgent reports the local address of its connection and keeps it
+// open until released. The address is captured on the event loop, gnet
+// connections must not be read from other goroutines.
+type holdAgent struct {
+	network.Agent
+	opened  chan<- net.Addr
+	local   net.Addr
+	release <-chan struct{}
+}
+
+func (a *holdAgent) OnPreConn(network.ClientAddrMessage) {}
+func (a *holdAgent) OnClose()                            {}
+func (a *holdAgent) Run() {
+	a.opened <- a.local
+	<-a.release
+}
+
+// freePort returns a local port nothing listens on
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestListenAddrs(t *testing.T) {
+	got := listenAddrs(" 127.0.0.1:9000, tcp4://:9001,,unix:///tmp/gnet.sock")
+	want := []string{"tcp://127.0.0.1:9000", "tcp4://:9001", "unix:///tmp/gnet.sock"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestGnetTcpServerMultiAddr(t *testing.T) {
+	ports := []int{freePort(t), freePort(t)}
+	opened := make(chan net.Addr)
+	release := make(chan struct{})
+
+	srv := NewGNetTcpServer(&GnetTcpServerConf{
+		Addr:        fmt.Sprintf("127.0.0.1:%d,tcp://127.0.0.1:%d", ports[0], ports[1]),
+		MaxConn:     10,
+		StopTimeout: time.Second,
+	}, func(c network.Conn) network.Agent {
+		return &holdAgent{opened: opened, local: c.LocalAddr(), release: release}
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	defer close(release)
+
+	for _, port := range ports {
+		c, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		select {
+		case local := <-opened:
+			if got := local.(*net.TCPAddr).Port; got != port {
+				t.Fatalf("accepted on port %d, want %d", got, port)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("connection on port %d not accepted", port)
+		}
+	}
+}
+
+func TestGnetTcpServerBindError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	srv := NewGNetTcpServer(&GnetTcpServerConf{Addr: ln.Addr().String()}, nil)
+	if err := srv.Start(); err == nil {
+		srv.Stop()
+		t.Fatal("binding a used address must fail")
+	}
+}
+
+func TestGnetTcpServerRestart(t *testing.T) {
+	srv := NewGNetTcpServer(&GnetTcpServerConf{
+		Addr:        fmt.Sprintf("127.0.0.1:%d", freePort(t)),
+		MaxConn:     10,
+		StopTimeout: time.Second,
+	}, func(c network.Conn) network.Agent {
+		return &holdAgent{local: c.LocalAddr()}
+	})
+
+	for range 2 {
+		if err := srv.Start(); err != nil {
+			t.Fatal(err)
+		}
+		srv.Stop()
+	}
+}
@@ -3,11 +3,14 @@ package metrics
 import (
 	"errors"
 
+	"github.com/czx-lab/czx/prometheus"
+
 	prom "github.com/prometheus/client_golang/prometheus"
 )
 
 type promCounter struct {
 	counter *prom.CounterVec
+	reg     *prom.Registry // registry the vector is registered to
 }
 
 var _ Counter = (*promCounter)(nil)
@@ -17,14 +20,17 @@ func NewCounter(conf *VectorOption) Counter {
 		return nil
 	}
 	vec := prom.NewCounterVec(prom.CounterOpts{
-		Namespace: conf.Namespace,
-		Subsystem: conf.Subsystem,
-		Name:      conf.Name,
-		Help:      conf.Help,
+		Namespace:   conf.Namespace,
+		Subsystem:   conf.Subsystem,
+		Name:        conf.Name,
+		Help:        conf.Help,
+		ConstLabels: conf.ConstLabels,
 	}, conf.Labels)
-	prom.MustRegister(vec)
+	reg := prometheus.Registry()
+	vec = register(reg, vec)
 	cv := &promCounter{
 		counter: vec,
+		reg:     reg,
 	}
 	return cv
 }
@@ -38,7 +44,7 @@ func (p *promCounter) Add(delta float64, labels ...string) {
 
 // Close implements Counter.
 func (p *promCounter) Close() error {
-	if prom.Unregister(p.counter) {
+	if p.reg.Unregister(p.counter) {
 		return nil
 	}
 	return errors.New("failed to unregister counter metric")
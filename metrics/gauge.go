@@ -3,11 +3,14 @@ package metrics
 import (
 	"errors"
 
+	"github.com/czx-lab/czx/prometheus"
+
 	prom "github.com/prometheus/client_golang/prometheus"
 )
 
 type promGauge struct {
 	gauge *prom.GaugeVec
+	reg   *prom.Registry // registry the vector is registered to
 }
 
 var _ Gauge = (*promGauge)(nil)
@@ -17,14 +20,17 @@ func NewGauge(conf *VectorOption) Gauge {
 		return nil
 	}
 	vec := prom.NewGaugeVec(prom.GaugeOpts{
-		Namespace: conf.Namespace,
-		Subsystem: conf.Subsystem,
-		Name:      conf.Name,
-		Help:      conf.Help,
+		Namespace:   conf.Namespace,
+		Subsystem:   conf.Subsystem,
+		Name:        conf.Name,
+		Help:        conf.Help,
+		ConstLabels: conf.ConstLabels,
 	}, conf.Labels)
-	prom.MustRegister(vec)
+	reg := prometheus.Registry()
+	vec = register(reg, vec)
 	gv := &promGauge{
 		gauge: vec,
+		reg:   reg,
 	}
 	return gv
 }
@@ -38,7 +44,7 @@ func (p *promGauge) Add(delta float64, labels ...string) {
 
 // Close implements Gauge.
 func (p *promGauge) Close() error {
-	if prom.Unregister(p.gauge) {
+	if p.reg.Unregister(p.gauge) {
 		return nil
 	}
 	return errors.New("failed to unregister gauge metric")
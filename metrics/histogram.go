@@ -3,6 +3,8 @@ package metrics
 import (
 	"errors"
 
+	"github.com/czx-lab/czx/prometheus"
+
 	prom "github.com/prometheus/client_golang/prometheus"
 )
 
@@ -10,11 +12,13 @@ type (
 	// A HistogramVecOpts is a histogram vector options.
 	HistogramVecOpts struct {
 		VectorOption
-		Buckets     []float64
+		Buckets []float64
+		// ConstLabels takes precedence over VectorOption.ConstLabels when set.
 		ConstLabels map[string]string
 	}
 	promHistogram struct {
 		histogram *prom.HistogramVec
+		reg       *prom.Registry // registry the vector is registered to
 	}
 )
 
@@ -22,24 +26,30 @@ func NewHistogram(conf *HistogramVecOpts) Histogram {
 	if conf == nil {
 		return nil
 	}
+	constLabels := conf.ConstLabels
+	if constLabels == nil {
+		constLabels = conf.VectorOption.ConstLabels
+	}
 	vec := prom.NewHistogramVec(prom.HistogramOpts{
 		Namespace:   conf.Namespace,
 		Subsystem:   conf.Subsystem,
 		Name:        conf.Name,
 		Help:        conf.Help,
 		Buckets:     conf.Buckets,
-		ConstLabels: conf.ConstLabels,
+		ConstLabels: constLabels,
 	}, conf.Labels)
-	prom.MustRegister(vec)
+	reg := prometheus.Registry()
+	vec = register(reg, vec)
 	h := &promHistogram{
 		histogram: vec,
+		reg:       reg,
 	}
 	return h
 }
 
 // Close implements Histogram.
 func (p *promHistogram) Close() error {
-	if prom.Unregister(p.histogram) {
+	if p.reg.Unregister(p.histogram) {
 		return nil
 	}
 	return errors.New("failed to unregister histogram metric")
@@ -1,6 +1,12 @@
 package metrics
 
-import "github.com/czx-lab/czx/prometheus"
+import (
+	"errors"
+
+	"github.com/czx-lab/czx/prometheus"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
 
 type (
 	// VectorOption defines options for creating metric vectors.
@@ -10,6 +16,8 @@ type (
 		Name      string
 		Help      string
 		Labels    []string
+		// ConstLabels are labels with fixed values attached to every series of the vector.
+		ConstLabels map[string]string
 	}
 	// Metrics defines the interface for metrics collection and reporting.
 	Metrics interface {
@@ -43,6 +51,24 @@ type (
 	}
 )
 
+// register registers the vector to the registry of the prometheus package. An identical vector
+// already registered, e.g. by a second server with the same configuration, is returned instead,
+// the callers then share it. It panics like MustRegister on conflicting registrations.
+func register[T prom.Collector](reg *prom.Registry, vec T) T {
+	err := reg.Register(vec)
+	if err == nil {
+		return vec
+	}
+
+	var are prom.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(T); ok {
+			return existing
+		}
+	}
+	panic(err)
+}
+
 func update(fn func()) {
 	if !prometheus.Enabled() {
 		return
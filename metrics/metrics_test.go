@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/czx-lab/czx/prometheus"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCustomRegistry(t *testing.T) {
+	reg := prom.NewRegistry()
+	if err := prometheus.UseRegistry(reg); err != nil {
+		t.Fatal(err)
+	}
+	defer prometheus.UseRegistry(nil)
+	prometheus.Enable()
+
+	counter := NewCounter(&VectorOption{Namespace: "czx", Name: "test_total", Labels: []string{"kind"}})
+	counter.Inc("a")
+
+	rec := httptest.NewRecorder()
+	prometheus.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{`czx_test_total{kind="a"} 1`, "go_goroutines"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("%q not exposed", want)
+		}
+	}
+
+	// The default registry is left untouched
+	prometheus.UseRegistry(nil)
+	if err := counter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	families, _ := prom.DefaultGatherer.Gather()
+	for _, f := range families {
+		if f.GetName() == "czx_test_total" {
+			t.Fatal("the counter must not be registered to the default registry")
+		}
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	if err := prometheus.UseRegistry(prom.NewRegistry()); err != nil {
+		t.Fatal(err)
+	}
+	defer prometheus.UseRegistry(nil)
+	prometheus.Enable()
+
+	opt := VectorOption{Namespace: "czx", Name: "twice_total"}
+	first, second := NewCounter(&opt), NewCounter(&opt)
+	first.Inc()
+	second.Inc()
+	if first.(*promCounter).counter != second.(*promCounter).counter {
+		t.Fatal("identical vectors must be shared")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("a vector conflicting with a registered one must panic")
+		}
+	}()
+	NewGauge(&opt)
+}
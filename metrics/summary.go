@@ -3,6 +3,8 @@ package metrics
 import (
 	"errors"
 
+	"github.com/czx-lab/czx/prometheus"
+
 	prom "github.com/prometheus/client_golang/prometheus"
 )
 
@@ -15,6 +17,7 @@ type (
 
 	promSummary struct {
 		summary *prom.SummaryVec
+		reg     *prom.Registry // registry the vector is registered to
 	}
 )
 
@@ -25,22 +28,25 @@ func NewSummary(conf *SummaryVecOpts) Summary {
 		return nil
 	}
 	vec := prom.NewSummaryVec(prom.SummaryOpts{
-		Namespace:  conf.VecOpt.Namespace,
-		Subsystem:  conf.VecOpt.Subsystem,
-		Name:       conf.VecOpt.Name,
-		Help:       conf.VecOpt.Help,
-		Objectives: conf.Objectives,
+		Namespace:   conf.VecOpt.Namespace,
+		Subsystem:   conf.VecOpt.Subsystem,
+		Name:        conf.VecOpt.Name,
+		Help:        conf.VecOpt.Help,
+		Objectives:  conf.Objectives,
+		ConstLabels: conf.VecOpt.ConstLabels,
 	}, conf.VecOpt.Labels)
-	prom.MustRegister(vec)
+	reg := prometheus.Registry()
+	vec = register(reg, vec)
 	s := &promSummary{
 		summary: vec,
+		reg:     reg,
 	}
 	return s
 }
 
 // Close implements Summary.
 func (p *promSummary) Close() error {
-	if prom.Unregister(p.summary) {
+	if p.reg.Unregister(p.summary) {
 		return nil
 	}
 	return errors.New("failed to unregister summary metric")
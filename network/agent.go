@@ -13,6 +13,21 @@ type (
 		// WriteWithCode sends a message with a specific error code to the connection.
 		// This is useful for sending error messages or status codes.
 		WriteWithCode(code uint, msg any) error
+		// Marshal encodes a message with the agent processor, a zero code encodes it like Write,
+		// otherwise like WriteWithCode. The frames can be written to many connections with WriteRaw.
+		Marshal(code uint, msg any) ([][]byte, error)
+		// WriteRaw writes frames that are already encoded, e.g. by Marshal, without going through the processor.
+		// It is used for cached snapshots and replays, or to relay messages between nodes without decoding them.
+		WriteRaw(frames ...[]byte) error
+		// Buffer encodes a message like Write and keeps it until Flush is called.
+		Buffer(msg any) error
+		// Flush writes the buffered messages, with a single network write on connections
+		// implementing BatchWriter, e.g. at the end of a frame loop tick.
+		Flush() error
+		// Conn returns the underlying connection.
+		Conn() Conn
+		// IsAlive reports whether the underlying connection still accepts writes.
+		IsAlive() bool
 		// LocalAddr returns the local address of the connection.
 		LocalAddr() net.Addr
 		// RemoteAddr returns the remote address of the connection.
@@ -20,8 +35,16 @@ type (
 		// ClientAddr returns the client address of the connection.
 		// This includes the IP address, port, and the HTTP request associated with the connection.
 		ClientAddr() ClientAddrMessage
+		// SetLabel stamps the connection with a label, see Conn.SetLabel.
+		SetLabel(key, value string)
+		// Labels returns a copy of the labels of the connection.
+		Labels() map[string]string
 		// Close closes the connection.
 		Close()
+		// CloseWithReason sends a final message with the code through the processor, if msg is not nil,
+		// and then closes the connection. Connections supporting it also receive the code and the reason,
+		// e.g. in a WebSocket close frame, see ReasonCloser.
+		CloseWithReason(code uint16, msg any, reason string)
 		// Destroy cleans up the agent and releases resources.
 		Destroy()
 		// OnClose is called when the connection is closed.
@@ -41,4 +64,11 @@ type (
 		// Stop stops the server and closes all active connections.
 		Stop()
 	}
+	// GracefulServer is implemented by servers that can stop accepting new connections
+	// while keeping the active ones open, so they can be drained before Stop is called.
+	GracefulServer interface {
+		ServerFace
+		// StopAccept stops accepting new connections without closing the active ones.
+		StopAccept()
+	}
 )
@@ -0,0 +1,205 @@
+package cborx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/czx-lab/czx/network"
+	"github.com/czx-lab/czx/xlog"
+	"github.com/fxamacker/cbor/v2"
+	"go.uber.org/zap"
+)
+
+type (
+	Processor struct {
+		conf network.ProcessorConf
+		// messages registered by name
+		messages map[string]*message
+		metrics  network.ProcessorMetrics
+		// fallback handles the messages whose name is not registered
+		fallback DefaultHandler
+	}
+	message struct {
+		name    string
+		msgtype reflect.Type
+		handler network.Handler
+	}
+	// DefaultHandler handles the messages whose name is not registered, instead of closing the connection.
+	DefaultHandler func(name string, raw cbor.RawMessage, agent network.Agent)
+)
+
+var (
+	_ network.Processor        = (*Processor)(nil)
+	_ network.ContextProcessor = (*Processor)(nil)
+	_ network.MessageNamer     = (*Processor)(nil)
+)
+
+// NewProcessor creates a new cbor processor.
+// Messages are encoded like with jsonx, as a map with a single entry keyed by message name,
+// which is more compact than json while staying self-describing.
+func NewProcessor(conf network.ProcessorConf) *Processor {
+	return &Processor{
+		conf:     conf,
+		messages: make(map[string]*message),
+		metrics:  &network.NoopProcessorMetrics{},
+	}
+}
+
+// WithMetrics sets the metrics for the Processor instance.
+// The duration of every handler call is observed, labeled by message name.
+func (p *Processor) WithMetrics(m network.ProcessorMetrics) *Processor {
+	p.metrics = m
+	return p
+}
+
+// RegisterDefaultHandler sets the handler of the messages whose name is not registered.
+// Without it, such messages fail to decode and the connection is closed.
+func (p *Processor) RegisterDefaultHandler(handler DefaultHandler) *Processor {
+	p.fallback = handler
+	return p
+}
+
+// Marshal implements network.Processor.
+func (p *Processor) Marshal(msgs any) ([][]byte, error) {
+	msgtype := reflect.TypeOf(msgs)
+	if msgtype == nil || msgtype.Kind() != reflect.Ptr {
+		return nil, errors.New("cbor message pointer required")
+	}
+
+	mname := msgtype.Elem().Name()
+	if _, ok := p.messages[mname]; !ok {
+		return nil, fmt.Errorf("message %v not registered", mname)
+	}
+
+	m := map[string]any{mname: msgs}
+	data, err := cbor.Marshal(m)
+	return [][]byte{data}, err
+}
+
+// MarshalWithCode implements network.Processor.
+func (p *Processor) MarshalWithCode(code uint, msg any) ([][]byte, error) {
+	msgs, err := p.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	mcode := make([]byte, p.conf.CodeLength)
+	network.PutCode(mcode, code, p.conf)
+
+	smsgs := [][]byte{mcode}
+	smsgs = append(smsgs, msgs...)
+	return smsgs, nil
+}
+
+// Process implements network.Processor.
+func (p *Processor) Process(data any, agent network.Agent) error {
+	return p.ProcessCtx(context.Background(), data, agent)
+}
+
+// ProcessCtx implements network.ContextProcessor.
+func (p *Processor) ProcessCtx(ctx context.Context, data any, agent network.Agent) error {
+	if unknown, ok := data.(*network.UnknownMessage); ok {
+		if p.fallback != nil {
+			p.fallback(unknown.Name, cbor.RawMessage(unknown.Data), agent)
+			return nil
+		}
+		xlog.Write().Debug("cbor: unknown message skipped", zap.String("name", unknown.Name))
+		return nil
+	}
+
+	msgname := reflect.TypeOf(data).Elem().Name()
+	info, ok := p.messages[msgname]
+	if !ok {
+		return fmt.Errorf("message %s not registered", msgname)
+	}
+	if info.handler != nil {
+		start_t := time.Now()
+		info.handler([]any{data, agent, ctx})
+		p.metrics.ObserveHandlerDuration(msgname, time.Since(start_t))
+	}
+
+	return nil
+}
+
+// MessageName implements network.MessageNamer, messages are named by type name.
+func (p *Processor) MessageName(msg any) string {
+	return reflect.TypeOf(msg).Elem().Name()
+}
+
+// Register implements network.Processor.
+func (p *Processor) Register(msg network.Message) error {
+	msgtype := reflect.TypeOf(msg.Data)
+	if msgtype == nil || msgtype.Kind() != reflect.Ptr {
+		return errors.New("cbor message pointer required")
+	}
+
+	// check if the message is registered
+	msgname := msgtype.Elem().Name()
+	if len(msgname) == 0 {
+		return errors.New("unnamed cbor message")
+	}
+	if _, ok := p.messages[msgname]; ok {
+		return fmt.Errorf("message %v is already registered", msgname)
+	}
+
+	i := new(message)
+	i.name = msgname
+	i.msgtype = msgtype
+	p.messages[msgname] = i
+
+	return nil
+}
+
+// RegisterHandler implements network.Processor.
+func (p *Processor) RegisterHandler(msg any, handler network.Handler) error {
+	msgtype := reflect.TypeOf(msg)
+	if msgtype == nil || msgtype.Kind() != reflect.Ptr {
+		return errors.New("cbor message pointer required")
+	}
+
+	msgname := msgtype.Elem().Name()
+	info, ok := p.messages[msgname]
+	if !ok {
+		return fmt.Errorf("message %v not registered", msgname)
+	}
+
+	info.handler = handler
+	return nil
+}
+
+// Range calls fn for every registered message with its name and type, e.g. to dump the message table.
+func (p *Processor) Range(fn func(name string, msgtype reflect.Type)) {
+	for _, i := range p.messages {
+		fn(i.name, i.msgtype)
+	}
+}
+
+// Unmarshal implements network.Processor.
+func (p *Processor) Unmarshal(data []byte) (any, error) {
+	var m map[string]cbor.RawMessage
+	if err := cbor.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	if len(m) != 1 {
+		return nil, errors.New("invalid cbor data")
+	}
+
+	for msgname, data := range m {
+		info, ok := p.messages[msgname]
+		if !ok {
+			if p.fallback != nil || p.conf.IgnoreUnknown {
+				// data is unmarshaled into a new slice, it does not alias the buffer
+				return &network.UnknownMessage{Name: msgname, Data: data}, nil
+			}
+			return nil, fmt.Errorf("message %v not registered", msgname)
+		}
+
+		msg := reflect.New(info.msgtype.Elem()).Interface()
+		return msg, cbor.Unmarshal(data, msg)
+	}
+
+	return nil, errors.New("invalid cbor data")
+}
@@ -0,0 +1,114 @@
+package cborx
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/czx-lab/czx/network"
+	"github.com/fxamacker/cbor/v2"
+)
+
+type (
+	Position struct {
+		X, Y float64
+	}
+	Unit struct {
+		ID    int
+		Pos   Position
+		Tags  []string
+		Stats map[string]int
+	}
+	Snapshot struct {
+		Tick  uint64
+		Units []Unit
+		Owner *Unit
+	}
+)
+
+func TestProcessorRoundTrip(t *testing.T) {
+	p := NewProcessor(network.ProcessorConf{CodeLength: network.IDCodeLenType16, LittleEndian: true})
+	if err := p.Register(network.Message{Data: &Snapshot{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got *Snapshot
+	p.RegisterHandler(&Snapshot{}, func(args []any) {
+		got = args[0].(*Snapshot)
+	})
+
+	want := &Snapshot{
+		Tick: 42,
+		Units: []Unit{
+			{ID: 1, Pos: Position{X: 1.5, Y: -2}, Tags: []string{"tank"}, Stats: map[string]int{"hp": 100}},
+			{ID: 2, Pos: Position{X: 0, Y: 3.25}},
+		},
+		Owner: &Unit{ID: 7, Tags: []string{"commander", "hero"}},
+	}
+	frames, err := p.MarshalWithCode(0x0102, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 || frames[0][0] != 0x02 || frames[0][1] != 0x01 {
+		t.Fatalf("code prefix = %x, want little endian 0201", frames[0])
+	}
+
+	msg, err := p.Unmarshal(frames[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Process(msg, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestProcessorDefaultHandler(t *testing.T) {
+	p := NewProcessor(network.ProcessorConf{})
+
+	var gotName string
+	var gotRaw cbor.RawMessage
+	p.RegisterDefaultHandler(func(name string, raw cbor.RawMessage, agent network.Agent) {
+		gotName, gotRaw = name, raw
+	})
+
+	data, err := cbor.Marshal(map[string]any{"Chat": map[string]string{"Text": "hi"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := p.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Process(msg, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var chat struct{ Text string }
+	if err := cbor.Unmarshal(gotRaw, &chat); err != nil {
+		t.Fatal(err)
+	}
+	if gotName != "Chat" || chat.Text != "hi" {
+		t.Fatalf("default handler got %s %+v", gotName, chat)
+	}
+}
+
+func TestProcessorRange(t *testing.T) {
+	p := NewProcessor(network.ProcessorConf{})
+	p.Register(network.Message{Data: &Snapshot{}})
+	p.Register(network.Message{Data: &Unit{}})
+
+	got := make(map[string]reflect.Type)
+	p.Range(func(name string, msgtype reflect.Type) {
+		got[name] = msgtype
+	})
+
+	want := map[string]reflect.Type{
+		"Snapshot": reflect.TypeFor[*Snapshot](),
+		"Unit":     reflect.TypeFor[*Unit](),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
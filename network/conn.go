@@ -1,10 +1,33 @@
 package network
 
 import (
+	"crypto/tls"
+	"errors"
 	"net"
 	"net/http"
+	"net/netip"
+	"time"
 )
 
+const (
+	// WriteDestroy destroys the connection when its write queue is full, this is the default policy
+	WriteDestroy WritePolicy = iota
+	// WriteDropOldest drops the oldest queued message to make room for the new one
+	WriteDropOldest
+	// WriteBlock waits for room in the queue, and destroys the connection if none is made in time.
+	// The wait holds the connection lock: the other writers, IsAlive and Close wait as well,
+	// so a loop writing to many connections is held back by a slow peer for up to the timeout.
+	// Such loops should skip the connections whose queue is full, see WriteQueuer.
+	WriteBlock
+)
+
+// defaultWriteBlockTimeout is the default time a write waits for room in the queue with WriteBlock
+const defaultWriteBlockTimeout = time.Second
+
+// ErrMessageTooLong is returned by all the transports for messages over their maximum size,
+// whether they are read or written.
+var ErrMessageTooLong = errors.New("message too long")
+
 type (
 	// Conn is an interface for handling network connections and messages.
 	// It provides methods for reading and writing messages, managing connection state,
@@ -19,6 +42,12 @@ type (
 		RemoteAddr() net.Addr
 		// Returns the client address of the connection.
 		ClientAddr() ClientAddrMessage
+		// IsAlive reports whether the connection still accepts writes, i.e. it is neither closed nor destroyed.
+		IsAlive() bool
+		// SetLabel stamps the connection with a label, e.g. at accept time, see Labels.
+		SetLabel(key, value string)
+		// Labels returns a copy of the labels of the connection.
+		Labels() map[string]string
 		// Close closes the connection.
 		// NOTE: Close guarantees that messages will not be lost
 		// but does not guarantee that the connection will be closed.
@@ -32,11 +61,170 @@ type (
 	// ClientAddrMessage is a struct that contains information about the client address and the request.
 	// It includes the IP address, port, and the HTTP request associated with the connection.
 	ClientAddrMessage struct {
+		// IP and Port are the client address announced by the proxies if any, see GetClientIP,
+		// they may be forged by the client, use RealIP for bans and rate limits.
 		IP   string
 		Port string
+		// Peer is the IP of the socket peer, the last proxy for a proxied connection.
+		// It is empty when the transport does not tell it apart from IP.
+		Peer string
 		Req  *http.Request
+		// Subprotocol is the negotiated WebSocket subprotocol, empty if none
+		Subprotocol string
+		// Headers are the headers of the HTTP upgrade request, WebSocket only
+		Headers http.Header
+		// Forwarded is the chain of client addresses reported by the proxies, the client first:
+		// the X-Forwarded-For header for WebSocket, the PROXY protocol source for TCP.
+		// It is empty for a direct connection.
+		Forwarded []string
+		// TLS is the state of the TLS connection, nil for plain connections
+		TLS *tls.ConnectionState
 	}
 
 	// PreConnHandler is a function type that handles incoming connections and messages. It takes an Agent and a PreHandlerMessage as arguments and returns an error.
 	PreConnHandler func(Agent, ClientAddrMessage)
+	// ReasonCloser is implemented by connections that can tell the peer why they are closed,
+	// e.g. with a WebSocket close frame. Pending writes are flushed before closing.
+	ReasonCloser interface {
+		CloseWithReason(code uint16, reason string)
+	}
+	// WriteQueuer is implemented by connections with a write queue, it lets applications
+	// throttle their writes before the write policy kicks in.
+	WriteQueuer interface {
+		// WriteQueueLen returns the number of messages waiting to be written.
+		WriteQueueLen() int
+		// WriteQueueCap returns the capacity of the write queue.
+		WriteQueueCap() int
+	}
+	// BuffersWriter is implemented by connections able to write several buffers as one message
+	// without concatenating them first, e.g. with writev. The connection takes ownership of bufs,
+	// neither the slice nor the buffers may be modified afterwards.
+	BuffersWriter interface {
+		WriteBuffers(bufs net.Buffers) (int64, error)
+	}
+	// BatchWriter is implemented by connections able to write several messages with a single
+	// network write, each message being made of the parts that would be passed to WriteMessage.
+	BatchWriter interface {
+		WriteBatch(msgs ...[][]byte) error
+	}
+	// MessageReleaser is implemented by connections reading messages into pooled buffers.
+	// The message loop releases each message once it has been processed.
+	MessageReleaser interface {
+		ReleaseMessage(b []byte)
+	}
+	// WritePolicy is the behavior of a connection whose write queue is full.
+	WritePolicy uint8
+	// AuthHandler authenticates a connection before its message loop starts.
+	// It returns the authenticated user id, or an error describing why the connection is rejected.
+	AuthHandler func(a Agent, addr ClientAddrMessage) (userID string, err error)
 )
+
+// Header returns the value of the request header, or an empty string if the connection has no request.
+func (m ClientAddrMessage) Header(key string) string {
+	if m.Req == nil {
+		return ""
+	}
+	return m.Req.Header.Get(key)
+}
+
+// Query returns the value of the request query parameter, or an empty string if the connection has no request.
+func (m ClientAddrMessage) Query(key string) string {
+	if m.Req == nil {
+		return ""
+	}
+	return m.Req.URL.Query().Get(key)
+}
+
+// Enqueue pushes b to the write queue q according to the policy p.
+// It returns false if the message could not be queued and the connection must be destroyed.
+// With WriteBlock, it waits at most timeout, zero meaning the default timeout.
+// The caller must be the only writer of q.
+func Enqueue[T any](p WritePolicy, q chan T, b T, timeout time.Duration) bool {
+	select {
+	case q <- b:
+		return true
+	default:
+	}
+
+	switch p {
+	case WriteDropOldest:
+		select {
+		case <-q:
+		default:
+		}
+		// The writer goroutine may have consumed the queue meanwhile, there is room either way
+		q <- b
+		return true
+	case WriteBlock:
+		if timeout <= 0 {
+			timeout = defaultWriteBlockTimeout
+		}
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+
+		select {
+		case q <- b:
+			return true
+		case <-t.C:
+			return false
+		}
+	}
+	return false
+}
+
+// EnqueueClose pushes the close sentinel of the writer goroutines, the zero value of T, to the write queue q.
+// The sentinel never evicts a queued message, with WriteDropOldest it waits for room like WriteBlock,
+// so that the last messages before a graceful close are written. See Enqueue for the other policies.
+func EnqueueClose[T any](p WritePolicy, q chan T, timeout time.Duration) bool {
+	if p == WriteDropOldest {
+		p = WriteBlock
+	}
+
+	var sentinel T
+	return Enqueue(p, q, sentinel, timeout)
+}
+
+// RealIP returns the IP of the client for bans and rate limits.
+// The forwarded chain is sent by the client, so it is only trusted when the socket peer is one of
+// the trusted proxies: the chain is then walked from the right, the last proxy first, and the first
+// address that is not a trusted proxy is the client. Otherwise the socket peer is the client.
+// Without trusted proxies, the forwarded chain is ignored.
+func (c ClientAddrMessage) RealIP(trusted ...netip.Prefix) string {
+	peer := c.Peer
+	if len(peer) == 0 {
+		peer = c.IP
+	}
+	if !isTrusted(peer, trusted) {
+		return peer
+	}
+
+	for i := len(c.Forwarded) - 1; i >= 0; i-- {
+		if !isTrusted(c.Forwarded[i], trusted) {
+			return c.Forwarded[i]
+		}
+	}
+	// Only proxies in the chain, the left-most one is the closest to the client
+	if len(c.Forwarded) > 0 {
+		return c.Forwarded[0]
+	}
+	return peer
+}
+
+// isTrusted reports whether ip belongs to one of the trusted prefixes.
+func isTrusted(ip string, trusted []netip.Prefix) bool {
+	if len(trusted) == 0 {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
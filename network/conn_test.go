@@ -0,0 +1,92 @@
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWritePolicy(t *testing.T) {
+	full := func() chan []byte {
+		q := make(chan []byte, 2)
+		q <- []byte("1")
+		q <- []byte("2")
+		return q
+	}
+
+	t.Run("TestDestroy", func(t *testing.T) {
+		if Enqueue(WriteDestroy, full(), []byte("3"), 0) {
+			t.Fatal("expected a full queue to be rejected")
+		}
+	})
+
+	t.Run("TestDropOldest", func(t *testing.T) {
+		q := full()
+		if !Enqueue(WriteDropOldest, q, []byte("3"), 0) {
+			t.Fatal("expected the message to be queued")
+		}
+		if got := string(<-q) + string(<-q); got != "23" {
+			t.Fatalf("got %q, want %q", got, "23")
+		}
+	})
+
+	t.Run("TestBlock", func(t *testing.T) {
+		q := full()
+		if Enqueue(WriteBlock, q, []byte("3"), 10*time.Millisecond) {
+			t.Fatal("expected the write to time out")
+		}
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			<-q
+		}()
+		if !Enqueue(WriteBlock, q, []byte("3"), time.Second) {
+			t.Fatal("expected the message to be queued once room is made")
+		}
+	})
+}
+
+func TestLabelSet(t *testing.T) {
+	var l LabelSet
+	if l.Labels() != nil {
+		t.Fatal("labels of a new set must be nil")
+	}
+
+	l.SetLabel("pop", "fra1")
+	l.SetLabel("version", "1.2.0")
+	labels := l.Labels()
+	labels["pop"] = "changed"
+
+	if got := l.Labels()["pop"]; got != "fra1" {
+		t.Fatalf("pop = %q, want fra1, Labels must return a copy", got)
+	}
+	if got := len(l.Labels()); got != 2 {
+		t.Fatalf("labels = %d, want 2", got)
+	}
+}
+
+func TestEnqueueClose(t *testing.T) {
+	q := make(chan []byte, 2)
+	q <- []byte("1")
+	q <- []byte("2")
+
+	// The sentinel waits for room instead of dropping the oldest message
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-q
+	}()
+	if !EnqueueClose(WriteDropOldest, q, time.Second) {
+		t.Fatal("expected the sentinel to be queued once room is made")
+	}
+	if got := <-q; string(got) != "2" {
+		t.Fatalf("got %q, want the last message before the sentinel", got)
+	}
+	if got := <-q; got != nil {
+		t.Fatalf("got %q, want the nil sentinel", got)
+	}
+
+	q <- []byte("3")
+	q <- []byte("4")
+	if EnqueueClose(WriteDropOldest, q, 10*time.Millisecond) {
+		t.Fatal("expected the sentinel to time out on a stuck queue")
+	}
+}
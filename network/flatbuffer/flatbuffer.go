@@ -1,13 +1,19 @@
 package flatbuffer
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"math"
 	"reflect"
+	"strconv"
+	"time"
 
 	"github.com/czx-lab/czx/network"
+	"github.com/czx-lab/czx/xlog"
 	fb "github.com/google/flatbuffers/go"
+	"go.uber.org/zap"
 )
 
 type (
@@ -21,6 +27,9 @@ type (
 		ids      map[reflect.Type]uint
 		messages map[uint]*message_t
 		option   network.ProcessorConf
+		metrics  network.ProcessorMetrics
+		// fallback handles the messages whose id is not registered
+		fallback network.DefaultHandler
 	}
 )
 
@@ -29,9 +38,25 @@ func NewProcessor(opt network.ProcessorConf) *Processor {
 		ids:      make(map[reflect.Type]uint),
 		messages: make(map[uint]*message_t),
 		option:   opt,
+		metrics:  &network.NoopProcessorMetrics{},
 	}
 }
 
+// WithMetrics sets the metrics for the Processor instance.
+// The duration of every handler call is observed and the marshaled and unmarshaled messages
+// are counted with their size, labeled by message id.
+func (p *Processor) WithMetrics(m network.ProcessorMetrics) *Processor {
+	p.metrics = m
+	return p
+}
+
+// RegisterDefaultHandler sets the handler of the messages whose id is not registered.
+// Without it, such messages fail to decode and the connection is closed.
+func (p *Processor) RegisterDefaultHandler(handler network.DefaultHandler) *Processor {
+	p.fallback = handler
+	return p
+}
+
 // Marshal implements network.Processor.
 func (p *Processor) Marshal(msgs any) ([][]byte, error) {
 	type_t := reflect.TypeOf(msgs)
@@ -52,6 +77,7 @@ func (p *Processor) Marshal(msgs any) ([][]byte, error) {
 	data := make([]byte, len(raw))
 	copy(data, raw)
 
+	p.metrics.AddMessage(strconv.FormatUint(uint64(id), 10), network.MessageOut, len(msgid)+len(data))
 	return [][]byte{msgid, data}, nil
 }
 
@@ -72,6 +98,20 @@ func (p *Processor) MarshalWithCode(code uint, msg any) ([][]byte, error) {
 
 // Process implements network.Processor.
 func (p *Processor) Process(data any, agent network.Agent) error {
+	return p.ProcessCtx(context.Background(), data, agent)
+}
+
+// ProcessCtx implements network.ContextProcessor.
+func (p *Processor) ProcessCtx(ctx context.Context, data any, agent network.Agent) error {
+	if unknown, ok := data.(*network.UnknownMessage); ok {
+		if p.fallback != nil {
+			p.fallback(unknown.ID, unknown.Data, agent)
+			return nil
+		}
+		xlog.Write().Debug("flatbuffers: unknown message skipped", zap.Uint("id", unknown.ID))
+		return nil
+	}
+
 	type_t := reflect.TypeOf(data)
 	id, ok := p.ids[type_t]
 	if !ok {
@@ -83,7 +123,9 @@ func (p *Processor) Process(data any, agent network.Agent) error {
 		return fmt.Errorf("message id %v not registered", id)
 	}
 	if info.handler != nil {
-		info.handler([]any{data, agent})
+		start_t := time.Now()
+		info.handler([]any{data, agent, ctx})
+		p.metrics.ObserveHandlerDuration(strconv.FormatUint(uint64(id), 10), time.Since(start_t))
 	}
 
 	return nil
@@ -141,8 +183,13 @@ func (p *Processor) Unmarshal(data []byte) (any, error) {
 
 	info, ok := p.messages[id]
 	if !ok {
+		p.metrics.AddMessage(network.MessageUnknown, network.MessageIn, len(data))
+		if p.fallback != nil || p.option.IgnoreUnknown {
+			return &network.UnknownMessage{ID: id, Data: bytes.Clone(data[p.option.IDLength:])}, nil
+		}
 		return nil, fmt.Errorf("flatbuffers: message ID %d not registered", id)
 	}
+	p.metrics.AddMessage(strconv.FormatUint(uint64(id), 10), network.MessageIn, len(data))
 
 	instance := reflect.New(info.type_.Elem()).Interface()
 	msg, ok := instance.(interface{ Init([]byte, fb.UOffsetT) })
@@ -159,4 +206,14 @@ func (p *Processor) Unmarshal(data []byte) (any, error) {
 	return instance, nil
 }
 
-var _ network.Processor = (*Processor)(nil)
+// Range calls fn for every registered message with its id and type, e.g. to dump the message table.
+func (p *Processor) Range(fn func(id uint, msgtype reflect.Type)) {
+	for _, i := range p.messages {
+		fn(i.id, i.type_)
+	}
+}
+
+var (
+	_ network.Processor        = (*Processor)(nil)
+	_ network.ContextProcessor = (*Processor)(nil)
+)
@@ -1,16 +1,19 @@
 package network
 
 import (
-	"bufio"
-	"errors"
+	"crypto/tls"
 	"net"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 )
 
 // https://www.cnblogs.com/flydean/p/16356050.html
-// GetClientIPFromProxyProtocol retrieves the client's IP address and port from the Proxy Protocol header if present.
-// If the header is not present, it falls back to the remote address of the connection.
+// GetClientIPFromProxyProtocol retrieves the client's IP address and port announced by the Proxy Protocol header.
+// The header must have been consumed beforehand by wrapping the connection with NewProxyConn,
+// which supports both the v1 text and v2 binary formats.
+// If the connection is not a ProxyConn, it falls back to the remote address of the connection.
 // nginx configuration example:
 // ```
 //
@@ -37,28 +40,16 @@ import (
 func GetClientIPFromProxyProtocol(conn net.Conn) (ip, port *string, err error) {
 	ip = new(string)
 	port = new(string)
-	reader := bufio.NewReader(conn)
-	line, err := reader.ReadString('\n')
-	if err != nil {
-		return
-	}
-
-	if strings.HasPrefix(line, "PROXY") {
-		parts := strings.Split(line, " ")
-		if len(parts) >= 5 {
-			*ip = strings.TrimSpace(parts[2])   // Client IP
-			*port = strings.TrimSpace(parts[4]) // Client port
-			return
-		}
 
-		return nil, nil, errors.New("invalid proxy protocol header")
+	addr := conn.RemoteAddr()
+	if pc, ok := conn.(*ProxyConn); ok {
+		addr = pc.SourceAddr()
 	}
 
-	// If no Proxy Protocol header, fallback to remote address
-	host, rport, err := net.SplitHostPort(conn.RemoteAddr().String())
+	host, rport, err := net.SplitHostPort(addr.String())
 	if err != nil {
-		*ip = conn.RemoteAddr().String()
-		return
+		*ip = addr.String()
+		return ip, port, nil
 	}
 
 	*ip = host
@@ -112,3 +103,83 @@ func GetClientIP(r *http.Request) (ip, port *string) {
 
 	return
 }
+
+// ConnClientAddr returns the client address of a stream connection, see GetClientIPFromProxyProtocol.
+// The PROXY protocol source is reported in Forwarded, the proxy in Peer, and the TLS state of a *tls.Conn in TLS.
+func ConnClientAddr(conn net.Conn) ClientAddrMessage {
+	ip, port, _ := GetClientIPFromProxyProtocol(conn)
+	msg := ClientAddrMessage{IP: *ip, Port: *port}
+
+	if pc, ok := conn.(*ProxyConn); ok && pc.SourceAddr().String() != pc.Conn.RemoteAddr().String() {
+		msg.Forwarded = []string{*ip}
+		conn = pc.Conn
+	}
+	msg.Peer = host(conn.RemoteAddr().String())
+	if tc, ok := conn.(*tls.Conn); ok {
+		state := tc.ConnectionState()
+		msg.TLS = &state
+	}
+	return msg
+}
+
+// RequestClientAddr returns the client address of a WebSocket upgrade request, see GetClientIP.
+// The X-Forwarded-For chain is reported in Forwarded and the remote address of the request in Peer.
+func RequestClientAddr(r *http.Request) ClientAddrMessage {
+	ip, port := GetClientIP(r)
+	return ClientAddrMessage{
+		IP:        *ip,
+		Port:      *port,
+		Peer:      host(r.RemoteAddr),
+		Req:       r,
+		Headers:   r.Header,
+		Forwarded: ForwardedFor(r),
+		TLS:       r.TLS,
+	}
+}
+
+// ForwardedFor returns the valid addresses of the X-Forwarded-For header of the request, the client first.
+func ForwardedFor(r *http.Request) []string {
+	var ips []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for ip := range strings.SplitSeq(header, ",") {
+			ip = strings.TrimSpace(ip)
+			if net.ParseIP(ip) != nil {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return ips
+}
+
+// host returns the host of a host:port address, or the address itself if it has no port.
+func host(addr string) string {
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		return h
+	}
+	return addr
+}
+
+// WaitTimeout waits for the wait group to complete, at most timeout if it is positive.
+// It returns false if the timeout elapsed first, the wait group is then left as is.
+func WaitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	if timeout <= 0 {
+		wg.Wait()
+		return true
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-t.C:
+		return false
+	}
+}
@@ -0,0 +1,78 @@
+package network
+
+import (
+	"net"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRequestClientAddr(t *testing.T) {
+	r := httptest.NewRequest("GET", "/ws", nil)
+	r.RemoteAddr = "10.0.0.2:4000"
+	r.Header.Add("X-Forwarded-For", "203.0.113.7, bogus")
+	r.Header.Add("X-Forwarded-For", "10.0.0.1")
+
+	addr := RequestClientAddr(r)
+	if !slices.Equal(addr.Forwarded, []string{"203.0.113.7", "10.0.0.1"}) {
+		t.Fatalf("forwarded = %v", addr.Forwarded)
+	}
+	if addr.Peer != "10.0.0.2" || addr.Headers.Get("X-Forwarded-For") == "" {
+		t.Fatalf("got %+v", addr)
+	}
+	// The chain is only trusted behind a trusted proxy
+	if ip := addr.RealIP(); ip != "10.0.0.2" {
+		t.Fatalf("real ip = %s, want the socket peer", ip)
+	}
+	if ip := addr.RealIP(netip.MustParsePrefix("10.0.0.0/8")); ip != "203.0.113.7" {
+		t.Fatalf("real ip = %s, want 203.0.113.7", ip)
+	}
+
+	direct := RequestClientAddr(httptest.NewRequest("GET", "/ws", nil))
+	if len(direct.Forwarded) != 0 || direct.RealIP() != "192.0.2.1" {
+		t.Fatalf("got %+v, want the socket peer", direct)
+	}
+}
+
+func TestConnClientAddr(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	go client.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"))
+	pc, err := NewProxyConn(server, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := ConnClientAddr(pc)
+	if addr.IP != "192.0.2.1" || addr.Port != "56324" || !slices.Equal(addr.Forwarded, []string{"192.0.2.1"}) {
+		t.Fatalf("got %+v", addr)
+	}
+	if addr.TLS != nil || addr.Peer != "pipe" {
+		t.Fatalf("got %+v", addr)
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::/32")}
+	tests := []struct {
+		name string
+		addr ClientAddrMessage
+		want string
+	}{
+		{"direct", ClientAddrMessage{IP: "198.51.100.9"}, "198.51.100.9"},
+		{"forged by the client", ClientAddrMessage{IP: "1.2.3.4", Peer: "198.51.100.9", Forwarded: []string{"1.2.3.4"}}, "198.51.100.9"},
+		{"forged behind a proxy", ClientAddrMessage{Peer: "10.0.0.2", Forwarded: []string{"1.2.3.4", "198.51.100.9", "10.0.0.1"}}, "198.51.100.9"},
+		{"ipv6 proxy", ClientAddrMessage{Peer: "2001:db8::1", Forwarded: []string{"198.51.100.9"}}, "198.51.100.9"},
+		{"proxies only", ClientAddrMessage{Peer: "10.0.0.2", Forwarded: []string{"10.0.0.3"}}, "10.0.0.3"},
+		{"no chain", ClientAddrMessage{Peer: "10.0.0.2"}, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		if got := tt.addr.RealIP(proxies...); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
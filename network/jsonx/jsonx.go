@@ -1,12 +1,16 @@
 package jsonx
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/czx-lab/czx/network"
+	"github.com/czx-lab/czx/xlog"
+	"go.uber.org/zap"
 )
 
 type (
@@ -14,15 +18,24 @@ type (
 		conf network.ProcessorConf
 		// messages registered by id
 		messages map[string]*message
+		metrics  network.ProcessorMetrics
+		// fallback handles the messages whose name is not registered
+		fallback DefaultHandler
 	}
 	message struct {
 		name    string
 		msgtype reflect.Type
 		handler network.Handler
 	}
+	// DefaultHandler handles the messages whose name is not registered, instead of closing the connection.
+	DefaultHandler func(name string, raw json.RawMessage, agent network.Agent)
 )
 
-var _ network.Processor = (*Processor)(nil)
+var (
+	_ network.Processor        = (*Processor)(nil)
+	_ network.ContextProcessor = (*Processor)(nil)
+	_ network.MessageNamer     = (*Processor)(nil)
+)
 
 // NewProcessor creates a new json processor.
 // It is used for json messages that are registered by id.
@@ -30,9 +43,24 @@ func NewProcessor(conf network.ProcessorConf) *Processor {
 	return &Processor{
 		conf:     conf,
 		messages: make(map[string]*message),
+		metrics:  &network.NoopProcessorMetrics{},
 	}
 }
 
+// WithMetrics sets the metrics for the Processor instance.
+// The duration of every handler call is observed, labeled by message name.
+func (p *Processor) WithMetrics(m network.ProcessorMetrics) *Processor {
+	p.metrics = m
+	return p
+}
+
+// RegisterDefaultHandler sets the handler of the messages whose name is not registered.
+// Without it, such messages fail to decode and the connection is closed.
+func (p *Processor) RegisterDefaultHandler(handler DefaultHandler) *Processor {
+	p.fallback = handler
+	return p
+}
+
 // Marshal implements network.Processor.
 func (p *Processor) Marshal(msgs any) ([][]byte, error) {
 	msgtype := reflect.TypeOf(msgs)
@@ -67,18 +95,39 @@ func (p *Processor) MarshalWithCode(code uint, msg any) ([][]byte, error) {
 
 // Process implements network.Processor.
 func (p *Processor) Process(data any, agent network.Agent) error {
+	return p.ProcessCtx(context.Background(), data, agent)
+}
+
+// ProcessCtx implements network.ContextProcessor.
+func (p *Processor) ProcessCtx(ctx context.Context, data any, agent network.Agent) error {
+	if unknown, ok := data.(*network.UnknownMessage); ok {
+		if p.fallback != nil {
+			p.fallback(unknown.Name, json.RawMessage(unknown.Data), agent)
+			return nil
+		}
+		xlog.Write().Debug("json: unknown message skipped", zap.String("name", unknown.Name))
+		return nil
+	}
+
 	msgname := reflect.TypeOf(data).Elem().Name()
 	info, ok := p.messages[msgname]
 	if !ok {
 		return fmt.Errorf("message %s not registered", msgname)
 	}
 	if info.handler != nil {
-		info.handler([]any{data, agent})
+		start_t := time.Now()
+		info.handler([]any{data, agent, ctx})
+		p.metrics.ObserveHandlerDuration(msgname, time.Since(start_t))
 	}
 
 	return nil
 }
 
+// MessageName implements network.MessageNamer, messages are named by type name.
+func (p *Processor) MessageName(msg any) string {
+	return reflect.TypeOf(msg).Elem().Name()
+}
+
 // Register implements network.Processor.
 func (p *Processor) Register(msg network.Message) error {
 	msgtype := reflect.TypeOf(msg.Data)
@@ -120,6 +169,13 @@ func (p *Processor) RegisterHandler(msg any, handler network.Handler) error {
 	return nil
 }
 
+// Range calls fn for every registered message with its name and type, e.g. to dump the message table.
+func (p *Processor) Range(fn func(name string, msgtype reflect.Type)) {
+	for _, i := range p.messages {
+		fn(i.name, i.msgtype)
+	}
+}
+
 // Unmarshal implements network.Processor.
 func (p *Processor) Unmarshal(data []byte) (any, error) {
 	var m map[string]json.RawMessage
@@ -133,6 +189,10 @@ func (p *Processor) Unmarshal(data []byte) (any, error) {
 	for msgname, data := range m {
 		info, ok := p.messages[msgname]
 		if !ok {
+			if p.fallback != nil || p.conf.IgnoreUnknown {
+				// data is unmarshaled into a new slice, it does not alias the buffer
+				return &network.UnknownMessage{Name: msgname, Data: data}, nil
+			}
 			return nil, fmt.Errorf("message %v not registered", msgname)
 		}
 
@@ -0,0 +1,36 @@
+package network
+
+import (
+	"maps"
+	"sync"
+)
+
+// LabelSet holds the labels of a connection, e.g. the load balancer or the client version
+// detected at accept time. Connections embed it to implement Conn.SetLabel and Conn.Labels.
+// The zero value is ready to use.
+type LabelSet struct {
+	mu     sync.RWMutex
+	labels map[string]string
+}
+
+// SetLabel sets the value of a label, replacing the previous one.
+func (l *LabelSet) SetLabel(key, value string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.labels == nil {
+		l.labels = make(map[string]string)
+	}
+	l.labels[key] = value
+}
+
+// Labels returns a copy of the labels, nil if none is set.
+func (l *LabelSet) Labels() map[string]string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if len(l.labels) == 0 {
+		return nil
+	}
+	return maps.Clone(l.labels)
+}
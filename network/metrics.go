@@ -28,6 +28,10 @@ type ServerMetrics interface {
 	// Increment the count of write errors encountered
 	IncWriteErrors()
 
+	// Write queue metrics
+	// Observe the depth of a connection write queue against its capacity, sampled on each write
+	ObserveWriteQueueDepth(depth, capacity int)
+
 	// Shutdown the metrics tracking system
 	Close() error
 }
@@ -64,4 +68,42 @@ func (n *NoopServerMetrics) IncWriteErrors() {}
 // ObserveConnDuration implements ServerMetrics.
 func (n *NoopServerMetrics) ObserveConnDuration(duration time.Duration) {}
 
+// ObserveWriteQueueDepth implements ServerMetrics.
+func (n *NoopServerMetrics) ObserveWriteQueueDepth(depth, capacity int) {}
+
 var _ ServerMetrics = (*NoopServerMetrics)(nil)
+
+// Directions of the messages counted by ProcessorMetrics.AddMessage
+const (
+	MessageIn  = "in"
+	MessageOut = "out"
+)
+
+// MessageUnknown is the message label of the inbound messages whose id is not registered.
+// The ids are chosen by the clients, they are not used as labels to bound the number of series.
+const MessageUnknown = "unknown"
+
+// ProcessorMetrics defines the interface for message processor metrics tracking.
+type ProcessorMetrics interface {
+	// Observe the duration of a message handler call
+	ObserveHandlerDuration(message string, duration time.Duration)
+	// Count a message and its size in bytes, dir is MessageIn for unmarshaled messages
+	// and MessageOut for marshaled ones
+	AddMessage(message, dir string, size int)
+
+	// Shutdown the metrics tracking system
+	Close() error
+}
+
+type NoopProcessorMetrics struct{}
+
+// Close implements ProcessorMetrics.
+func (n *NoopProcessorMetrics) Close() error { return nil }
+
+// ObserveHandlerDuration implements ProcessorMetrics.
+func (n *NoopProcessorMetrics) ObserveHandlerDuration(message string, duration time.Duration) {}
+
+// AddMessage implements ProcessorMetrics.
+func (n *NoopProcessorMetrics) AddMessage(message, dir string, size int) {}
+
+var _ ProcessorMetrics = (*NoopProcessorMetrics)(nil)
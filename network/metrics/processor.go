@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/czx-lab/czx/metrics"
+	"github.com/czx-lab/czx/network"
+	"github.com/czx-lab/czx/prometheus"
+)
+
+type (
+	// ProcMetrics holds the metrics related to message processing
+	ProcMetrics struct {
+		handlerDuration metrics.Histogram
+		messages        metrics.Counter
+		messageBytes    metrics.Counter
+	}
+	// ProcMetricsConf defines the configuration for processor metrics
+	ProcMetricsConf struct {
+		Namespace string
+		Subsystem string
+		// Buckets of the handler duration histogram in seconds, defaults to the prometheus default buckets
+		Buckets []float64
+	}
+)
+
+var _ network.ProcessorMetrics = (*ProcMetrics)(nil)
+
+// NewProcMetrics creates and initializes a new ProcMetrics instance based on the provided configuration.
+// It sets up a histogram of the handler duration labeled by message, so the latency of every
+// message type can be tracked separately, and counters of the messages and bytes labeled by
+// message and direction, showing which messages dominate the traffic.
+func NewProcMetrics(conf ProcMetricsConf) *ProcMetrics {
+	return &ProcMetrics{
+		handlerDuration: metrics.NewHistogram(&metrics.HistogramVecOpts{
+			VectorOption: metrics.VectorOption{
+				Namespace: conf.Namespace,
+				Subsystem: conf.Subsystem,
+				Name:      "handler_duration_seconds",
+				Help:      "message handler duration in seconds",
+				Labels:    []string{"message"},
+			},
+			Buckets: conf.Buckets,
+		}),
+		messages: metrics.NewCounter(&metrics.VectorOption{
+			Namespace: conf.Namespace,
+			Subsystem: conf.Subsystem,
+			Name:      "messages_total",
+			Help:      "total number of messages marshaled or unmarshaled",
+			Labels:    []string{"message", "dir"},
+		}),
+		messageBytes: metrics.NewCounter(&metrics.VectorOption{
+			Namespace: conf.Namespace,
+			Subsystem: conf.Subsystem,
+			Name:      "message_bytes_total",
+			Help:      "total size of the messages marshaled or unmarshaled",
+			Labels:    []string{"message", "dir"},
+		}),
+	}
+}
+
+// NewProcessorMetrics returns the processor metrics for the configuration when prometheus is enabled,
+// and a no-op implementation otherwise.
+func NewProcessorMetrics(conf ProcMetricsConf) network.ProcessorMetrics {
+	if !prometheus.Enabled() {
+		return &network.NoopProcessorMetrics{}
+	}
+	return NewProcMetrics(conf)
+}
+
+// Close implements network.ProcessorMetrics.
+func (p *ProcMetrics) Close() error {
+	return errors.Join(p.handlerDuration.Close(), p.messages.Close(), p.messageBytes.Close())
+}
+
+// ObserveHandlerDuration implements network.ProcessorMetrics.
+func (p *ProcMetrics) ObserveHandlerDuration(message string, duration time.Duration) {
+	p.handlerDuration.Observe(duration.Seconds(), message)
+}
+
+// AddMessage implements network.ProcessorMetrics.
+func (p *ProcMetrics) AddMessage(message, dir string, size int) {
+	p.messages.Inc(message, dir)
+	p.messageBytes.Add(float64(size), message, dir)
+}
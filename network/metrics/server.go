@@ -1,15 +1,31 @@
 package metrics
 
 import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/czx-lab/czx/metrics"
 	"github.com/czx-lab/czx/network"
+	"github.com/czx-lab/czx/prometheus"
+
+	prom "github.com/prometheus/client_golang/prometheus"
 )
 
 type (
-	// SvrMetrics holds various metrics related to server performance and operations
+	// SvrMetrics holds various metrics related to server performance and operations.
+	// It reports to vectors shared by all the servers with the same namespace, subsystem and
+	// constant labels, see NewSvrMetrics.
 	SvrMetrics struct {
+		vecs *svrVecs
+		// transport label value of the server
+		transport string
+	}
+	// svrVecs are the metric vectors of the servers, labeled by transport
+	svrVecs struct {
 		// connection metrics
 		activeConns  metrics.Gauge
 		totalConns   metrics.Counter
@@ -21,74 +37,137 @@ type (
 
 		// error metrics
 		errors metrics.Counter
+
+		// write queue metrics
+		writeQueueUsage metrics.Histogram
+	}
+	// svrVecsKey identifies the vectors of a registry sharing the same names and constant labels
+	svrVecsKey struct {
+		reg                  *prom.Registry
+		namespace, subsystem string
+		labels               string
 	}
 	// SvrMetricsConf defines the configuration for server metrics
 	SvrMetricsConf struct {
 		Namespace string
 		Subsystem string
+		// Labels are constant labels attached to all the server metrics, e.g. the instance name
+		Labels map[string]string
+		// Transport is set by each server (ws/tcp/gnet/kcp/udp) and attached as the transport label
+		Transport string
 	}
 )
 
-var _ network.ServerMetrics = (*SvrMetrics)(nil)
+var (
+	_ network.ServerMetrics = (*SvrMetrics)(nil)
+
+	// vecs are created once per registry and configuration, so that several servers,
+	// e.g. the WebSocket and TCP servers of a gate, do not register the same metrics twice
+	vecsMu sync.Mutex
+	vecs   = make(map[svrVecsKey]*svrVecs)
+)
 
 // NewSvrMetrics creates and initializes a new SvrMetrics instance based on the provided configuration.
 // It sets up various gauges, counters, and histograms to monitor server performance.
 // The metrics include active connections, total connections, bytes received/sent, connection duration, and error counts.
-// These metrics can be used for monitoring and analyzing server behavior over time.
+// The servers with the same Namespace, Subsystem and Labels share the same vectors, each one
+// reporting under its own transport label, so their metrics can be aggregated.
 // Returns a pointer to the initialized SvrMetrics instance.
 func NewSvrMetrics(conf SvrMetricsConf) *SvrMetrics {
-	return &SvrMetrics{
+	key := svrVecsKey{
+		reg:       prometheus.Registry(),
+		namespace: conf.Namespace,
+		subsystem: conf.Subsystem,
+		labels:    conf.labelsKey(),
+	}
+
+	vecsMu.Lock()
+	defer vecsMu.Unlock()
+
+	v, ok := vecs[key]
+	if !ok {
+		v = newSvrVecs(conf)
+		vecs[key] = v
+	}
+	return &SvrMetrics{vecs: v, transport: conf.Transport}
+}
+
+func newSvrVecs(conf SvrMetricsConf) *svrVecs {
+	labels := conf.Labels
+	return &svrVecs{
 		activeConns: metrics.NewGauge(&metrics.VectorOption{
-			Namespace: conf.Namespace,
-			Subsystem: conf.Subsystem,
-			Name:      "active_connections",
-			Help:      "current number of active connections",
+			Namespace:   conf.Namespace,
+			Subsystem:   conf.Subsystem,
+			Name:        "active_connections",
+			Help:        "current number of active connections",
+			Labels:      []string{"transport"},
+			ConstLabels: labels,
 		}),
 		totalConns: metrics.NewCounter(&metrics.VectorOption{
-			Namespace: conf.Namespace,
-			Subsystem: conf.Subsystem,
-			Name:      "connections_total",
-			Help:      "total number of connections",
+			Namespace:   conf.Namespace,
+			Subsystem:   conf.Subsystem,
+			Name:        "connections_total",
+			Help:        "total number of connections",
+			Labels:      []string{"transport"},
+			ConstLabels: labels,
 		}),
 		receivedBytes: metrics.NewCounter(&metrics.VectorOption{
-			Namespace: conf.Namespace,
-			Subsystem: conf.Subsystem,
-			Name:      "received_bytes_total",
-			Help:      "total bytes received",
+			Namespace:   conf.Namespace,
+			Subsystem:   conf.Subsystem,
+			Name:        "received_bytes_total",
+			Help:        "total bytes received",
+			Labels:      []string{"transport"},
+			ConstLabels: labels,
 		}),
 		sentBytes: metrics.NewCounter(&metrics.VectorOption{
-			Namespace: conf.Namespace,
-			Subsystem: conf.Subsystem,
-			Name:      "sent_bytes_total",
-			Help:      "total bytes sent",
+			Namespace:   conf.Namespace,
+			Subsystem:   conf.Subsystem,
+			Name:        "sent_bytes_total",
+			Help:        "total bytes sent",
+			Labels:      []string{"transport"},
+			ConstLabels: labels,
 		}),
 		connDuration: metrics.NewHistogram(&metrics.HistogramVecOpts{
 			VectorOption: metrics.VectorOption{
-				Namespace: conf.Namespace,
-				Subsystem: conf.Subsystem,
-				Name:      "connection_duration_seconds",
-				Help:      "connection duration in seconds",
+				Namespace:   conf.Namespace,
+				Subsystem:   conf.Subsystem,
+				Name:        "connection_duration_seconds",
+				Help:        "connection duration in seconds",
+				Labels:      []string{"transport"},
+				ConstLabels: labels,
 			},
 			Buckets: []float64{1, 10, 60, 300, 600, 1800, 3600},
 		}),
 		errors: metrics.NewCounter(&metrics.VectorOption{
-			Namespace: conf.Namespace,
-			Subsystem: conf.Subsystem,
-			Name:      "errors_total",
-			Help:      "Total errors by type",
-			Labels:    []string{"type"}, // read/write/parse/upgrade/connect
+			Namespace:   conf.Namespace,
+			Subsystem:   conf.Subsystem,
+			Name:        "errors_total",
+			Help:        "Total errors by type",
+			Labels:      []string{"transport", "type"}, // read/write/parse/upgrade/connect
+			ConstLabels: labels,
+		}),
+		writeQueueUsage: metrics.NewHistogram(&metrics.HistogramVecOpts{
+			VectorOption: metrics.VectorOption{
+				Namespace:   conf.Namespace,
+				Subsystem:   conf.Subsystem,
+				Name:        "write_queue_usage_ratio",
+				Help:        "connection write queue depth relative to its capacity",
+				Labels:      []string{"transport"},
+				ConstLabels: labels,
+			},
+			Buckets: []float64{0.1, 0.25, 0.5, 0.75, 0.9, 1},
 		}),
 	}
 }
 
 // AddReceivedBytes implements network.ServerMetrics.
 func (s *SvrMetrics) AddReceivedBytes(bytes int) {
-	s.receivedBytes.Add(float64(bytes))
+	s.vecs.receivedBytes.Add(float64(bytes), s.transport)
 }
 
 // AddSentBytes implements network.ServerMetrics.
 func (s *SvrMetrics) AddSentBytes(bytes int) {
-	s.sentBytes.Add(float64(bytes))
+	s.vecs.sentBytes.Add(float64(bytes), s.transport)
 }
 
 // Close implements network.ServerMetrics.
@@ -98,35 +177,54 @@ func (s *SvrMetrics) Close() error {
 
 // DecConns implements network.ServerMetrics.
 func (s *SvrMetrics) DecConns() {
-	s.activeConns.Dec()
+	s.vecs.activeConns.Dec(s.transport)
 }
 
 // IncConns implements network.ServerMetrics.
 func (s *SvrMetrics) IncConns() {
-	s.activeConns.Inc()
+	s.vecs.activeConns.Inc(s.transport)
 }
 
 // IncFailedConns implements network.ServerMetrics.
 func (s *SvrMetrics) IncFailedConns() {
-	s.errors.Inc("connect")
+	s.vecs.errors.Inc(s.transport, "connect")
 }
 
 // IncReadErrors implements network.ServerMetrics.
 func (s *SvrMetrics) IncReadErrors() {
-	s.errors.Inc("read")
+	s.vecs.errors.Inc(s.transport, "read")
 }
 
 // IncTotalConns implements network.ServerMetrics.
 func (s *SvrMetrics) IncTotalConns() {
-	s.totalConns.Inc()
+	s.vecs.totalConns.Inc(s.transport)
 }
 
 // IncWriteErrors implements network.ServerMetrics.
 func (s *SvrMetrics) IncWriteErrors() {
-	s.errors.Inc("write")
+	s.vecs.errors.Inc(s.transport, "write")
 }
 
 // ObserveConnDuration implements network.ServerMetrics.
 func (s *SvrMetrics) ObserveConnDuration(duration time.Duration) {
-	s.connDuration.Observe(duration.Seconds())
+	s.vecs.connDuration.Observe(duration.Seconds(), s.transport)
+}
+
+// ObserveWriteQueueDepth implements network.ServerMetrics.
+// The depth is recorded as a ratio of the capacity so connections with different queue sizes can be compared.
+func (s *SvrMetrics) ObserveWriteQueueDepth(depth, capacity int) {
+	if capacity <= 0 {
+		return
+	}
+	s.vecs.writeQueueUsage.Observe(float64(depth)/float64(capacity), s.transport)
+}
+
+// labelsKey returns the constant labels of the configuration in a canonical form.
+func (conf SvrMetricsConf) labelsKey() string {
+	keys := slices.Sorted(maps.Keys(conf.Labels))
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%q=%q,", k, conf.Labels[k])
+	}
+	return b.String()
 }
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/czx-lab/czx/prometheus"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSvrMetricsShared(t *testing.T) {
+	if err := prometheus.UseRegistry(prom.NewRegistry()); err != nil {
+		t.Fatal(err)
+	}
+	defer prometheus.UseRegistry(nil)
+	prometheus.Enable()
+
+	conf := SvrMetricsConf{Namespace: "czx", Subsystem: "gate", Labels: map[string]string{"instance": "1"}}
+	servers := make(map[string]*SvrMetrics)
+	// A second server of the same transport must not panic either
+	for _, transport := range []string{"ws", "tcp", "tcp"} {
+		conf.Transport = transport
+		servers[transport] = NewSvrMetrics(conf)
+	}
+	servers["ws"].IncConns()
+	servers["tcp"].IncConns()
+	servers["tcp"].IncConns()
+	servers["tcp"].IncReadErrors()
+
+	rec := httptest.NewRecorder()
+	prometheus.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`czx_gate_active_connections{instance="1",transport="tcp"} 2`,
+		`czx_gate_active_connections{instance="1",transport="ws"} 1`,
+		`czx_gate_errors_total{instance="1",transport="tcp",type="read"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Fatalf("%q not exposed", want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package network
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 
@@ -24,10 +25,13 @@ type (
 		LittleEndian bool
 		IDLength     IDCodeLenType // 1, 2, or 4 bytes for the message ID
 		CodeLength   IDCodeLenType // 1, 2, or 4 bytes for the status code (optional)
+		// IgnoreUnknown skips the messages that are not registered instead of closing the connection,
+		// e.g. for clients sending message types newer than the server. A default handler takes precedence.
+		IgnoreUnknown bool
 	}
 
-	// Processor defines the interface for processing messages.
-	// It includes methods for processing, unmarshalling, and marshalling messages.
+	// Handler handles a message, its arguments are the message, the Agent and the connection context,
+	// see HandlerArgs and HandlerContext.
 	Handler func([]any)
 
 	// Message represents a message type with an ID and data.
@@ -88,6 +92,23 @@ type (
 		// RegisterHandler registers a handler for a message type.
 		RegisterHandler(msg any, handler Handler) error
 	}
+	// UnknownMessage is returned by Unmarshal for a message that is not registered, when the processor
+	// has a default handler or ignores unknown messages. Data is a copy of the payload, without the message id.
+	UnknownMessage struct {
+		// ID of the message, for processors identifying messages by id
+		ID uint
+		// Name of the message, for the json processor
+		Name string
+		Data []byte
+	}
+	// DefaultHandler handles the messages whose id is not registered, instead of closing the connection.
+	DefaultHandler func(id uint, data []byte, agent Agent)
+	// ContextProcessor is implemented by processors passing a context to the handlers.
+	// The agent message loop uses it with a context cancelled when the connection is closed.
+	ContextProcessor interface {
+		// ProcessCtx handles the incoming data like Process, with the context passed to the handler.
+		ProcessCtx(ctx context.Context, data any, agent Agent) error
+	}
 )
 
 // HandlerArgs extracts the typed message and Agent from the handler arguments.
@@ -95,6 +116,17 @@ func HandlerArgs[T any](args []any) (T, Agent) {
 	return args[0].(T), args[1].(Agent)
 }
 
+// HandlerContext extracts the context from the handler arguments.
+// It returns context.Background if the message was processed without context.
+func HandlerContext(args []any) context.Context {
+	if len(args) > 2 {
+		if ctx, ok := args[2].(context.Context); ok {
+			return ctx
+		}
+	}
+	return context.Background()
+}
+
 // PutCode writes the status code into the provided buffer according to the configured code length and endianness.
 func PutCode(buffer []byte, code uint, conf ProcessorConf) {
 	switch conf.CodeLength {
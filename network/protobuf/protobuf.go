@@ -1,12 +1,18 @@
 package protobuf
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"math"
 	"reflect"
+	"strconv"
+	"time"
 
 	"github.com/czx-lab/czx/network"
+	"github.com/czx-lab/czx/xlog"
+	"go.uber.org/zap"
 
 	"google.golang.org/protobuf/proto"
 )
@@ -25,6 +31,9 @@ type (
 		ids      map[reflect.Type]uint
 		messages map[uint]*message
 		option   network.ProcessorConf
+		metrics  network.ProcessorMetrics
+		// fallback handles the messages whose id is not registered
+		fallback network.DefaultHandler
 	}
 )
 
@@ -33,9 +42,25 @@ func NewProcessor(opt network.ProcessorConf) *Processor {
 		ids:      make(map[reflect.Type]uint),
 		messages: make(map[uint]*message),
 		option:   opt,
+		metrics:  &network.NoopProcessorMetrics{},
 	}
 }
 
+// WithMetrics sets the metrics for the Processor instance.
+// The duration of every handler call is observed and the marshaled and unmarshaled messages
+// are counted with their size, labeled by message id.
+func (p *Processor) WithMetrics(m network.ProcessorMetrics) *Processor {
+	p.metrics = m
+	return p
+}
+
+// RegisterDefaultHandler sets the handler of the messages whose id is not registered.
+// Without it, such messages fail to decode and the connection is closed.
+func (p *Processor) RegisterDefaultHandler(handler network.DefaultHandler) *Processor {
+	p.fallback = handler
+	return p
+}
+
 // Marshal implements network.Processor.
 func (p *Processor) Marshal(msg any) ([][]byte, error) {
 	msgtype := reflect.TypeOf(msg)
@@ -49,7 +74,12 @@ func (p *Processor) Marshal(msg any) ([][]byte, error) {
 	network.PutID(msgid, id, p.option)
 
 	data, err := proto.Marshal(msg.(proto.Message))
-	return [][]byte{msgid, data}, err
+	if err != nil {
+		return nil, err
+	}
+
+	p.metrics.AddMessage(strconv.FormatUint(uint64(id), 10), network.MessageOut, len(msgid)+len(data))
+	return [][]byte{msgid, data}, nil
 }
 
 // MarshalWithCode implements network.Processor.
@@ -69,6 +99,20 @@ func (p *Processor) MarshalWithCode(code uint, msg any) ([][]byte, error) {
 
 // Process implements network.Processor.
 func (p *Processor) Process(data any, agent network.Agent) error {
+	return p.ProcessCtx(context.Background(), data, agent)
+}
+
+// ProcessCtx implements network.ContextProcessor.
+func (p *Processor) ProcessCtx(ctx context.Context, data any, agent network.Agent) error {
+	if unknown, ok := data.(*network.UnknownMessage); ok {
+		if p.fallback != nil {
+			p.fallback(unknown.ID, unknown.Data, agent)
+			return nil
+		}
+		xlog.Write().Debug("protobuf: unknown message skipped", zap.Uint("id", unknown.ID))
+		return nil
+	}
+
 	msgtype := reflect.TypeOf(data)
 	id, ok := p.ids[msgtype]
 	if !ok {
@@ -80,12 +124,23 @@ func (p *Processor) Process(data any, agent network.Agent) error {
 		return fmt.Errorf("message id %v not registered", id)
 	}
 	if info.handler != nil {
-		info.handler([]any{data, agent})
+		start_t := time.Now()
+		info.handler([]any{data, agent, ctx})
+		p.metrics.ObserveHandlerDuration(strconv.FormatUint(uint64(id), 10), time.Since(start_t))
 	}
 
 	return nil
 }
 
+// MessageName implements network.MessageNamer, messages are named by id.
+func (p *Processor) MessageName(msg any) string {
+	id, ok := p.ids[reflect.TypeOf(msg)]
+	if !ok {
+		return reflect.TypeOf(msg).String()
+	}
+	return strconv.FormatUint(uint64(id), 10)
+}
+
 // Unmarshal implements network.Processor.
 func (p *Processor) Unmarshal(data []byte) (any, error) {
 	id, err := network.GetID(data, p.option)
@@ -95,8 +150,13 @@ func (p *Processor) Unmarshal(data []byte) (any, error) {
 
 	info, ok := p.messages[id]
 	if !ok {
+		p.metrics.AddMessage(network.MessageUnknown, network.MessageIn, len(data))
+		if p.fallback != nil || p.option.IgnoreUnknown {
+			return &network.UnknownMessage{ID: id, Data: bytes.Clone(data[p.option.IDLength:])}, nil
+		}
 		return nil, fmt.Errorf("protobuf: message ID %d not registered", id)
 	}
+	p.metrics.AddMessage(strconv.FormatUint(uint64(id), 10), network.MessageIn, len(data))
 
 	msg := reflect.New(info.msgtype.Elem()).Interface()
 	return msg, proto.Unmarshal(data[p.option.IDLength:], msg.(proto.Message))
@@ -135,11 +195,15 @@ func (p *Processor) RegisterHandler(msg any, handler network.Handler) error {
 	return nil
 }
 
-// Range implements network.Processor.
+// Range calls fn for every registered message with its id and type, e.g. to dump the message table.
 func (p *Processor) Range(fn func(id uint, msgtype reflect.Type)) {
 	for _, i := range p.messages {
 		fn(i.id, i.msgtype)
 	}
 }
 
-var _ network.Processor = (*Processor)(nil)
+var (
+	_ network.Processor        = (*Processor)(nil)
+	_ network.ContextProcessor = (*Processor)(nil)
+	_ network.MessageNamer     = (*Processor)(nil)
+)
@@ -0,0 +1,110 @@
+package protobuf
+
+import (
+	"testing"
+
+	"github.com/czx-lab/czx/network"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestProcessorIgnoreUnknown(t *testing.T) {
+	conf := network.ProcessorConf{IDLength: network.IDCodeLenType16}
+	// A message with id 2 from a client newer than the server
+	data := []byte{0x00, 0x02, 0x0a, 0x02, 'h', 'i'}
+
+	for _, ignore := range []bool{false, true} {
+		conf.IgnoreUnknown = ignore
+		p := NewProcessor(conf)
+		if err := p.Register(network.Message{ID: 1, Data: &wrapperspb.StringValue{}}); err != nil {
+			t.Fatal(err)
+		}
+
+		msg, err := p.Unmarshal(data)
+		if !ignore {
+			// The agent closes the connection on decoding errors
+			if err == nil {
+				t.Fatal("unknown id decoded without IgnoreUnknown")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unknown id rejected with IgnoreUnknown: %v", err)
+		}
+		if err := p.Process(msg, nil); err != nil {
+			t.Fatalf("unknown message not skipped: %v", err)
+		}
+	}
+}
+
+func TestProcessorDefaultHandler(t *testing.T) {
+	p := NewProcessor(network.ProcessorConf{IDLength: network.IDCodeLenType16})
+
+	var gotID uint
+	var gotData []byte
+	p.RegisterDefaultHandler(func(id uint, data []byte, agent network.Agent) {
+		gotID, gotData = id, data
+	})
+
+	msg, err := p.Unmarshal([]byte{0x00, 0x07, 0x01, 0x02})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Process(msg, nil); err != nil {
+		t.Fatal(err)
+	}
+	if gotID != 7 || string(gotData) != "\x01\x02" {
+		t.Fatalf("default handler got id %d data %q", gotID, gotData)
+	}
+}
+
+// countMetrics counts the messages and bytes by message and direction
+type countMetrics struct {
+	network.NoopProcessorMetrics
+	messages map[string]int
+	bytes    map[string]int
+}
+
+func (m *countMetrics) AddMessage(message, dir string, size int) {
+	m.messages[message+"/"+dir]++
+	m.bytes[message+"/"+dir] += size
+}
+
+func TestProcessorMessageMetrics(t *testing.T) {
+	m := &countMetrics{messages: make(map[string]int), bytes: make(map[string]int)}
+	p := NewProcessor(network.ProcessorConf{IDLength: network.IDCodeLenType16}).WithMetrics(m)
+	if err := p.Register(network.Message{ID: 3, Data: &wrapperspb.StringValue{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	frames, err := p.Marshal(wrapperspb.String("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append(frames[0], frames[1]...)
+	if _, err := p.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+
+	// 2 bytes of id, 2 bytes of field header and the string
+	for _, dir := range []string{network.MessageOut, network.MessageIn} {
+		if m.messages["3/"+dir] != 1 || m.bytes["3/"+dir] != 6 {
+			t.Fatalf("%s: got %d messages of %d bytes, want 1 of 6", dir, m.messages["3/"+dir], m.bytes["3/"+dir])
+		}
+	}
+}
+
+func TestProcessorUnknownMessageMetrics(t *testing.T) {
+	m := &countMetrics{messages: make(map[string]int), bytes: make(map[string]int)}
+	p := NewProcessor(network.ProcessorConf{IDLength: network.IDCodeLenType16, IgnoreUnknown: true}).WithMetrics(m)
+
+	// Client chosen ids must not create a series each
+	for id := range 3 {
+		if _, err := p.Unmarshal([]byte{0, byte(10 + id), 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(m.messages) != 1 || m.messages[network.MessageUnknown+"/"+network.MessageIn] != 3 {
+		t.Fatalf("got %v, want 3 unknown messages", m.messages)
+	}
+}
@@ -0,0 +1,200 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// proxyV1MaxLen is the maximum length of a PROXY protocol v1 header, including the CRLF
+	proxyV1MaxLen = 107
+	// proxyV2HeaderLen is the length of the fixed part of a PROXY protocol v2 header
+	proxyV2HeaderLen = 16
+	// defaultProxyHeaderTimeout is the default time allowed to receive the PROXY protocol header
+	defaultProxyHeaderTimeout = 5 * time.Second
+)
+
+var (
+	// proxyV2Signature is the signature starting every PROXY protocol v2 header
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	ErrInvalidProxyHeader = errors.New("invalid proxy protocol header")
+)
+
+// ProxyConn is a connection whose PROXY protocol header, if any, has been consumed.
+// Reads return the payload following the header.
+type ProxyConn struct {
+	net.Conn
+	r      *bufio.Reader
+	source net.Addr
+}
+
+var _ net.Conn = (*ProxyConn)(nil)
+
+// NewProxyConn reads the PROXY protocol v1 or v2 header of the connection.
+// Connections without a header are accepted as is and keep their socket peer as source address.
+// The header must be received within timeout, zero meaning the default timeout.
+//
+// Detecting a missing header requires the client to send data first, so this must only be used
+// on listeners placed behind a proxy, or with protocols where the client speaks first.
+func NewProxyConn(conn net.Conn, timeout time.Duration) (*ProxyConn, error) {
+	if timeout <= 0 {
+		timeout = defaultProxyHeaderTimeout
+	}
+
+	pc := &ProxyConn{
+		Conn: conn,
+		r:    bufio.NewReader(conn),
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	source, err := readProxyHeader(pc.r)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+
+	pc.source = source
+	if pc.source == nil {
+		pc.source = conn.RemoteAddr()
+	}
+	return pc, nil
+}
+
+// Read implements net.Conn.
+func (pc *ProxyConn) Read(b []byte) (int, error) {
+	return pc.r.Read(b)
+}
+
+// SourceAddr returns the client address announced by the PROXY protocol header,
+// or the socket peer if there was none.
+func (pc *ProxyConn) SourceAddr() net.Addr {
+	return pc.source
+}
+
+// readProxyHeader consumes the PROXY protocol header from r and returns the source address.
+// It returns a nil address without consuming anything if there is no header, and a nil address
+// after consuming the header if it carries no address (LOCAL or UNKNOWN).
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch first[0] {
+	case proxyV2Signature[0]:
+		return readProxyV2(r)
+	case 'P':
+		return readProxyV1(r)
+	}
+	return nil, nil
+}
+
+// readProxyV1 parses a text header, e.g. "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n".
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	prefix, err := r.Peek(6)
+	if err != nil {
+		return nil, err
+	}
+	if string(prefix) != "PROXY " {
+		return nil, nil
+	}
+
+	var line []byte
+	for len(line) < proxyV1MaxLen {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	parts := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	if len(parts) >= 2 && parts[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(parts) != 6 || (parts[1] != "TCP4" && parts[1] != "TCP6") {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	ip := net.ParseIP(parts[2])
+	port, err := strconv.Atoi(parts[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, ErrInvalidProxyHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readProxyV2 parses a binary header.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header, err := r.Peek(proxyV2HeaderLen)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:len(proxyV2Signature)], proxyV2Signature) {
+		return nil, nil
+	}
+	if header[12]>>4 != 2 {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	command := header[12] & 0x0f
+	family := header[13] >> 4
+	transport := header[13] & 0x0f
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+
+	buf := make([]byte, proxyV2HeaderLen+length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	payload := buf[proxyV2HeaderLen:]
+
+	// LOCAL connections are health checks from the proxy itself
+	if command == 0 {
+		return nil, nil
+	}
+	if command != 1 {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	var ip net.IP
+	var port int
+	switch family {
+	case 1: // AF_INET
+		if len(payload) < 12 {
+			return nil, ErrInvalidProxyHeader
+		}
+		ip = net.IP(payload[0:4])
+		port = int(binary.BigEndian.Uint16(payload[8:10]))
+	case 2: // AF_INET6
+		if len(payload) < 36 {
+			return nil, ErrInvalidProxyHeader
+		}
+		ip = net.IP(payload[0:16])
+		port = int(binary.BigEndian.Uint16(payload[32:34]))
+	default: // AF_UNSPEC or AF_UNIX, no usable address
+		return nil, nil
+	}
+
+	if transport == 2 {
+		return &net.UDPAddr{IP: ip, Port: port}, nil
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
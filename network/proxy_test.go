@@ -0,0 +1,95 @@
+package network
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProxyConn(t *testing.T) {
+	// Headers as captured from HAProxy with send-proxy and send-proxy-v2
+	v1 := []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n")
+	v1Unknown := []byte("PROXY UNKNOWN\r\n")
+	v2 := []byte{
+		0x0d, 0x0a, 0x0d, 0x0a, 0x00, 0x0d, 0x0a, 0x51, 0x55, 0x49, 0x54, 0x0a,
+		0x21,       // version 2, PROXY
+		0x11,       // AF_INET, STREAM
+		0x00, 0x0c, // address length
+		0xc0, 0x00, 0x02, 0x01, // 192.0.2.1
+		0xc6, 0x33, 0x64, 0x01, // 198.51.100.1
+		0xdc, 0x04, // 56324
+		0x01, 0xbb, // 443
+	}
+	v2IPv6 := []byte{
+		0x0d, 0x0a, 0x0d, 0x0a, 0x00, 0x0d, 0x0a, 0x51, 0x55, 0x49, 0x54, 0x0a,
+		0x21,       // version 2, PROXY
+		0x21,       // AF_INET6, STREAM
+		0x00, 0x24, // address length
+		0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01, // 2001:db8::1
+		0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x02, // 2001:db8::2
+		0xdc, 0x04, // 56324
+		0x01, 0xbb, // 443
+	}
+	v2Local := []byte{
+		0x0d, 0x0a, 0x0d, 0x0a, 0x00, 0x0d, 0x0a, 0x51, 0x55, 0x49, 0x54, 0x0a,
+		0x20,       // version 2, LOCAL
+		0x00,       // AF_UNSPEC
+		0x00, 0x00, // address length
+	}
+
+	cases := []struct {
+		name    string
+		header  []byte
+		payload string
+		source  string
+		err     error
+	}{
+		{name: "v1", header: v1, payload: "hello", source: "192.0.2.1:56324"},
+		{name: "v1 unknown", header: v1Unknown, payload: "hello", source: "pipe"},
+		{name: "v2", header: v2, payload: "hello", source: "192.0.2.1:56324"},
+		{name: "v2 ipv6", header: v2IPv6, payload: "hello", source: "[2001:db8::1]:56324"},
+		{name: "v2 local", header: v2Local, payload: "hello", source: "pipe"},
+		{name: "no header", payload: "hello", source: "pipe"},
+		{name: "no header starting with P", payload: "PING!!", source: "pipe"},
+		{name: "invalid v1", header: []byte("PROXY TCP4 nope\r\n"), payload: "hello", err: ErrInvalidProxyHeader},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+
+			go func() {
+				client.Write(append(append([]byte{}, c.header...), c.payload...))
+			}()
+
+			pc, err := NewProxyConn(server, time.Second)
+			if c.err != nil {
+				if err != c.err {
+					t.Fatalf("got error %v, want %v", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := pc.SourceAddr().String(); got != c.source {
+				t.Fatalf("source: got %s, want %s", got, c.source)
+			}
+
+			// The payload following the header must not be lost
+			buf := make([]byte, len(c.payload))
+			if _, err := io.ReadFull(pc, buf); err != nil || string(buf) != c.payload {
+				t.Fatalf("payload: got %q, %v, want %q", buf, err, c.payload)
+			}
+
+			ip, port, _ := GetClientIPFromProxyProtocol(pc)
+			if c.source != "pipe" && net.JoinHostPort(*ip, *port) != c.source {
+				t.Fatalf("client ip: got %s:%s, want %s", *ip, *port, c.source)
+			}
+		})
+	}
+}
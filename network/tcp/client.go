@@ -93,7 +93,7 @@ func (c *TcpClient) dial() (*TcpConn, net.Conn, error) {
 
 	tcpconn := NewTcpConn(conn, &TcpConnConf{
 		PendingWrite: c.conf.Pending,
-	})
+	}).WithParse(c.parser)
 
 	c.mu.Lock()
 	c.conns[conn] = struct{}{}
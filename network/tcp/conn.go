@@ -5,6 +5,7 @@ import (
 	"io"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/czx-lab/czx/network"
 	"github.com/czx-lab/czx/xlog"
@@ -23,15 +24,20 @@ type (
 	TcpConnConf struct {
 		// Number of pending writes
 		PendingWrite int
+		// WritePolicy is applied when the write queue is full, see network.WritePolicy
+		WritePolicy network.WritePolicy
+		// WriteBlockTimeout is the time a write waits for room in the queue with network.WriteBlock
+		WriteBlockTimeout time.Duration
 	}
 
 	TcpConn struct {
 		sync.Mutex
+		network.LabelSet
 		conf *TcpConnConf
 		// The underlying network connection
 		conn net.Conn
-		// Queue for outgoing data
-		writeQueue chan []byte
+		// Queue for outgoing data, each entry is written at once with writev if supported
+		writeQueue chan net.Buffers
 		done       bool
 		parse      *MessageParser
 		clientAddr network.ClientAddrMessage
@@ -40,8 +46,23 @@ type (
 )
 
 var _ network.Conn = (*TcpConn)(nil)
+var _ network.WriteQueuer = (*TcpConn)(nil)
+var _ network.MessageReleaser = (*TcpConn)(nil)
+var _ network.BuffersWriter = (*TcpConn)(nil)
+var _ network.BatchWriter = (*TcpConn)(nil)
 var _ io.Writer = (*TcpConn)(nil)
 
+// Destroy closes all the connections without lingering, it returns the number of connections.
+func (c Conns) Destroy() int {
+	for conn := range c {
+		if tcpconn, ok := conn.(*net.TCPConn); ok {
+			tcpconn.SetLinger(0)
+		}
+		conn.Close()
+	}
+	return len(c)
+}
+
 func NewTcpConn(conn net.Conn, conf *TcpConnConf) *TcpConn {
 	if conf.PendingWrite <= 0 {
 		conf.PendingWrite = defaultPendingWrite
@@ -51,8 +72,9 @@ func NewTcpConn(conn net.Conn, conf *TcpConnConf) *TcpConn {
 	// Initialize the write queue with the specified size
 	tcpconn := &TcpConn{
 		conn:       conn,
-		writeQueue: make(chan []byte, conf.PendingWrite),
+		writeQueue: make(chan net.Buffers, conf.PendingWrite),
 		conf:       conf,
+		metrics:    &network.NoopServerMetrics{},
 	}
 
 	tcpconn.init()
@@ -84,7 +106,7 @@ func (c *TcpConn) init() {
 				break
 			}
 
-			n, err := c.conn.Write(b)
+			n, err := c.writeBuffers(b)
 			if err != nil {
 				xlog.Write().Error("tcp conn write error", zap.Error(err))
 				c.metrics.IncWriteErrors()
@@ -100,6 +122,28 @@ func (c *TcpConn) init() {
 	}()
 }
 
+// writeBuffers writes the buffers with a single call when the connection supports it:
+// writev for TCP, a single message for KCP sessions. A PROXY protocol connection only
+// wraps reads, writes go to the inner connection.
+func (c *TcpConn) writeBuffers(b net.Buffers) (int, error) {
+	conn := c.conn
+	if pconn, ok := conn.(*network.ProxyConn); ok {
+		conn = pconn.Conn
+	}
+
+	if len(b) == 1 {
+		return conn.Write(b[0])
+	}
+	if bw, ok := conn.(interface {
+		WriteBuffers(v [][]byte) (int, error)
+	}); ok {
+		return bw.WriteBuffers(b)
+	}
+
+	n, err := b.WriteTo(conn)
+	return int(n), err
+}
+
 // Close implements network.Conn.
 func (c *TcpConn) Close() {
 	c.Lock()
@@ -109,17 +153,35 @@ func (c *TcpConn) Close() {
 		return
 	}
 
-	c.doWrite(nil)
+	if !network.EnqueueClose(c.conf.WritePolicy, c.writeQueue, c.conf.WriteBlockTimeout) {
+		c.doDestroy()
+	}
 	c.done = true
 }
 
-func (c *TcpConn) doWrite(b []byte) {
-	if len(c.writeQueue) == cap(c.writeQueue) {
+func (c *TcpConn) doWrite(b net.Buffers) {
+	c.metrics.ObserveWriteQueueDepth(len(c.writeQueue), cap(c.writeQueue))
+	if !network.Enqueue(c.conf.WritePolicy, c.writeQueue, b, c.conf.WriteBlockTimeout) {
 		c.doDestroy()
-		return
 	}
+}
+
+// WriteQueueLen implements network.WriteQueuer.
+func (c *TcpConn) WriteQueueLen() int {
+	return len(c.writeQueue)
+}
+
+// WriteQueueCap implements network.WriteQueuer.
+func (c *TcpConn) WriteQueueCap() int {
+	return cap(c.writeQueue)
+}
 
-	c.writeQueue <- b
+// IsAlive implements network.Conn.
+func (c *TcpConn) IsAlive() bool {
+	c.Lock()
+	defer c.Unlock()
+
+	return !c.done
 }
 
 // Destroy implements network.Conn.
@@ -131,7 +193,13 @@ func (c *TcpConn) Destroy() {
 }
 
 func (c *TcpConn) doDestroy() {
-	c.conn.(*net.TCPConn).SetLinger(0)
+	conn := c.conn
+	if pconn, ok := conn.(*network.ProxyConn); ok {
+		conn = pconn.Conn
+	}
+	if tcpconn, ok := conn.(*net.TCPConn); ok {
+		tcpconn.SetLinger(0)
+	}
 	c.conn.Close()
 
 	if !c.done {
@@ -163,6 +231,11 @@ func (c *TcpConn) ReadMessage() ([]byte, error) {
 	return c.parse.Read(c)
 }
 
+// ReleaseMessage implements network.MessageReleaser.
+func (c *TcpConn) ReleaseMessage(b []byte) {
+	c.parse.Release(b)
+}
+
 // RemoteAddr implements network.Conn.
 func (c *TcpConn) RemoteAddr() net.Addr {
 	return c.conn.RemoteAddr()
@@ -184,6 +257,11 @@ func (c *TcpConn) WriteMessage(args ...[]byte) error {
 	return c.parse.Write(c, args...)
 }
 
+// WriteBatch implements network.BatchWriter.
+func (c *TcpConn) WriteBatch(msgs ...[][]byte) error {
+	return c.parse.WriteBatch(c, msgs...)
+}
+
 // Write implements io.Writer.
 func (c *TcpConn) Write(p []byte) (n int, err error) {
 	c.Lock()
@@ -193,6 +271,25 @@ func (c *TcpConn) Write(p []byte) (n int, err error) {
 		return 0, errors.New("dead connection or nil data")
 	}
 
-	c.doWrite(p)
+	c.doWrite(net.Buffers{p})
 	return len(p), nil
 }
+
+// WriteBuffers implements network.BuffersWriter.
+// The buffers are queued without being copied and written with a single writev call.
+func (c *TcpConn) WriteBuffers(bufs net.Buffers) (int64, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.done || bufs == nil {
+		return 0, errors.New("dead connection or nil data")
+	}
+
+	var n int64
+	for _, b := range bufs {
+		n += int64(len(b))
+	}
+
+	c.doWrite(bufs)
+	return n, nil
+}
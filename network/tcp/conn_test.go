@@ -0,0 +1,76 @@
+package tcp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/czx-lab/czx/network"
+)
+
+// buffersConn records the gathered writes of the connection
+type buffersConn struct {
+	net.Conn
+	writes [][][]byte
+}
+
+func (c *buffersConn) WriteBuffers(v [][]byte) (int, error) {
+	c.writes = append(c.writes, v)
+
+	var n int
+	for _, b := range v {
+		n += len(b)
+	}
+	return n, nil
+}
+
+func TestTcpConnWriteBuffersProxy(t *testing.T) {
+	inner := &buffersConn{}
+	conn := &TcpConn{conn: &network.ProxyConn{Conn: inner}}
+
+	n, err := conn.writeBuffers(net.Buffers{[]byte("head"), []byte("body")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 8 {
+		t.Fatalf("wrote %d bytes, want 8", n)
+	}
+	if len(inner.writes) != 1 || len(inner.writes[0]) != 2 {
+		t.Fatalf("got writes %q, want a single gathered write", inner.writes)
+	}
+}
+
+func TestTcpConnWriteBlock(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	timeout := 200 * time.Millisecond
+	conn := NewTcpConn(server, &TcpConnConf{PendingWrite: 1, WritePolicy: network.WriteBlock, WriteBlockTimeout: timeout})
+
+	// The peer never reads: the writer goroutine is stuck on the first message, the second fills the queue
+	for _, msg := range []string{"1", "2"} {
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for conn.WriteQueueLen() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	blocked := make(chan struct{})
+	go func() {
+		close(blocked)
+		conn.Write([]byte("3"))
+	}()
+	<-blocked
+	time.Sleep(20 * time.Millisecond)
+
+	// The blocked write holds the connection lock until the timeout destroys the connection
+	start := time.Now()
+	if conn.IsAlive() {
+		t.Fatal("the connection must be destroyed once the write timed out")
+	}
+	if took := time.Since(start); took < timeout/4 {
+		t.Fatalf("IsAlive returned after %v, want it to wait for the blocked write", took)
+	}
+}
@@ -1,10 +1,14 @@
 package tcp
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"math"
+	"net"
+	"sync"
 
 	"github.com/czx-lab/czx/network"
 )
@@ -13,8 +17,18 @@ var (
 	defaultMsgMinSize uint32 = 1
 	defaultMsgMaxSize uint32 = 4096
 
-	ErrMessageTooLong  = errors.New("message too long")
+	ErrMessageTooLong  = network.ErrMessageTooLong
 	ErrMessageTooShort = errors.New("message too short")
+	// ErrProtocolMismatch is returned when a frame does not start with the configured magic and version,
+	// usually because the peer speaks another protocol or another version of it.
+	ErrProtocolMismatch = errors.New("protocol mismatch")
+)
+
+const (
+	// maxMagicLen is the maximum length of MessageParserConf.Magic
+	maxMagicLen = 16
+	// maxHeaderLen is the maximum length of a frame header: the magic, the version and the length field
+	maxHeaderLen = maxMagicLen + 1 + 4
 )
 
 const (
@@ -34,24 +48,75 @@ type (
 		// Maximum message size (0: no limit)
 		MsgMaxSize   uint32
 		LittleEndian bool
+		// Magic, if set, prefixes each frame followed by the Version byte, before the length field.
+		// Frames with another prefix are rejected with ErrProtocolMismatch.
+		// It is disabled by default for wire compatibility, both peers must use the same setting.
+		// It is at most 16 bytes long.
+		Magic   []byte
+		Version uint8
+		// PooledBuffers reuses the buffers returned by Read, they must be handed back with Release
+		// once the message is processed and must not be retained after that.
+		PooledBuffers bool
 	}
 	MessageParser struct {
 		conf *MessageParserConf
+		pool sync.Pool
+		// headers holds the *[maxHeaderLen]byte buffers the frame headers are read into,
+		// the parser is shared by the connections of a server
+		headers sync.Pool
 	}
 )
 
 func NewParse(conf *MessageParserConf) *MessageParser {
 	defaultParseConf(conf)
+	if len(conf.Magic) > maxMagicLen {
+		panic(fmt.Sprintf("tcp: magic is %d bytes long, the maximum is %d", len(conf.Magic), maxMagicLen))
+	}
 
 	return &MessageParser{
 		conf: conf,
+		headers: sync.Pool{
+			New: func() any { return new([maxHeaderLen]byte) },
+		},
 	}
 }
 
-// Read message from connection, the first 1/2/4 bytes is the length of the message
+// prefixLen returns the length of the magic and version prefix, 0 if disabled.
+func (m *MessageParser) prefixLen() int {
+	if len(m.conf.Magic) == 0 {
+		return 0
+	}
+	return len(m.conf.Magic) + 1
+}
+
+// readPrefix reads and validates the magic and version prefix into the header buffer.
+func (m *MessageParser) readPrefix(conn io.Reader, prefix []byte) error {
+	if _, err := io.ReadFull(conn, prefix); err != nil {
+		return err
+	}
+
+	magic := prefix[:len(m.conf.Magic)]
+	if !bytes.Equal(magic, m.conf.Magic) || prefix[len(magic)] != m.conf.Version {
+		return ErrProtocolMismatch
+	}
+	return nil
+}
+
+// Read message from connection, the first 1/2/4 bytes is the length of the message,
+// preceded by the magic and version prefix if configured
 func (m *MessageParser) Read(conn io.Reader) ([]byte, error) {
-	var b [4]byte
-	bufMsgLen := b[:m.conf.MsgLengthType]
+	// The header buffer would escape to the heap on every frame if it were a local array
+	header := m.headers.Get().(*[maxHeaderLen]byte)
+	defer m.headers.Put(header)
+
+	n := m.prefixLen()
+	if n > 0 {
+		if err := m.readPrefix(conn, header[:n]); err != nil {
+			return nil, err
+		}
+	}
+
+	bufMsgLen := header[n : n+int(m.conf.MsgLengthType)]
 	if _, err := io.ReadFull(conn, bufMsgLen); err != nil {
 		return nil, err
 	}
@@ -81,58 +146,144 @@ func (m *MessageParser) Read(conn io.Reader) ([]byte, error) {
 		return nil, ErrMessageTooShort
 	}
 
-	data := make([]byte, msgLen)
+	data := m.alloc(int(msgLen))
 	if _, err := io.ReadFull(conn, data); err != nil {
+		m.Release(data)
 		return nil, err
 	}
 
 	return data, nil
 }
 
+// alloc returns a buffer of length n, taken from the pool if buffers are pooled.
+func (m *MessageParser) alloc(n int) []byte {
+	if !m.conf.PooledBuffers {
+		return make([]byte, n)
+	}
+
+	if bp, ok := m.pool.Get().(*[]byte); ok && cap(*bp) >= n {
+		return (*bp)[:n]
+	}
+	return make([]byte, n)
+}
+
+// Release hands a buffer returned by Read back to the pool, it is a no-op if buffers are not pooled.
+// The buffer must not be used after this call.
+func (m *MessageParser) Release(b []byte) {
+	if !m.conf.PooledBuffers || b == nil {
+		return
+	}
+
+	b = b[:0]
+	m.pool.Put(&b)
+}
+
 // Write Message
 func (m *MessageParser) Write(conn network.Conn, args ...[]byte) error {
+	msgLen, err := m.length(args)
+	if err != nil {
+		return err
+	}
+
+	// Gathered write: only the header is built, the parts are written as is
+	if bw, ok := conn.(network.BuffersWriter); ok && len(args) > 1 {
+		bufs := make(net.Buffers, 0, len(args)+1)
+		bufs = append(bufs, m.header(0, msgLen))
+		bufs = append(bufs, args...)
+		_, err := bw.WriteBuffers(bufs)
+		return err
+	}
+
+	msg := m.header(msgLen, msgLen)
+	l := len(msg) - int(msgLen)
+	for i := range args {
+		copy(msg[l:], args[i])
+		l += len(args[i])
+	}
+
+	writer, ok := conn.(io.Writer)
+	if !ok {
+		return errors.New("connection does not implement io.Writer")
+	}
+	_, err = writer.Write(msg)
+
+	return err
+}
+
+// WriteBatch writes several messages, each made of the given parts, with a single gathered write
+// if the connection implements network.BuffersWriter, and one write per message otherwise.
+// Nothing is written if one of the messages is invalid.
+func (m *MessageParser) WriteBatch(conn network.Conn, msgs ...[][]byte) error {
+	bw, ok := conn.(network.BuffersWriter)
+	if !ok {
+		for _, args := range msgs {
+			if err := m.Write(conn, args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var bufs net.Buffers
+	for _, args := range msgs {
+		msgLen, err := m.length(args)
+		if err != nil {
+			return err
+		}
+		bufs = append(bufs, m.header(0, msgLen))
+		bufs = append(bufs, args...)
+	}
+	if len(bufs) == 0 {
+		return nil
+	}
+
+	_, err := bw.WriteBuffers(bufs)
+	return err
+}
+
+// length returns the length of the message made of args, checking it against the configured bounds.
+func (m *MessageParser) length(args [][]byte) (uint32, error) {
 	var msgLen uint32
 	for i := range args {
 		msgLen += uint32(len(args[i]))
 	}
 	if msgLen > m.conf.MsgMaxSize {
-		return ErrMessageTooLong
+		return 0, ErrMessageTooLong
 	}
 	if msgLen < m.conf.MsgMinSize {
-		return ErrMessageTooShort
+		return 0, ErrMessageTooShort
+	}
+	return msgLen, nil
+}
+
+// header returns a buffer starting with the prefix and the length field of a message of msgLen bytes,
+// with room for extra bytes after them.
+func (m *MessageParser) header(extra, msgLen uint32) []byte {
+	p := m.prefixLen()
+	msg := make([]byte, uint32(p)+uint32(m.conf.MsgLengthType)+extra)
+	if p > 0 {
+		copy(msg, m.conf.Magic)
+		msg[p-1] = m.conf.Version
 	}
 
-	msg := make([]byte, uint32(m.conf.MsgLengthType)+msgLen)
 	switch m.conf.MsgLengthType {
 	case LenType8:
-		msg[0] = byte(msgLen)
+		msg[p] = byte(msgLen)
 	case LenType16:
 		if m.conf.LittleEndian {
-			binary.LittleEndian.PutUint16(msg, uint16(msgLen))
+			binary.LittleEndian.PutUint16(msg[p:], uint16(msgLen))
 		} else {
-			binary.BigEndian.PutUint16(msg, uint16(msgLen))
+			binary.BigEndian.PutUint16(msg[p:], uint16(msgLen))
 		}
 	case LenType32:
 		if m.conf.LittleEndian {
-			binary.LittleEndian.PutUint32(msg, msgLen)
+			binary.LittleEndian.PutUint32(msg[p:], msgLen)
 		} else {
-			binary.BigEndian.PutUint32(msg, msgLen)
+			binary.BigEndian.PutUint32(msg[p:], msgLen)
 		}
 	}
 
-	l := int(m.conf.MsgLengthType)
-	for i := range args {
-		copy(msg[l:], args[i])
-		l += len(args[i])
-	}
-
-	writer, ok := conn.(io.Writer)
-	if !ok {
-		return errors.New("connection does not implement io.Writer")
-	}
-	_, err := writer.Write(msg)
-
-	return err
+	return msg
 }
 
 func defaultParseConf(conf *MessageParserConf) {
@@ -0,0 +1,227 @@
+package tcp
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/czx-lab/czx/network"
+)
+
+// bufConn is a network.Conn writing to an in-memory buffer
+type bufConn struct {
+	network.Conn
+	bytes.Buffer
+}
+
+// gatherConn is a network.Conn accepting gathered writes, it keeps the last message
+type gatherConn struct {
+	network.Conn
+	bufs net.Buffers
+}
+
+func (c *gatherConn) WriteBuffers(bufs net.Buffers) (int64, error) {
+	c.bufs = bufs
+	return 0, nil
+}
+
+func TestMessageParserMagic(t *testing.T) {
+	conf := &MessageParserConf{MsgLengthType: LenType16, Magic: []byte("CZX"), Version: 2}
+	parser := NewParse(conf)
+
+	conn := &bufConn{}
+	if err := parser.Write(conn, []byte{0x00, 0x01}, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(conn.Bytes(), []byte("CZX\x02")) {
+		t.Fatalf("missing prefix: %q", conn.Bytes())
+	}
+
+	msg, err := parser.Read(bytes.NewReader(conn.Bytes()))
+	if err != nil || string(msg) != "\x00\x01hello" {
+		t.Fatalf("read: got %q, %v", msg, err)
+	}
+
+	// A peer on another version is rejected
+	other := NewParse(&MessageParserConf{MsgLengthType: LenType16, Magic: []byte("CZX"), Version: 3})
+	if _, err := other.Read(bytes.NewReader(conn.Bytes())); !errors.Is(err, ErrProtocolMismatch) {
+		t.Fatalf("got %v, want %v", err, ErrProtocolMismatch)
+	}
+
+	// A peer without magic is rejected instead of reading a garbage length
+	plain := &bufConn{}
+	NewParse(&MessageParserConf{MsgLengthType: LenType16}).Write(plain, []byte("hello"))
+	if _, err := parser.Read(bytes.NewReader(plain.Bytes())); !errors.Is(err, ErrProtocolMismatch) {
+		t.Fatalf("got %v, want %v", err, ErrProtocolMismatch)
+	}
+}
+
+func BenchmarkMessageParserRead(b *testing.B) {
+	for _, pooled := range []bool{false, true} {
+		name := "Alloc"
+		if pooled {
+			name = "Pooled"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			parser := NewParse(&MessageParserConf{MsgLengthType: LenType16, PooledBuffers: pooled})
+			conn := &bufConn{}
+			parser.Write(conn, bytes.Repeat([]byte{0x01}, 512))
+			frame := conn.Bytes()
+			r := bytes.NewReader(frame)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				r.Reset(frame)
+				msg, err := parser.Read(r)
+				if err != nil {
+					b.Fatal(err)
+				}
+				parser.Release(msg)
+			}
+		})
+	}
+}
+
+func TestMessageParserHeaderAllocs(t *testing.T) {
+	parser := NewParse(&MessageParserConf{MsgLengthType: LenType16, Magic: []byte("CZX"), Version: 1, PooledBuffers: true})
+	conn := &bufConn{}
+	parser.Write(conn, []byte("hello"))
+	frame := conn.Bytes()
+	r := bytes.NewReader(frame)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		r.Reset(frame)
+		msg, err := parser.Read(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parser.Release(msg)
+	})
+	// The prefix and the length are read into a pooled header, Release is the only allocation left
+	if allocs > 1 {
+		t.Fatalf("allocs = %v, want at most 1", allocs)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("a magic over the maximum length must be rejected")
+		}
+	}()
+	NewParse(&MessageParserConf{MsgLengthType: LenType16, Magic: bytes.Repeat([]byte{'x'}, maxMagicLen+1)})
+}
+
+func TestMessageParserGatheredWrite(t *testing.T) {
+	parser := NewParse(&MessageParserConf{MsgLengthType: LenType16})
+
+	copied := &bufConn{}
+	parser.Write(copied, []byte{0x00, 0x01}, []byte("hello"))
+
+	gathered := &gatherConn{}
+	payload := []byte("hello")
+	parser.Write(gathered, []byte{0x00, 0x01}, payload)
+
+	if len(gathered.bufs) != 3 || &gathered.bufs[2][0] != &payload[0] {
+		t.Fatalf("payload was not passed as is: %q", gathered.bufs)
+	}
+	if got := bytes.Join(gathered.bufs, nil); !bytes.Equal(got, copied.Bytes()) {
+		t.Fatalf("got %q, want %q", got, copied.Bytes())
+	}
+}
+
+func BenchmarkMessageParserWrite(b *testing.B) {
+	code := []byte{0x00, 0x01}
+	payload := bytes.Repeat([]byte{0x01}, 512)
+
+	b.Run("Copy", func(b *testing.B) {
+		parser := NewParse(&MessageParserConf{MsgLengthType: LenType16})
+		conn := &bufConn{}
+
+		b.ReportAllocs()
+		for range b.N {
+			conn.Reset()
+			parser.Write(conn, code, payload)
+		}
+	})
+
+	b.Run("Gather", func(b *testing.B) {
+		parser := NewParse(&MessageParserConf{MsgLengthType: LenType16})
+		conn := &gatherConn{}
+
+		b.ReportAllocs()
+		for range b.N {
+			parser.Write(conn, code, payload)
+		}
+	})
+}
+
+// countConn is a network.Conn counting the writes queued to the connection,
+// each of them being a write or writev syscall for a TcpConn
+type countConn struct {
+	network.Conn
+	writes int
+}
+
+func (c *countConn) Write(p []byte) (int, error) {
+	c.writes++
+	return len(p), nil
+}
+
+func (c *countConn) WriteBuffers(bufs net.Buffers) (int64, error) {
+	c.writes++
+	return 0, nil
+}
+
+func TestMessageParserWriteBatch(t *testing.T) {
+	parser := NewParse(&MessageParserConf{MsgLengthType: LenType16})
+	msgs := [][][]byte{{[]byte("hello")}, {{0x00, 0x01}, []byte("world")}}
+
+	want := &bufConn{}
+	for _, msg := range msgs {
+		parser.Write(want, msg...)
+	}
+
+	got := &gatherConn{}
+	if err := parser.WriteBatch(got, msgs...); err != nil {
+		t.Fatal(err)
+	}
+	if joined := bytes.Join(got.bufs, nil); !bytes.Equal(joined, want.Bytes()) {
+		t.Fatalf("got %q, want %q", joined, want.Bytes())
+	}
+
+	if err := parser.WriteBatch(got, [][]byte{[]byte("ok")}, nil); err != ErrMessageTooShort {
+		t.Fatalf("got %v, want %v", err, ErrMessageTooShort)
+	}
+}
+
+// go test -run none -bench BenchmarkMessageParserBatch ./network/tcp
+func BenchmarkMessageParserBatch(b *testing.B) {
+	payload := bytes.Repeat([]byte{0x01}, 64)
+	msgs := make([][][]byte, 16)
+	for i := range msgs {
+		msgs[i] = [][]byte{{0x00, 0x01}, payload}
+	}
+
+	b.Run("Single", func(b *testing.B) {
+		parser := NewParse(&MessageParserConf{MsgLengthType: LenType16})
+		conn := &countConn{}
+
+		for range b.N {
+			for _, msg := range msgs {
+				parser.Write(conn, msg...)
+			}
+		}
+		b.ReportMetric(float64(conn.writes)/float64(b.N), "writes/op")
+	})
+	b.Run("Batch", func(b *testing.B) {
+		parser := NewParse(&MessageParserConf{MsgLengthType: LenType16})
+		conn := &countConn{}
+
+		for range b.N {
+			parser.WriteBatch(conn, msgs...)
+		}
+		b.ReportMetric(float64(conn.writes)/float64(b.N), "writes/op")
+	})
+}
@@ -31,6 +31,14 @@ type (
 		ImmediateRelease bool
 		// Disable Nagle's algorithm if true
 		NoDelay bool
+		// ProxyProtocol reads the PROXY protocol v1 or v2 header sent by a load balancer
+		// to resolve the real client address. Connections without a header fall back to the socket peer.
+		ProxyProtocol bool
+		// ProxyHeaderTimeout is the time allowed to receive the PROXY protocol header
+		ProxyHeaderTimeout time.Duration
+		// StopTimeout bounds the time Stop waits for the active connections to finish,
+		// the remaining ones are then destroyed. Zero waits indefinitely.
+		StopTimeout time.Duration
 		// Metrics configuration
 		Metrics metrics.SvrMetricsConf
 	}
@@ -49,11 +57,15 @@ type (
 	}
 )
 
+var _ network.GracefulServer = (*TcpServer)(nil)
+
 func NewServer(conf *TcpServerConf, agent func(*TcpConn) network.Agent) *TcpServer {
 	defaultConf(conf)
 	var m network.ServerMetrics
 	if prometheus.Enabled() {
-		m = metrics.NewSvrMetrics(conf.Metrics)
+		mconf := conf.Metrics
+		mconf.Transport = "tcp"
+		m = metrics.NewSvrMetrics(mconf)
 	} else {
 		m = &network.NoopServerMetrics{}
 	}
@@ -130,23 +142,40 @@ func (srv *TcpServer) run() {
 		srv.metrics.IncTotalConns()
 		srv.connWait.Add(1)
 
-		tcpconn := NewTcpConn(conn, &srv.conf.TcpConnConf).WithParse(srv.parse).WithMetrics(srv.metrics)
-		agent := srv.agent(tcpconn)
-
-		ip, port, _ := network.GetClientIPFromProxyProtocol(conn)
-		// Set the IP and port in the agent
-		clientAddr := network.ClientAddrMessage{IP: *ip, Port: *port}
-		tcpconn.WithClientAddr(clientAddr)
-
-		agent.OnPreConn(clientAddr)
-
 		start_t := time.Now()
 		go func() {
 			defer func() {
 				srv.metrics.DecConns()
 				srv.metrics.ObserveConnDuration(time.Since(start_t))
+				srv.Lock()
+				delete(srv.conns, conn)
+				srv.Unlock()
+
+				srv.connWait.Done()
 			}()
 
+			// The header is read here rather than in the accept loop so a slow client cannot stall it
+			var netconn net.Conn = conn
+			if srv.conf.ProxyProtocol {
+				pconn, err := network.NewProxyConn(conn, srv.conf.ProxyHeaderTimeout)
+				if err != nil {
+					xlog.Write().Debug("read proxy protocol header failed", zap.Error(err))
+					srv.metrics.IncFailedConns()
+					conn.Close()
+					return
+				}
+				netconn = pconn
+			}
+
+			tcpconn := NewTcpConn(netconn, &srv.conf.TcpConnConf).WithParse(srv.parse).WithMetrics(srv.metrics)
+			agent := srv.agent(tcpconn)
+
+			// Set the IP and port in the agent
+			clientAddr := network.ConnClientAddr(netconn)
+			tcpconn.WithClientAddr(clientAddr)
+
+			agent.OnPreConn(clientAddr)
+
 			agent.Run()
 			// Release resources based on the ImmediateRelease configuration
 			if srv.conf.ImmediateRelease {
@@ -154,32 +183,41 @@ func (srv *TcpServer) run() {
 			} else {
 				tcpconn.Close()
 			}
-			srv.Lock()
-			delete(srv.conns, conn)
-			srv.Unlock()
 			agent.OnClose()
-
-			srv.connWait.Done()
 		}()
 	}
 }
 
-// Close closes the server and all connections
+// StopAccept implements network.GracefulServer.
+// It closes the listener and waits for the accept loop to exit, active connections stay open.
+func (srv *TcpServer) StopAccept() {
+	srv.ln.Close()
+	srv.lnWait.Wait()
+}
+
+// Stop closes the server and all connections.
+// It waits for the connections to finish, at most StopTimeout if set.
 func (srv *TcpServer) Stop() {
 	srv.ln.Close()
 	srv.lnWait.Wait()
 
 	srv.Lock()
-
-	// Remove all connections from the map
 	for conn := range srv.conns {
 		conn.Close()
 	}
-	srv.conns = make(Conns)
-
 	srv.Unlock()
 
-	srv.connWait.Wait()
+	if !network.WaitTimeout(&srv.connWait, srv.conf.StopTimeout) {
+		srv.Lock()
+		n := srv.conns.Destroy()
+		srv.Unlock()
+		xlog.Write().Warn("tcp server stop timeout, connections destroyed", zap.Int("count", n))
+	}
+
+	// Remove all connections from the map
+	srv.Lock()
+	srv.conns = make(Conns)
+	srv.Unlock()
 }
 
 func defaultConf(conf *TcpServerConf) {
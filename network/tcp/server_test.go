@@ -0,0 +1,27 @@
+package tcp
+
+import (
+	"testing"
+
+	"github.com/czx-lab/czx/network"
+	"github.com/czx-lab/czx/network/metrics"
+	"github.com/czx-lab/czx/prometheus"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+func TestServersSameMetricsConf(t *testing.T) {
+	if err := prometheus.UseRegistry(prom.NewRegistry()); err != nil {
+		t.Fatal(err)
+	}
+	defer prometheus.UseRegistry(nil)
+	prometheus.Enable()
+
+	// e.g. the TCP servers of two gates of the same process
+	conf := metrics.SvrMetricsConf{Namespace: "czx", Subsystem: "gate"}
+	for range 2 {
+		NewServer(&TcpServerConf{Metrics: conf}, func(*TcpConn) network.Agent { return nil })
+	}
+	metrics.NewProcMetrics(metrics.ProcMetricsConf{Namespace: "czx"})
+	metrics.NewProcMetrics(metrics.ProcMetricsConf{Namespace: "czx"})
+}
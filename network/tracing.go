@@ -0,0 +1,24 @@
+package network
+
+import "context"
+
+type (
+	// Tracer starts a span around the processing of each inbound message.
+	Tracer interface {
+		// Start starts a span for an inbound message of size bytes.
+		// The returned context carries the span and is passed to the message handler.
+		Start(ctx context.Context, size int) (context.Context, Span)
+	}
+	// Span is the span of an inbound message.
+	Span interface {
+		// SetName names the span once the message is decoded, usually by message id.
+		SetName(name string)
+		// End ends the span, recording err if not nil.
+		End(err error)
+	}
+	// MessageNamer is implemented by processors able to name a decoded message,
+	// e.g. for metrics labels or span names.
+	MessageNamer interface {
+		MessageName(msg any) string
+	}
+)
@@ -0,0 +1,74 @@
+// Package tracing provides an OpenTelemetry implementation of network.Tracer.
+package tracing
+
+import (
+	"context"
+
+	"github.com/czx-lab/czx/network"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// defaultTracerName is the default instrumentation name of the tracer
+	defaultTracerName = "github.com/czx-lab/czx/network"
+	// defaultSpanName is the name of a span until the message is decoded
+	defaultSpanName = "network.message"
+)
+
+type (
+	OtelConf struct {
+		// Instrumentation name of the tracer, defaults to the network package path
+		Name string
+		// TracerProvider used to create the tracer, defaults to the global provider
+		Provider trace.TracerProvider
+	}
+	// OtelTracer starts an OpenTelemetry server span for each inbound message.
+	OtelTracer struct {
+		tracer trace.Tracer
+	}
+	otelSpan struct {
+		span trace.Span
+	}
+)
+
+var _ network.Tracer = (*OtelTracer)(nil)
+
+func NewOtelTracer(conf OtelConf) *OtelTracer {
+	if len(conf.Name) == 0 {
+		conf.Name = defaultTracerName
+	}
+	if conf.Provider == nil {
+		conf.Provider = otel.GetTracerProvider()
+	}
+
+	return &OtelTracer{
+		tracer: conf.Provider.Tracer(conf.Name),
+	}
+}
+
+// Start implements network.Tracer.
+func (t *OtelTracer) Start(ctx context.Context, size int) (context.Context, network.Span) {
+	ctx, span := t.tracer.Start(ctx, defaultSpanName,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.Int("message.size", size)),
+	)
+	return ctx, &otelSpan{span: span}
+}
+
+// SetName implements network.Span.
+func (s *otelSpan) SetName(name string) {
+	s.span.SetName(name)
+}
+
+// End implements network.Span.
+func (s *otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
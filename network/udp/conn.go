@@ -0,0 +1,181 @@
+// Package udp provides a plain UDP transport for lightweight, unreliable traffic.
+// Datagrams are demultiplexed into pseudo-connections by their remote address.
+// Neither ordering nor delivery is guaranteed: datagrams may be lost, duplicated or reordered,
+// and inbound datagrams are dropped when a connection read queue is full.
+package udp
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/czx-lab/czx/network"
+)
+
+var (
+	// ErrConnClosed is returned when the connection is closed.
+	ErrConnClosed     = errors.New("connection closed")
+	ErrMessageTooLong = network.ErrMessageTooLong
+)
+
+type (
+	UdpConnConf struct {
+		// Number of pending inbound datagrams, datagrams exceeding it are dropped
+		PendingRead int
+		// Maximum size of a single datagram
+		MaxMsgSize int
+	}
+
+	// UdpConn is a pseudo-connection bound to a single remote address.
+	// It shares the server socket with all the other connections.
+	UdpConn struct {
+		mu         sync.Mutex
+		conf       *UdpConnConf
+		pc         *net.UDPConn
+		addr       *net.UDPAddr
+		readQueue  chan []byte
+		done       bool
+		lastActive atomic.Int64
+		clientAddr network.ClientAddrMessage
+		metrics    network.ServerMetrics
+		network.LabelSet
+	}
+)
+
+var _ network.Conn = (*UdpConn)(nil)
+
+func newUdpConn(pc *net.UDPConn, addr *net.UDPAddr, conf *UdpConnConf) *UdpConn {
+	c := &UdpConn{
+		conf:      conf,
+		pc:        pc,
+		addr:      addr,
+		readQueue: make(chan []byte, conf.PendingRead),
+		metrics:   &network.NoopServerMetrics{},
+	}
+	c.touch()
+
+	return c
+}
+
+// WithMetrics sets the server metrics for the UdpConn instance
+func (c *UdpConn) WithMetrics(m network.ServerMetrics) *UdpConn {
+	c.metrics = m
+	return c
+}
+
+func (c *UdpConn) withClientAddr(clientAddr network.ClientAddrMessage) {
+	c.clientAddr = clientAddr
+}
+
+// push queues an inbound datagram, it is dropped if the queue is full or the connection is closed.
+func (c *UdpConn) push(b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.done {
+		return
+	}
+
+	c.touch()
+	select {
+	case c.readQueue <- b:
+		c.metrics.AddReceivedBytes(len(b))
+	default:
+		c.metrics.IncReadErrors()
+	}
+}
+
+func (c *UdpConn) touch() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+// idle reports how long the connection has not received any datagram.
+func (c *UdpConn) idle() time.Duration {
+	return time.Duration(time.Now().UnixNano() - c.lastActive.Load())
+}
+
+// ReadMessage implements network.Conn.
+// Every message is exactly one datagram.
+func (c *UdpConn) ReadMessage() ([]byte, error) {
+	b, ok := <-c.readQueue
+	if !ok {
+		return nil, ErrConnClosed
+	}
+	return b, nil
+}
+
+// WriteMessage implements network.Conn.
+// The arguments are concatenated and sent as a single datagram.
+func (c *UdpConn) WriteMessage(args ...[]byte) error {
+	var msgLen int
+	for _, arg := range args {
+		msgLen += len(arg)
+	}
+	if msgLen > c.conf.MaxMsgSize {
+		return ErrMessageTooLong
+	}
+
+	msg := make([]byte, 0, msgLen)
+	for _, arg := range args {
+		msg = append(msg, arg...)
+	}
+
+	c.mu.Lock()
+	done := c.done
+	c.mu.Unlock()
+	if done {
+		return ErrConnClosed
+	}
+
+	n, err := c.pc.WriteToUDP(msg, c.addr)
+	if err != nil {
+		c.metrics.IncWriteErrors()
+		return err
+	}
+	c.metrics.AddSentBytes(n)
+	return nil
+}
+
+// LocalAddr implements network.Conn.
+func (c *UdpConn) LocalAddr() net.Addr {
+	return c.pc.LocalAddr()
+}
+
+// RemoteAddr implements network.Conn.
+func (c *UdpConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+// ClientAddr implements network.Conn.
+func (c *UdpConn) ClientAddr() network.ClientAddrMessage {
+	return c.clientAddr
+}
+
+// Close implements network.Conn.
+// The shared server socket stays open, only the pseudo-connection is closed.
+func (c *UdpConn) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.done {
+		return
+	}
+
+	close(c.readQueue)
+	c.done = true
+}
+
+// IsAlive implements network.Conn.
+func (c *UdpConn) IsAlive() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return !c.done
+}
+
+// Destroy implements network.Conn.
+func (c *UdpConn) Destroy() {
+	c.Close()
+}
@@ -0,0 +1,253 @@
+package udp
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/czx-lab/czx/network"
+	"github.com/czx-lab/czx/network/metrics"
+	"github.com/czx-lab/czx/prometheus"
+	"github.com/czx-lab/czx/xlog"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultMaxConn is the default maximum number of connections
+	defaultMaxConn = 1000
+	// defaultPendingRead is the default number of pending inbound datagrams per connection
+	defaultPendingRead = 100
+	// defaultMaxMsgSize is the default maximum datagram size, the largest IPv4 UDP payload
+	defaultMaxMsgSize = 65507
+	// defaultIdleTimeout is the default time after which a silent connection is closed
+	defaultIdleTimeout = 30 * time.Second
+	// readBufferSize holds any datagram, so that the ones over MaxMsgSize are detected instead of truncated
+	readBufferSize = 64 * 1024
+)
+
+type (
+	UdpServerConf struct {
+		UdpConnConf
+		// Address to listen on
+		Addr string
+		// Maximum number of connections
+		MaxConn int
+		// IdleTimeout closes connections that have not received any datagram for this duration.
+		// UDP has no close handshake, so this is the only way a connection ends from the client side.
+		IdleTimeout time.Duration
+		Metrics     metrics.SvrMetricsConf
+	}
+	// UdpServer demultiplexes the datagrams received on a single socket into
+	// pseudo-connections keyed by their remote address.
+	UdpServer struct {
+		sync.Mutex
+		conf      UdpServerConf
+		pc        *net.UDPConn
+		lnWait    sync.WaitGroup
+		connWait  sync.WaitGroup
+		conns     map[string]*UdpConn
+		agent     func(*UdpConn) network.Agent
+		metrics   network.ServerMetrics
+		accepting atomic.Bool
+		done      chan struct{}
+	}
+)
+
+var _ network.GracefulServer = (*UdpServer)(nil)
+
+func NewServer(conf UdpServerConf, agent func(*UdpConn) network.Agent) *UdpServer {
+	defaultConf(&conf)
+	var m network.ServerMetrics
+	if prometheus.Enabled() {
+		mconf := conf.Metrics
+		mconf.Transport = "udp"
+		m = metrics.NewSvrMetrics(mconf)
+	} else {
+		m = &network.NoopServerMetrics{}
+	}
+	return &UdpServer{
+		conf:    conf,
+		agent:   agent,
+		conns:   make(map[string]*UdpConn),
+		metrics: m,
+		done:    make(chan struct{}),
+	}
+}
+
+// Start initializes the UDP server and starts reading datagrams.
+func (srv *UdpServer) Start() error {
+	addr, err := net.ResolveUDPAddr("udp", srv.conf.Addr)
+	if err != nil {
+		return err
+	}
+	srv.pc, err = net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	srv.accepting.Store(true)
+
+	srv.lnWait.Add(2)
+	go srv.run()
+	go srv.reap()
+
+	return nil
+}
+
+func (srv *UdpServer) run() {
+	defer srv.lnWait.Done()
+
+	buf := make([]byte, readBufferSize)
+	for {
+		n, addr, err := srv.pc.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			srv.metrics.IncReadErrors()
+			continue
+		}
+		if n > srv.conf.MaxMsgSize {
+			xlog.Write().Debug("udp datagram too long", zap.Int("size", n), zap.Stringer("remote", addr))
+			srv.metrics.IncReadErrors()
+			continue
+		}
+
+		data := make([]byte, n)
+		copy(data, buf[:n])
+
+		if conn := srv.conn(addr); conn != nil {
+			conn.push(data)
+		}
+	}
+}
+
+// conn returns the connection bound to addr, creating it if needed.
+// It returns nil if the datagram must be dropped.
+func (srv *UdpServer) conn(addr *net.UDPAddr) *UdpConn {
+	key := addr.String()
+
+	srv.Lock()
+	if conn, ok := srv.conns[key]; ok {
+		srv.Unlock()
+		return conn
+	}
+
+	if !srv.accepting.Load() {
+		srv.Unlock()
+		return nil
+	}
+
+	// Check if the maximum number of connections has been reached
+	if len(srv.conns) >= srv.conf.MaxConn {
+		srv.Unlock()
+		xlog.Write().Warn("too many connections", zap.Int("max", srv.conf.MaxConn))
+		srv.metrics.IncFailedConns()
+		return nil
+	}
+
+	udpconn := newUdpConn(srv.pc, addr, &srv.conf.UdpConnConf).WithMetrics(srv.metrics)
+	srv.conns[key] = udpconn
+	srv.Unlock()
+
+	srv.metrics.IncConns()
+	srv.metrics.IncTotalConns()
+	srv.connWait.Add(1)
+
+	clientAddr := network.ClientAddrMessage{IP: addr.IP.String(), Port: strconv.Itoa(addr.Port)}
+	udpconn.withClientAddr(clientAddr)
+
+	start_t := time.Now()
+	// The agent is created in the connection goroutine, a slow hook must not hold back the read loop
+	// shared by all the clients. The datagrams received meanwhile wait in the connection queue.
+	go func() {
+		defer func() {
+			srv.metrics.DecConns()
+			srv.metrics.ObserveConnDuration(time.Since(start_t))
+		}()
+
+		agent := srv.agent(udpconn)
+		agent.OnPreConn(clientAddr)
+		agent.Run()
+		udpconn.Close()
+
+		srv.Lock()
+		if srv.conns[key] == udpconn {
+			delete(srv.conns, key)
+		}
+		srv.Unlock()
+		agent.OnClose()
+
+		srv.connWait.Done()
+	}()
+
+	return udpconn
+}
+
+// reap closes the connections that have been idle for longer than the idle timeout.
+func (srv *UdpServer) reap() {
+	defer srv.lnWait.Done()
+
+	ticker := time.NewTicker(srv.conf.IdleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-srv.done:
+			return
+		case <-ticker.C:
+			srv.Lock()
+			for _, conn := range srv.conns {
+				if conn.idle() > srv.conf.IdleTimeout {
+					conn.Close()
+				}
+			}
+			srv.Unlock()
+		}
+	}
+}
+
+// StopAccept implements network.GracefulServer.
+// Datagrams from new remote addresses are dropped, active connections keep receiving.
+func (srv *UdpServer) StopAccept() {
+	srv.accepting.Store(false)
+}
+
+// Stop stops the UDP server and closes all connections.
+// It waits for all connections to finish processing before returning.
+func (srv *UdpServer) Stop() {
+	srv.accepting.Store(false)
+	close(srv.done)
+	srv.pc.Close()
+	srv.lnWait.Wait()
+
+	srv.Lock()
+
+	for _, conn := range srv.conns {
+		conn.Close()
+	}
+	srv.conns = make(map[string]*UdpConn)
+
+	srv.Unlock()
+
+	srv.connWait.Wait()
+}
+
+func defaultConf(conf *UdpServerConf) {
+	if conf.MaxConn <= 0 {
+		conf.MaxConn = defaultMaxConn
+	}
+	if conf.PendingRead <= 0 {
+		conf.PendingRead = defaultPendingRead
+	}
+	if conf.MaxMsgSize <= 0 || conf.MaxMsgSize > defaultMaxMsgSize {
+		conf.MaxMsgSize = defaultMaxMsgSize
+	}
+	if conf.IdleTimeout <= 0 {
+		conf.IdleTimeout = defaultIdleTimeout
+	}
+}
@@ -0,0 +1,218 @@
+package ws
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/czx-lab/czx/network"
+	"github.com/czx-lab/czx/xlog"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultClientPendingWrite is the default number of pending writes of a client connection
+	defaultClientPendingWrite = 100
+	// defaultClientMaxMsgSize is the default maximum message size of a client connection
+	defaultClientMaxMsgSize = 4096
+	// defaultHandshakeTimeout is the default timeout of the opening handshake
+	defaultHandshakeTimeout = 10 * time.Second
+	// defaultReconnectInterval is the default delay between two reconnection attempts
+	defaultReconnectInterval = 3 * time.Second
+)
+
+type (
+	WsClientConf struct {
+		// Server URL, e.g. ws://127.0.0.1:8080/ws
+		Addr            string
+		PendingWriteNum int
+		MaxMsgSize      uint32
+		// Timeout of the opening handshake
+		HandshakeTimeout time.Duration
+		// Header is sent with the opening handshake, e.g. for authentication
+		Header http.Header
+		// Subprotocols requested by the client in order of preference
+		Subprotocols []string
+		// PingInterval pings the server at this interval and drops the connection if it does not
+		// answer within PongTimeout, which defaults to PingInterval. Zero disables it.
+		PingInterval time.Duration
+		PongTimeout  time.Duration
+
+		// AutoReconnect redials the server and creates a new agent when a connection ends,
+		// until the client is closed.
+		AutoReconnect bool
+		// Delay between two reconnection attempts
+		ReconnectInterval time.Duration
+	}
+	// WsClient dials a WsServer, the agents run the same way as on the server side.
+	WsClient struct {
+		mu        sync.Mutex
+		conf      WsClientConf
+		dialer    *websocket.Dialer
+		agent     func(*WsConn) network.Agent
+		closeFlag atomic.Bool
+		conns     WsConns
+		done      chan struct{}
+
+		wg sync.WaitGroup
+	}
+)
+
+// NewWsClient .
+func NewWsClient(conf WsClientConf) *WsClient {
+	defaultClientConf(&conf)
+
+	return &WsClient{
+		conf: conf,
+		dialer: &websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: conf.HandshakeTimeout,
+			Subprotocols:     conf.Subprotocols,
+		},
+		conns: make(WsConns),
+		done:  make(chan struct{}),
+	}
+}
+
+func (c *WsClient) WithAgent(agent func(*WsConn) network.Agent) *WsClient {
+	c.agent = agent
+	return c
+}
+
+// WithDialer replaces the default dialer, e.g. to set a TLS configuration.
+func (c *WsClient) WithDialer(dialer *websocket.Dialer) *WsClient {
+	c.dialer = dialer
+	return c
+}
+
+// Connect dials the server and runs the agent in a new goroutine.
+// It returns the agent of the first connection, with AutoReconnect the following
+// connections get their own agent.
+func (c *WsClient) Connect() (network.Agent, error) {
+	if c.closeFlag.Load() {
+		return nil, errors.New("client stopped")
+	}
+	if c.agent == nil {
+		return nil, errors.New("agent is nil")
+	}
+
+	wsconn, conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	agent := c.agent(wsconn)
+
+	c.wg.Add(1)
+
+	go func() {
+		defer c.wg.Done()
+
+		c.connect(wsconn, conn, agent)
+		if !c.conf.AutoReconnect {
+			return
+		}
+		for c.reconnect() {
+		}
+	}()
+
+	return agent, nil
+}
+
+func (c *WsClient) connect(wsconn *WsConn, conn *websocket.Conn, agent network.Agent) {
+	agent.Run()
+
+	wsconn.Close()
+	agent.OnClose()
+
+	c.mu.Lock()
+	delete(c.conns, conn)
+	c.mu.Unlock()
+}
+
+// reconnect waits for the reconnection interval, then dials and runs a new agent.
+// It returns false once the client is closed.
+func (c *WsClient) reconnect() bool {
+	select {
+	case <-c.done:
+		return false
+	case <-time.After(c.conf.ReconnectInterval):
+	}
+
+	wsconn, conn, err := c.dial()
+	if err != nil {
+		xlog.Write().Debug("ws client reconnect failed", zap.String("addr", c.conf.Addr), zap.Error(err))
+		return !c.closeFlag.Load()
+	}
+
+	c.connect(wsconn, conn, c.agent(wsconn))
+	return !c.closeFlag.Load()
+}
+
+func (c *WsClient) dial() (*WsConn, *websocket.Conn, error) {
+	conn, _, err := c.dialer.Dial(c.conf.Addr, c.conf.Header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wsconn := NewConn(conn, &WsConnConf{
+		MaxMsgSize:      c.conf.MaxMsgSize,
+		MaxReadSize:     c.conf.MaxMsgSize,
+		PendingWriteNum: c.conf.PendingWriteNum,
+		PingInterval:    c.conf.PingInterval,
+		PongTimeout:     c.conf.PongTimeout,
+	})
+	// On the client side the peer is the server
+	host, port, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	wsconn.withClientAddr(network.ClientAddrMessage{IP: host, Port: port, Subprotocol: conn.Subprotocol()})
+
+	c.mu.Lock()
+	// Closed while dialing
+	if c.closeFlag.Load() {
+		c.mu.Unlock()
+		wsconn.Destroy()
+		return nil, nil, errors.New("client stopped")
+	}
+	c.conns[conn] = struct{}{}
+	c.mu.Unlock()
+
+	return wsconn, conn, nil
+}
+
+func (c *WsClient) Close() {
+	c.mu.Lock()
+	if c.closeFlag.Load() {
+		c.mu.Unlock()
+		return
+	}
+	c.closeFlag.Store(true)
+	close(c.done)
+
+	for conn := range c.conns {
+		conn.Close()
+		delete(c.conns, conn)
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+}
+
+func defaultClientConf(conf *WsClientConf) {
+	if conf.PendingWriteNum <= 0 {
+		conf.PendingWriteNum = defaultClientPendingWrite
+	}
+	if conf.MaxMsgSize <= 0 {
+		conf.MaxMsgSize = defaultClientMaxMsgSize
+	}
+	if conf.HandshakeTimeout <= 0 {
+		conf.HandshakeTimeout = defaultHandshakeTimeout
+	}
+	if conf.ReconnectInterval <= 0 {
+		conf.ReconnectInterval = defaultReconnectInterval
+	}
+}
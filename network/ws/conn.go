@@ -4,6 +4,9 @@ import (
 	"errors"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/czx-lab/czx/network"
 	"github.com/czx-lab/czx/xlog"
@@ -15,7 +18,7 @@ import (
 var (
 	// ErrConnClosed is returned when the connection is closed.
 	ErrConnClosed      = errors.New("connection closed")
-	ErrMessageTooLong  = errors.New("message too long")
+	ErrMessageTooLong  = network.ErrMessageTooLong
 	ErrMessageTooShort = errors.New("message too short")
 )
 
@@ -24,6 +27,22 @@ type (
 	WsConnConf struct {
 		MaxMsgSize      uint32
 		PendingWriteNum int
+		// MaxReadSize rejects the inbound messages over this size at the protocol layer, before
+		// they are buffered, the read then fails with ErrMessageTooLong. Zero disables it.
+		MaxReadSize uint32
+		// WritePolicy is applied when the write queue is full, see network.WritePolicy
+		WritePolicy network.WritePolicy
+		// WriteBlockTimeout is the time a write waits for room in the queue with network.WriteBlock
+		WriteBlockTimeout time.Duration
+		// ReadTimeout closes the connection if no message or control frame is received for this duration.
+		// It protects against clients holding a connection slot without sending anything. Zero disables it.
+		ReadTimeout time.Duration
+		// PingInterval sends a ping control frame at this interval, the connection is destroyed
+		// if no pong is received within PongTimeout of a ping. It detects half-open connections
+		// and keeps NAT mappings alive below the application heartbeats. Zero disables it.
+		PingInterval time.Duration
+		// PongTimeout defaults to PingInterval
+		PongTimeout time.Duration
 	}
 
 	// WsConn represents a WebSocket connection with a mutex for thread-safe access.
@@ -32,26 +51,84 @@ type (
 		mu   sync.Mutex
 		opt  *WsConnConf
 		conn *websocket.Conn
-		// Channel for writing messages to the connection
-		writeChan chan []byte
+		// Channel for writing messages to the connection, the parts of an entry form one message
+		writeChan chan net.Buffers
 		// Flag to indicate if the connection is closed
-		closeFlag  bool
+		closeFlag bool
+		// Close frame sent once the pending writes are flushed, if closeCode is set
+		closeCode  int
+		closeText  string
 		clientAddr network.ClientAddrMessage // Client address message
 		metrics    network.ServerMetrics
+		// Unix nano time of the last pong, see WsConnConf.PingInterval
+		lastPong atomic.Int64
+		// closed when the writer goroutine ends
+		done chan struct{}
+		network.LabelSet
 	}
 )
 
-var _ network.Conn = (*WsConn)(nil)
+var (
+	_ network.Conn         = (*WsConn)(nil)
+	_ network.ReasonCloser = (*WsConn)(nil)
+	_ network.WriteQueuer  = (*WsConn)(nil)
+)
+
+const (
+	// closeFrameTimeout is the maximum time spent writing the close frame
+	closeFrameTimeout = time.Second
+	// maxCloseReason is the maximum length of the reason of a close frame,
+	// a control frame payload is at most 125 bytes including the 2 bytes of the code
+	maxCloseReason = 123
+)
 
 func NewConn(conn *websocket.Conn, opt *WsConnConf) *WsConn {
 	wsConn := &WsConn{
 		opt:       opt,
 		conn:      conn,
-		writeChan: make(chan []byte, opt.PendingWriteNum),
+		writeChan: make(chan net.Buffers, opt.PendingWriteNum),
+		metrics:   &network.NoopServerMetrics{},
+		done:      make(chan struct{}),
+	}
+
+	if opt.MaxReadSize > 0 {
+		conn.SetReadLimit(int64(opt.MaxReadSize))
+	}
+
+	if opt.ReadTimeout > 0 || opt.PingInterval > 0 {
+		wsConn.lastPong.Store(time.Now().UnixNano())
+		conn.SetPongHandler(func(string) error {
+			wsConn.lastPong.Store(time.Now().UnixNano())
+			if opt.ReadTimeout > 0 {
+				wsConn.extendReadDeadline()
+			}
+			return nil
+		})
+	}
+
+	if opt.ReadTimeout > 0 {
+		wsConn.extendReadDeadline()
+		// Control frames keep the connection alive as well as messages
+		conn.SetPingHandler(func(data string) error {
+			wsConn.extendReadDeadline()
+			err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(closeFrameTimeout))
+			if errors.Is(err, websocket.ErrCloseSent) {
+				return nil
+			}
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				return nil
+			}
+			return err
+		})
+	}
+
+	if opt.PingInterval > 0 {
+		go wsConn.keepalive()
 	}
 
 	go func() {
 		defer func() {
+			close(wsConn.done)
 			conn.Close()
 
 			wsConn.mu.Lock()
@@ -61,21 +138,57 @@ func NewConn(conn *websocket.Conn, opt *WsConnConf) *WsConn {
 
 		for v := range wsConn.writeChan {
 			if v == nil {
+				wsConn.writeClose()
 				break
 			}
 
-			if err := wsConn.conn.WriteMessage(websocket.BinaryMessage, v); err != nil {
+			n, err := wsConn.write(v)
+			if err != nil {
 				wsConn.metrics.IncWriteErrors()
 				xlog.Write().Error("ws conn write error", zap.Error(err))
 				break
 			}
-			wsConn.metrics.AddSentBytes(len(v))
+			wsConn.metrics.AddSentBytes(n)
 		}
 	}()
 
 	return wsConn
 }
 
+// keepalive pings the peer every PingInterval until the connection ends.
+// The pongs are handled by the reads, like any control frame.
+func (w *WsConn) keepalive() {
+	timeout := w.opt.PongTimeout
+	if timeout <= 0 {
+		timeout = w.opt.PingInterval
+	}
+
+	ticker := time.NewTicker(w.opt.PingInterval)
+	defer ticker.Stop()
+
+	var pinged time.Time
+	for {
+		select {
+		case <-w.done:
+			return
+		case now := <-ticker.C:
+			// The last ping is still unanswered
+			if !pinged.IsZero() && w.lastPong.Load() < pinged.UnixNano() && now.Sub(pinged) >= timeout {
+				xlog.Write().Debug("ws conn pong timeout", zap.Stringer("remote", w.conn.RemoteAddr()))
+				w.Destroy()
+				return
+			}
+
+			if err := w.conn.WriteControl(websocket.PingMessage, nil, now.Add(closeFrameTimeout)); err != nil {
+				return
+			}
+			if pinged.IsZero() || w.lastPong.Load() >= pinged.UnixNano() {
+				pinged = now
+			}
+		}
+	}
+}
+
 // WithMetrics sets the server metrics for the WsConn instance
 func (w *WsConn) WithMetrics(m network.ServerMetrics) *WsConn {
 	w.metrics = m
@@ -91,18 +204,110 @@ func (w *WsConn) Close() {
 		return
 	}
 
-	w.doWrite(nil)
+	w.doClose()
+}
+
+// CloseWithReason implements network.ReasonCloser.
+// It closes the connection with a close frame once the pending writes are flushed.
+// Codes in the application range 4000-4999 are sent as is, others as a normal closure.
+// The reason is truncated to the 123 bytes a close frame can carry.
+func (w *WsConn) CloseWithReason(code uint16, reason string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closeFlag {
+		return
+	}
+
+	w.closeCode = websocket.CloseNormalClosure
+	if code >= 4000 && code <= 4999 {
+		w.closeCode = int(code)
+	}
+	w.closeText = truncateReason(reason)
+
+	w.doClose()
+}
+
+// truncateReason cuts the reason to maxCloseReason bytes, on a rune boundary.
+func truncateReason(reason string) string {
+	if len(reason) <= maxCloseReason {
+		return reason
+	}
+
+	n := maxCloseReason
+	for n > 0 && !utf8.RuneStart(reason[n]) {
+		n--
+	}
+	return reason[:n]
+}
+
+// writeClose writes the close frame, if any, it is called from the writer goroutine.
+func (w *WsConn) writeClose() {
+	if w.closeCode == 0 {
+		return
+	}
+
+	msg := websocket.FormatCloseMessage(w.closeCode, w.closeText)
+	if err := w.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeFrameTimeout)); err != nil {
+		xlog.Write().Debug("ws conn close frame write error", zap.Error(err))
+	}
+}
+
+// write writes the parts as a single binary message, it is called from the writer goroutine.
+// Several parts are streamed into the frame instead of being concatenated first.
+func (w *WsConn) write(parts net.Buffers) (int, error) {
+	if len(parts) == 1 {
+		return len(parts[0]), w.conn.WriteMessage(websocket.BinaryMessage, parts[0])
+	}
+
+	writer, err := w.conn.NextWriter(websocket.BinaryMessage)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, part := range parts {
+		m, err := writer.Write(part)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, writer.Close()
+}
+
+// doClose queues the close sentinel behind the pending writes.
+func (w *WsConn) doClose() {
+	if !network.EnqueueClose(w.opt.WritePolicy, w.writeChan, w.opt.WriteBlockTimeout) {
+		w.doDestroy()
+	}
 	w.closeFlag = true
 }
 
-func (w *WsConn) doWrite(b []byte) {
-	if len(w.writeChan) == cap(w.writeChan) {
+func (w *WsConn) doWrite(b net.Buffers) {
+	w.metrics.ObserveWriteQueueDepth(len(w.writeChan), cap(w.writeChan))
+	if !network.Enqueue(w.opt.WritePolicy, w.writeChan, b, w.opt.WriteBlockTimeout) {
 		// Channel is full, cannot write more messages
 		w.doDestroy()
-		return
 	}
+}
+
+// WriteQueueLen implements network.WriteQueuer.
+func (w *WsConn) WriteQueueLen() int {
+	return len(w.writeChan)
+}
+
+// WriteQueueCap implements network.WriteQueuer.
+func (w *WsConn) WriteQueueCap() int {
+	return cap(w.writeChan)
+}
+
+// IsAlive implements Conn.
+func (w *WsConn) IsAlive() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-	w.writeChan <- b
+	return !w.closeFlag
 }
 
 // Destroy implements Conn.
@@ -120,7 +325,9 @@ func (w *WsConn) doDestroy() {
 	}
 
 	// Close the connection and clean up resources
-	w.conn.UnderlyingConn().(*net.TCPConn).SetLinger(0)
+	if tcpconn, ok := w.conn.UnderlyingConn().(*net.TCPConn); ok {
+		tcpconn.SetLinger(0)
+	}
 	w.conn.Close()
 
 	close(w.writeChan)
@@ -148,13 +355,26 @@ func (w *WsConn) withClientAddr(msg network.ClientAddrMessage) {
 	w.clientAddr = msg
 }
 
+// extendReadDeadline pushes the read deadline ReadTimeout away.
+func (w *WsConn) extendReadDeadline() {
+	w.conn.SetReadDeadline(time.Now().Add(w.opt.ReadTimeout))
+}
+
 // ReadMessage implements Conn.
+// With a ReadTimeout, an expired deadline fails the read, which ends the agent loop.
 func (w *WsConn) ReadMessage() ([]byte, error) {
+	if w.opt.ReadTimeout > 0 {
+		w.extendReadDeadline()
+	}
+
 	_, b, err := w.conn.ReadMessage()
 	if err != nil {
 		if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
 			w.metrics.IncReadErrors()
 		}
+		if errors.Is(err, websocket.ErrReadLimit) {
+			err = ErrMessageTooLong
+		}
 	} else if len(b) > 0 {
 		w.metrics.AddReceivedBytes(len(b))
 	}
@@ -184,18 +404,12 @@ func (w *WsConn) WriteMessage(args ...[]byte) error {
 	}
 
 	if len(args) == 1 {
-		w.doWrite(args[0])
+		w.doWrite(net.Buffers{args[0]})
 		return nil
 	}
 
-	msg := make([]byte, msgLen)
-	l := 0
-	for i := range args {
-		copy(msg[l:], args[i])
-		l += len(args[i])
-	}
-
-	w.doWrite(msg)
+	// The parts are not concatenated, only the slice holding them is copied
+	w.doWrite(append(net.Buffers(nil), args...))
 
 	return nil
 }
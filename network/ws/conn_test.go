@@ -0,0 +1,121 @@
+package ws
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/czx-lab/czx/network"
+
+	"github.com/gorilla/websocket"
+)
+
+// pingPeer returns the server side connection of a peer answering pings or not
+func pingPeer(t *testing.T, pong bool) *WsConn {
+	conns := make(chan *WsConn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		wsconn := NewConn(conn, &WsConnConf{
+			MaxMsgSize:      1024,
+			PendingWriteNum: 8,
+			PingInterval:    20 * time.Millisecond,
+		})
+		conns <- wsconn
+
+		// The reads handle the pongs
+		for {
+			if _, err := wsconn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { peer.Close() })
+
+	if !pong {
+		peer.SetPingHandler(func(string) error { return nil })
+	}
+	go func() {
+		for {
+			if _, _, err := peer.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	return <-conns
+}
+
+func TestWsConnPing(t *testing.T) {
+	alive := pingPeer(t, true)
+	silent := pingPeer(t, false)
+
+	time.Sleep(200 * time.Millisecond)
+
+	if !alive.IsAlive() {
+		t.Fatal("connection answering pings was destroyed")
+	}
+	if silent.IsAlive() {
+		t.Fatal("connection not answering pings is still alive")
+	}
+	alive.Destroy()
+}
+
+func TestWsConnMaxReadSize(t *testing.T) {
+	errs := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		wsconn := NewConn(conn, &WsConnConf{MaxMsgSize: 1024, PendingWriteNum: 8, MaxReadSize: 16})
+		defer wsconn.Destroy()
+
+		if _, err := wsconn.ReadMessage(); err != nil {
+			t.Errorf("message under the limit: %v", err)
+		}
+		_, err = wsconn.ReadMessage()
+		errs <- err
+	}))
+	defer srv.Close()
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	peer.WriteMessage(websocket.BinaryMessage, make([]byte, 16))
+	peer.WriteMessage(websocket.BinaryMessage, make([]byte, 64))
+
+	if err := <-errs; !errors.Is(err, network.ErrMessageTooLong) {
+		t.Fatalf("got %v, want ErrMessageTooLong", err)
+	}
+}
+
+func TestTruncateReason(t *testing.T) {
+	if got := truncateReason("maintenance"); got != "maintenance" {
+		t.Fatalf("got %q, want the short reason as is", got)
+	}
+
+	// 2 bytes runes, the cut must not split the last one
+	long := strings.Repeat("é", 100)
+	got := truncateReason(long)
+	if len(got) != 122 || !utf8.ValidString(got) {
+		t.Fatalf("got %d bytes, valid %v, want 122 valid bytes", len(got), utf8.ValidString(got))
+	}
+}
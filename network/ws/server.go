@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/czx-lab/czx/network"
@@ -26,11 +27,36 @@ type WsServerConf struct {
 	Timeout         int
 	MaxMsgSize      uint32
 	NoDelay         bool
+	// MaxReadSize rejects the inbound messages over this size before they are buffered,
+	// it defaults to MaxMsgSize.
+	MaxReadSize uint32
+	// WritePolicy is applied when the write queue of a connection is full
+	WritePolicy network.WritePolicy
+	// WriteBlockTimeout is the time a write waits for room in the queue with network.WriteBlock
+	WriteBlockTimeout time.Duration
+	// ReadTimeout closes connections that send neither a message nor a control frame for this duration.
+	// Zero disables it.
+	ReadTimeout time.Duration
+	// PingInterval pings the connections at this interval and destroys those that do not answer
+	// within PongTimeout, which defaults to PingInterval. Zero disables it.
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+	// Subprotocols are the supported subprotocols in order of preference.
+	// The first one requested by the client is negotiated, see ClientAddrMessage.Subprotocol.
+	Subprotocols []string
 	// If ImmediateRelease is true, the server will release resources immediately after stopping.
 	// This may lead to abrupt disconnections for active connections.
 	// If false, the server will wait for all active connections to close gracefully before releasing resources.
 	// Default is false.
 	ImmediateRelease bool
+	// StopTimeout bounds the time Stop waits for the active connections to finish,
+	// the remaining ones are then destroyed. Zero waits indefinitely.
+	StopTimeout time.Duration
+	// HealthPath, if set, answers 200 while the server runs, for liveness probes.
+	HealthPath string
+	// ReadyPath, if set, answers 200 while the server accepts connections and 503 once it drains,
+	// see StopAccept. The listener then stays open until Stop so that probes keep being answered.
+	ReadyPath string
 	// Metrics configuration
 	Metrics metrics.SvrMetricsConf
 }
@@ -49,26 +75,43 @@ type WsServer struct {
 	opt     *WsServerConf
 	ln      net.Listener
 	handler *WsHandler
+	httpSrv *http.Server
+	// draining is set by StopAccept, new connections are refused afterwards
+	draining atomic.Bool
 }
 
+var _ network.GracefulServer = (*WsServer)(nil)
+var _ http.Handler = (*WsServer)(nil)
+
 func NewServer(opt *WsServerConf, agent func(*WsConn) network.Agent) *WsServer {
 	var m network.ServerMetrics
 	if prometheus.Enabled() {
-		m = metrics.NewSvrMetrics(opt.Metrics)
+		mconf := opt.Metrics
+		mconf.Transport = "ws"
+		m = metrics.NewSvrMetrics(mconf)
 	} else {
 		m = &network.NoopServerMetrics{}
 	}
 	return &WsServer{
 		opt: opt,
 		handler: &WsHandler{
-			opt:     opt,
-			agent:   agent,
-			conns:   make(WsConns),
-			metrics: m,
+			opt:      opt,
+			upgrader: websocket.Upgrader{Subprotocols: opt.Subprotocols},
+			agent:    agent,
+			conns:    make(WsConns),
+			metrics:  m,
 		},
 	}
 }
 
+// maxReadSize returns the inbound message limit of the connections.
+func (handler *WsHandler) maxReadSize() uint32 {
+	if handler.opt.MaxReadSize > 0 {
+		return handler.opt.MaxReadSize
+	}
+	return handler.opt.MaxMsgSize
+}
+
 func (handler *WsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
@@ -121,15 +164,20 @@ func (handler *WsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	handler.metrics.IncTotalConns()
 
 	wsconn := NewConn(conn, &WsConnConf{
-		MaxMsgSize:      handler.opt.MaxMsgSize,
-		PendingWriteNum: handler.opt.PendingWriteNum,
+		MaxMsgSize:        handler.opt.MaxMsgSize,
+		PendingWriteNum:   handler.opt.PendingWriteNum,
+		MaxReadSize:       handler.maxReadSize(),
+		WritePolicy:       handler.opt.WritePolicy,
+		WriteBlockTimeout: handler.opt.WriteBlockTimeout,
+		ReadTimeout:       handler.opt.ReadTimeout,
+		PingInterval:      handler.opt.PingInterval,
+		PongTimeout:       handler.opt.PongTimeout,
 	}).WithMetrics(handler.metrics)
 
 	agent := handler.agent(wsconn)
-	ip, port := network.GetClientIP(r)
-
 	// Set the IP and port in the agent
-	clentAddr := network.ClientAddrMessage{IP: *ip, Port: *port, Req: r}
+	clentAddr := network.RequestClientAddr(r)
+	clentAddr.Subprotocol = conn.Subprotocol()
 	wsconn.withClientAddr(clentAddr)
 	agent.OnPreConn(clentAddr)
 	agent.Run()
@@ -174,32 +222,81 @@ func (server *WsServer) Start() error {
 
 	httpServer := &http.Server{
 		Addr:           server.opt.Addr,
-		Handler:        server.handler,
+		Handler:        server,
 		ReadTimeout:    time.Duration(server.opt.Timeout) * time.Second,
 		WriteTimeout:   time.Duration(server.opt.Timeout) * time.Second,
 		MaxHeaderBytes: 1 << 20,
 	}
+	server.httpSrv = httpServer
 	go httpServer.Serve(ln)
 	return nil
 }
 
+// ServeHTTP implements http.Handler.
+// It answers the probes and hands the other requests over to the WebSocket handler.
+func (server *WsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case len(server.opt.HealthPath) > 0 && path == server.opt.HealthPath:
+		w.WriteHeader(http.StatusOK)
+	case len(server.opt.ReadyPath) > 0 && path == server.opt.ReadyPath:
+		if !server.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case server.draining.Load():
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+	default:
+		server.handler.ServeHTTP(w, r)
+	}
+}
+
+// Ready reports whether the server accepts new connections.
+func (server *WsServer) Ready() bool {
+	return server.ln != nil && !server.draining.Load()
+}
+
+// StopAccept implements network.GracefulServer.
+// New connections are refused, active connections stay open. The listener is closed
+// unless ReadyPath is set, in which case it keeps answering the probes until Stop.
+func (server *WsServer) StopAccept() {
+	server.draining.Store(true)
+	if server.ln != nil && len(server.opt.ReadyPath) == 0 {
+		server.ln.Close()
+	}
+}
+
 // Stop stops the WebSocket server and closes all connections.
-// It will also wait for all connections to be closed before returning.
+// It will also wait for all connections to be closed before returning, at most StopTimeout if set.
 func (server *WsServer) Stop() {
-	if server.ln != nil {
-		server.ln.Close()
+	// Closes the listener and the idle HTTP connections, upgraded connections are closed below
+	if server.httpSrv != nil {
+		server.httpSrv.Close()
 	}
 
 	server.handler.mu.Lock()
-
 	for conn := range server.handler.conns {
 		conn.Close()
 	}
+	server.handler.mu.Unlock()
+
+	if !network.WaitTimeout(&server.handler.wg, server.opt.StopTimeout) {
+		server.handler.mu.Lock()
+		for conn := range server.handler.conns {
+			if tcpconn, ok := conn.NetConn().(*net.TCPConn); ok {
+				tcpconn.SetLinger(0)
+			}
+			conn.Close()
+		}
+		n := len(server.handler.conns)
+		server.handler.mu.Unlock()
+		xlog.Write().Warn("ws server stop timeout, connections destroyed", zap.Int("count", n))
+	}
 
 	// Clear the connections map to prevent new connections from being accepted
 	// and to allow the goroutine to exit cleanly.
+	server.handler.mu.Lock()
 	server.handler.conns = nil
 	server.handler.mu.Unlock()
-
-	server.handler.wg.Wait()
 }
@@ -0,0 +1,222 @@
+package xkcp
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/czx-lab/czx/network"
+	"github.com/czx-lab/czx/network/tcp"
+	"github.com/czx-lab/czx/xlog"
+	"github.com/xtaci/kcp-go/v5"
+	"go.uber.org/zap"
+)
+
+// defaultReconnectInterval is the default delay between two reconnection attempts
+const defaultReconnectInterval = 3 * time.Second
+
+type (
+	KcpClientConf struct {
+		Addr    string
+		Pending int
+		// Key for encryption, must match the server
+		CryptKey []byte
+		// Number of data shards, must match the server
+		DataShards int
+		// Number of parity shards, must match the server
+		ParityShards int
+
+		// AutoReconnect redials the server and creates a new agent when a connection ends,
+		// until the client is closed.
+		AutoReconnect bool
+		// Delay between two reconnection attempts
+		ReconnectInterval time.Duration
+
+		// message parser
+		ParserConf tcp.MessageParserConf
+
+		// KCP Parameters
+		NoDelay  *int
+		Interval *int
+		Resend   *int
+		NC       *int
+	}
+	// KcpClient dials a KcpServer, it is the KCP counterpart of tcp.TcpClient.
+	KcpClient struct {
+		mu        sync.Mutex
+		conf      KcpClientConf
+		agent     func(*tcp.TcpConn) network.Agent
+		closeFlag atomic.Bool
+		parser    *tcp.MessageParser
+		conns     tcp.Conns
+		done      chan struct{}
+
+		wg sync.WaitGroup
+	}
+)
+
+// NewKcpClient .
+func NewKcpClient(conf KcpClientConf) *KcpClient {
+	defaultClientConf(&conf)
+
+	return &KcpClient{
+		conf:   conf,
+		conns:  make(tcp.Conns),
+		parser: tcp.NewParse(&conf.ParserConf),
+		done:   make(chan struct{}),
+	}
+}
+
+func (c *KcpClient) WithAgent(agent func(*tcp.TcpConn) network.Agent) *KcpClient {
+	c.agent = agent
+	return c
+}
+
+// WithParse replaces the message parser built from the configuration.
+func (c *KcpClient) WithParse(parser *tcp.MessageParser) *KcpClient {
+	c.parser = parser
+	return c
+}
+
+// Connect dials the server and runs the agent in a new goroutine.
+// It returns the agent of the first connection, with AutoReconnect the following
+// connections get their own agent.
+func (c *KcpClient) Connect() (network.Agent, error) {
+	if c.closeFlag.Load() {
+		return nil, errors.New("client stopped")
+	}
+	if c.agent == nil {
+		return nil, errors.New("agent is nil")
+	}
+
+	kconn, conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	agent := c.agent(kconn)
+
+	c.wg.Add(1)
+
+	go func() {
+		defer c.wg.Done()
+
+		c.connect(kconn, conn, agent)
+		if !c.conf.AutoReconnect {
+			return
+		}
+		for c.reconnect() {
+		}
+	}()
+
+	return agent, nil
+}
+
+func (c *KcpClient) connect(kconn *tcp.TcpConn, conn net.Conn, agent network.Agent) {
+	agent.Run()
+
+	kconn.Close()
+	agent.OnClose()
+
+	c.mu.Lock()
+	delete(c.conns, conn)
+	c.mu.Unlock()
+}
+
+// reconnect waits for the reconnection interval, then dials and runs a new agent.
+// It returns false once the client is closed.
+func (c *KcpClient) reconnect() bool {
+	select {
+	case <-c.done:
+		return false
+	case <-time.After(c.conf.ReconnectInterval):
+	}
+
+	kconn, conn, err := c.dial()
+	if err != nil {
+		xlog.Write().Debug("kcp client reconnect failed", zap.String("addr", c.conf.Addr), zap.Error(err))
+		return !c.closeFlag.Load()
+	}
+
+	c.connect(kconn, conn, c.agent(kconn))
+	return !c.closeFlag.Load()
+}
+
+func (c *KcpClient) dial() (*tcp.TcpConn, net.Conn, error) {
+	block, err := kcp.NewAESBlockCrypt(c.conf.CryptKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	sess, err := kcp.DialWithOptions(c.conf.Addr, block, c.conf.DataShards, c.conf.ParityShards)
+	if err != nil {
+		return nil, nil, err
+	}
+	sess.SetNoDelay(*c.conf.NoDelay, *c.conf.Interval, *c.conf.Resend, *c.conf.NC)
+
+	kconn := tcp.NewTcpConn(sess, &tcp.TcpConnConf{
+		PendingWrite: c.conf.Pending,
+	}).WithParse(c.parser)
+
+	c.mu.Lock()
+	// Closed while dialing
+	if c.closeFlag.Load() {
+		c.mu.Unlock()
+		kconn.Destroy()
+		return nil, nil, errors.New("client stopped")
+	}
+	c.conns[sess] = struct{}{}
+	c.mu.Unlock()
+
+	return kconn, sess, nil
+}
+
+func (c *KcpClient) Close() {
+	c.mu.Lock()
+	if c.closeFlag.Load() {
+		c.mu.Unlock()
+		return
+	}
+	c.closeFlag.Store(true)
+	close(c.done)
+
+	for conn := range c.conns {
+		conn.Close()
+		delete(c.conns, conn)
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+}
+
+func defaultClientConf(conf *KcpClientConf) {
+	if conf.DataShards <= 0 {
+		conf.DataShards = defaultDataShards
+	}
+	if conf.ParityShards <= 0 {
+		conf.ParityShards = defaultParityShards
+	}
+	if conf.CryptKey == nil {
+		conf.CryptKey = []byte(defaultCryptKey)
+	}
+	if conf.ReconnectInterval <= 0 {
+		conf.ReconnectInterval = defaultReconnectInterval
+	}
+	if conf.NoDelay == nil {
+		v := defaultNoDelay
+		conf.NoDelay = &v
+	}
+	if conf.Interval == nil {
+		v := defaultInterval
+		conf.Interval = &v
+	}
+	if conf.Resend == nil {
+		v := defaultResend
+		conf.Resend = &v
+	}
+	if conf.NC == nil {
+		v := defaultNC
+		conf.NC = &v
+	}
+}
@@ -10,7 +10,9 @@ import (
 	"github.com/czx-lab/czx/network/metrics"
 	"github.com/czx-lab/czx/network/tcp"
 	"github.com/czx-lab/czx/prometheus"
+	"github.com/czx-lab/czx/xlog"
 	"github.com/xtaci/kcp-go/v5"
+	"go.uber.org/zap"
 )
 
 const (
@@ -30,6 +32,7 @@ const (
 type (
 	KcpServerConf struct {
 		tcp.TcpConnConf
+		tcp.MessageParserConf
 		CryptKey []byte // Key for encryption
 		Addr     string // Address to listen on
 		// Number of data shards
@@ -43,7 +46,10 @@ type (
 		// If false, the server will wait for all active connections to close gracefully before releasing resources.
 		// Default is false.
 		ImmediateRelease bool
-		Metrics          metrics.SvrMetricsConf
+		// StopTimeout bounds the time Stop waits for the active connections to finish,
+		// the remaining ones are then destroyed. Zero waits indefinitely.
+		StopTimeout time.Duration
+		Metrics     metrics.SvrMetricsConf
 
 		// KCP Parameters
 		NoDelay  *int
@@ -59,15 +65,20 @@ type (
 		connWait sync.WaitGroup
 		conns    tcp.Conns // Map of connections
 		agent    func(*tcp.TcpConn) network.Agent
+		parse    *tcp.MessageParser
 		metrics  network.ServerMetrics
 	}
 )
 
+var _ network.GracefulServer = (*KcpServer)(nil)
+
 func NewKcpServer(conf KcpServerConf, agent func(*tcp.TcpConn) network.Agent) *KcpServer {
 	defaultConf(&conf)
 	var m network.ServerMetrics
 	if prometheus.Enabled() {
-		m = metrics.NewSvrMetrics(conf.Metrics)
+		mconf := conf.Metrics
+		mconf.Transport = "kcp"
+		m = metrics.NewSvrMetrics(mconf)
 	} else {
 		m = &network.NoopServerMetrics{}
 	}
@@ -75,6 +86,7 @@ func NewKcpServer(conf KcpServerConf, agent func(*tcp.TcpConn) network.Agent) *K
 		conf:    conf,
 		agent:   agent,
 		conns:   make(tcp.Conns),
+		parse:   tcp.NewParse(&conf.MessageParserConf),
 		metrics: m,
 	}
 }
@@ -144,12 +156,11 @@ func (srv *KcpServer) run() {
 		srv.metrics.IncTotalConns()
 		srv.connWait.Add(1)
 
-		kcpconn := tcp.NewTcpConn(conn, &srv.conf.TcpConnConf).WithMetrics(srv.metrics)
+		kcpconn := tcp.NewTcpConn(conn, &srv.conf.TcpConnConf).WithParse(srv.parse).WithMetrics(srv.metrics)
 		agent := srv.agent(kcpconn)
 
-		ip, port, _ := network.GetClientIPFromProxyProtocol(conn)
 		// Set the IP and port in the agent
-		clientAddr := network.ClientAddrMessage{IP: *ip, Port: *port}
+		clientAddr := network.ConnClientAddr(conn)
 		kcpconn.WithClientAddr(clientAddr)
 
 		agent.OnPreConn(clientAddr)
@@ -178,23 +189,36 @@ func (srv *KcpServer) run() {
 	}
 }
 
+// StopAccept implements network.GracefulServer.
+// It closes the listener and waits for the accept loop to exit, active connections stay open.
+func (srv *KcpServer) StopAccept() {
+	srv.ln.Close()
+	srv.lnWait.Wait()
+}
+
 // Stop stops the KCP server and closes all connections.
-// It waits for all connections to finish processing before returning.
+// It waits for all connections to finish processing before returning, at most StopTimeout if set.
 func (srv *KcpServer) Stop() {
 	srv.ln.Close()
 	srv.lnWait.Wait()
 
 	srv.Lock()
-
-	// Remove all connections from the map
 	for conn := range srv.conns {
 		conn.Close()
 	}
-	srv.conns = make(tcp.Conns)
-
 	srv.Unlock()
 
-	srv.connWait.Wait()
+	if !network.WaitTimeout(&srv.connWait, srv.conf.StopTimeout) {
+		srv.Lock()
+		n := srv.conns.Destroy()
+		srv.Unlock()
+		xlog.Write().Warn("kcp server stop timeout, connections destroyed", zap.Int("count", n))
+	}
+
+	// Remove all connections from the map
+	srv.Lock()
+	srv.conns = make(tcp.Conns)
+	srv.Unlock()
 }
 
 func defaultConf(conf *KcpServerConf) {
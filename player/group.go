@@ -0,0 +1,90 @@
+package player
+
+import "sync"
+
+// Group is a named subset of the players of a manager, e.g. a team, a squad or a chat channel,
+// see PlayerManager.NewGroup. The members are kept by id and resolved to the current players on
+// every broadcast, so a membership survives the player reconnecting.
+type Group struct {
+	name    string
+	manager *PlayerManager
+	mu      sync.RWMutex
+	members map[string]struct{}
+}
+
+func newGroup(name string, manager *PlayerManager) *Group {
+	return &Group{
+		name:    name,
+		manager: manager,
+		members: make(map[string]struct{}),
+	}
+}
+
+// Name returns the name of the group.
+func (g *Group) Name() string {
+	return g.name
+}
+
+// Add adds the players with the given ids to the group, they need not be connected.
+func (g *Group) Add(ids ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, id := range ids {
+		g.members[id] = struct{}{}
+	}
+}
+
+// Remove removes the players with the given ids from the group.
+func (g *Group) Remove(ids ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, id := range ids {
+		delete(g.members, id)
+	}
+}
+
+// Has reports whether the player with the id is a member of the group.
+func (g *Group) Has(id string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	_, ok := g.members[id]
+	return ok
+}
+
+// Members returns the ids of the members of the group.
+func (g *Group) Members() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	ids := make([]string, 0, len(g.members))
+	for id := range g.members {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Len returns the number of members of the group.
+func (g *Group) Len() int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return len(g.members)
+}
+
+// Broadcast sends a message to the members of the group registered in the manager.
+// Members that are not registered, e.g. while reconnecting, are skipped.
+func (g *Group) Broadcast(msg BroadcastMessage) error {
+	for _, id := range g.Members() {
+		player, ok := g.manager.Get(id)
+		if !ok {
+			continue
+		}
+
+		g.manager.send(player, msg)
+	}
+
+	return nil
+}
@@ -17,11 +17,24 @@ var DefaultHeartbeatInterval = 5
 type (
 	HeartbeatConf struct {
 		cmap.Option[*Player]
+		// Timeout is the maximum time a player may stay silent, see Player.Alive.
+		// A value less than or equal to zero disables the timeout.
+		Timeout time.Duration
+		// OnTimeout is called, outside of the heartbeat loop lock, for every player that missed the deadline.
+		// The player is unregistered from the heartbeat manager before the call.
+		OnTimeout func(*Player)
+		// Stagger spreads the heartbeats over the interval instead of sending them all at once.
+		// Players are bucketed by their shard (Option.Count buckets) and each bucket is processed
+		// at its own phase offset, so every player is still visited once per interval.
+		Stagger bool
 	}
 	// Heartbeat manages the heartbeat process for players.
 	Heartbeat struct {
+		conf    HeartbeatConf
 		players *cmap.Shareded[*Player, struct{}]
 		ticker  *time.Ticker
+		// slot is the next shard processed when staggering
+		slot    int
 		stop    chan struct{}
 		wg      sync.WaitGroup
 		started atomic.Bool
@@ -39,6 +52,7 @@ var GlobalHeartbeat *Heartbeat = NewHeartbeat(HeartbeatConf{
 
 func NewHeartbeat(conf HeartbeatConf, r recycler.Recycler) *Heartbeat {
 	return &Heartbeat{
+		conf: conf,
 		players: cmap.NewSharded[*Player, struct{}](
 			conf.Option, r,
 		),
@@ -55,6 +69,12 @@ func (hm *Heartbeat) Start(interval time.Duration) {
 
 	hm.wg.Add(1)
 	hm.stop = make(chan struct{})
+	if hm.conf.Stagger {
+		interval /= time.Duration(hm.players.Count())
+		if interval <= 0 {
+			interval = time.Millisecond
+		}
+	}
 	hm.ticker = time.NewTicker(interval)
 	go func() {
 		defer func() {
@@ -67,10 +87,12 @@ func (hm *Heartbeat) Start(interval time.Duration) {
 		for {
 			select {
 			case <-hm.ticker.C:
-				hm.players.Iterator(func(s1 *Player, s2 struct{}) bool {
-					s1.Heartbeat()
-					return true
-				})
+				if hm.conf.Stagger {
+					hm.tick(hm.slot)
+					hm.slot = (hm.slot + 1) % hm.players.Count()
+					continue
+				}
+				hm.tick(-1)
 			case <-hm.stop:
 				return
 			}
@@ -78,6 +100,36 @@ func (hm *Heartbeat) Start(interval time.Duration) {
 	}()
 }
 
+// tick sends the heartbeat to every alive player and evicts the ones that missed the deadline.
+// With a non negative slot only the players of that shard are visited.
+func (hm *Heartbeat) tick(slot int) {
+	var expired []*Player
+
+	now := time.Now()
+	visit := func(player *Player, _ struct{}) bool {
+		if hm.conf.Timeout > 0 && now.Sub(player.LastSeen()) > hm.conf.Timeout {
+			expired = append(expired, player)
+			return true
+		}
+
+		player.Heartbeat()
+		return true
+	}
+	if slot < 0 {
+		hm.players.Iterator(visit)
+	} else {
+		hm.players.ShardIterator(slot, visit)
+	}
+
+	// Evict outside of the iterator, the callback usually removes the player
+	for _, player := range expired {
+		hm.Unregister(player)
+		if hm.conf.OnTimeout != nil {
+			hm.conf.OnTimeout(player)
+		}
+	}
+}
+
 // Stop stops the heartbeat process and closes the stop channel.
 // It should be called when the application is shutting down to clean up resources.
 func (hm *Heartbeat) Stop() {
@@ -95,7 +147,9 @@ func (hm *Heartbeat) Stop() {
 
 // Register adds a player to the heartbeat manager.
 // It should be called when a player is created or connected to the server.
+// The player is considered alive at registration time.
 func (hm *Heartbeat) Register(player *Player) {
+	player.Alive()
 	hm.players.Set(player, struct{}{})
 }
 
@@ -10,6 +10,9 @@ import (
 
 	"github.com/czx-lab/czx/container/cmap"
 	"github.com/czx-lab/czx/container/recycler"
+	"github.com/czx-lab/czx/network"
+	"github.com/czx-lab/czx/xlog"
+	"go.uber.org/zap"
 )
 
 var ErrPlayerAdded = errors.New("player already added")
@@ -18,6 +21,11 @@ type (
 	ManagerConf struct {
 		// Heartbeat interval in seconds
 		HeartbeatInterval int
+		// HeartbeatTimeout removes the players that are not marked alive within the duration.
+		// A value less than or equal to zero disables the timeout.
+		HeartbeatTimeout time.Duration
+		// HeartbeatStagger spreads the heartbeats over the interval, see HeartbeatConf.Stagger.
+		HeartbeatStagger bool
 		cmap.Option[string]
 	}
 	PlayerManager struct {
@@ -25,7 +33,13 @@ type (
 		players   *cmap.Shareded[string, *Player]
 		closed    atomic.Bool
 		heartbeat *Heartbeat
+		store     PlayerStore
 		mu        sync.RWMutex
+		// dead holds the ids of the players skipped by broadcasts because their connection is gone
+		dead   map[string]struct{}
+		deadMu sync.Mutex
+		// groups by name, see NewGroup
+		groups map[string]*Group
 	}
 	// BroadcastMessage is a struct that represents a message to be broadcasted to players.
 	BroadcastMessage struct {
@@ -35,20 +49,36 @@ type (
 )
 
 func NewPlayerManager(conf *ManagerConf, r recycler.Recycler) *PlayerManager {
-	return &PlayerManager{
+	manager := &PlayerManager{
 		conf:    conf,
 		players: cmap.NewSharded[string, *Player](conf.Option, r),
-		heartbeat: NewHeartbeat(HeartbeatConf{
-			Option: cmap.Option[*Player]{
-				Count: conf.Count,
-				Hash: func(p *Player) int {
-					h := fnv.New32a()
-					h.Write([]byte(p.ID()))
-					return int(h.Sum32())
-				},
+		dead:    make(map[string]struct{}),
+		groups:  make(map[string]*Group),
+	}
+
+	hbconf := HeartbeatConf{
+		Option: cmap.Option[*Player]{
+			Count: conf.Count,
+			Hash: func(p *Player) int {
+				h := fnv.New32a()
+				h.Write([]byte(p.ID()))
+				return int(h.Sum32())
 			},
-		}, r),
+		},
+		Timeout: conf.HeartbeatTimeout,
+		Stagger: conf.HeartbeatStagger,
+	}
+	if conf.HeartbeatTimeout > 0 {
+		hbconf.OnTimeout = func(player *Player) {
+			// Only evict the timed-out instance, the id may have been reused meanwhile
+			if current, ok := manager.Get(player.ID()); ok && current == player {
+				manager.Remove(player.ID(), false)
+			}
+		}
 	}
+	manager.heartbeat = NewHeartbeat(hbconf, r)
+
+	return manager
 }
 
 // WithHeartbeat sets the heartbeat manager for the player manager.
@@ -60,6 +90,41 @@ func (p *PlayerManager) WithHeartbeat(hb *Heartbeat) *PlayerManager {
 	return p
 }
 
+// WithStore sets the store persisting the player snapshots, see Player.OnSnapshot and Player.OnRestore.
+func (p *PlayerManager) WithStore(store PlayerStore) *PlayerManager {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.store = store
+	return p
+}
+
+// Resume restores the player data from the store, then adds the player to the player manager.
+// The player is not added if the restoration fails.
+func (p *PlayerManager) Resume(player *Player) error {
+	if p.players.Has(player.ID()) {
+		return ErrPlayerAdded
+	}
+
+	p.mu.RLock()
+	store := p.store
+	p.mu.RUnlock()
+
+	if store != nil && player.restore != nil {
+		data, ok, err := store.Load(player.ID())
+		if err != nil {
+			return err
+		}
+		if ok {
+			if err := player.restore(data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return p.Add(player)
+}
+
 // Add adds a new player to the player manager. If the player already exists, it returns an error.
 // It returns an error if the player already exists.
 func (p *PlayerManager) Add(player *Player) error {
@@ -68,6 +133,8 @@ func (p *PlayerManager) Add(player *Player) error {
 	}
 
 	p.players.Set(player.ID(), player)
+	// A player coming back with a new connection is not dead anymore
+	p.forget(player.ID())
 
 	p.mu.RLock()
 	heartbeat := p.heartbeat
@@ -105,7 +172,7 @@ func (p *PlayerManager) Get(id string) (*Player, bool) {
 // Start starts the heartbeat process for all registered players at the specified interval.
 // It sends a heartbeat signal to each player at the specified interval.
 func (p *PlayerManager) Start() {
-	if !p.closed.Load() {
+	if p.closed.Load() {
 		return
 	}
 
@@ -137,6 +204,33 @@ func (p *PlayerManager) Players() []*Player {
 	return players
 }
 
+// PlayersSorted returns the players ordered with less, e.g. ByID, for deterministic snapshots,
+// replays or seat assignments. Players is cheaper when the order does not matter.
+func (p *PlayerManager) PlayersSorted(less func(a, b *Player) bool) []*Player {
+	players := p.Players()
+	slices.SortStableFunc(players, func(a, b *Player) int {
+		switch {
+		case less(a, b):
+			return -1
+		case less(b, a):
+			return 1
+		}
+		return 0
+	})
+
+	return players
+}
+
+// ByID orders the players by id, see PlayersSorted.
+func ByID(a, b *Player) bool {
+	return a.ID() < b.ID()
+}
+
+// ShardStats returns the number of players of every shard of the manager, see cmap.Option.Count.
+func (p *PlayerManager) ShardStats() []int {
+	return p.players.ShardStats()
+}
+
 // Num returns the number of players in the player manager.
 func (p *PlayerManager) Num() int {
 	return p.players.Len()
@@ -151,6 +245,7 @@ func (p *PlayerManager) Delete(id string) {
 	player, _ := p.players.Get(id)
 	player.StopHeartbeat()
 	p.players.Delete(id)
+	p.forget(id)
 }
 
 // Remove removes a player from the player manager.
@@ -161,6 +256,7 @@ func (p *PlayerManager) Remove(id string, destroy bool) {
 
 	// Unregister from heartbeat manager
 	player, _ := p.players.Get(id)
+	p.save(player)
 	if destroy {
 		player.Destroy()
 	} else {
@@ -168,31 +264,146 @@ func (p *PlayerManager) Remove(id string, destroy bool) {
 	}
 
 	p.players.Delete(id)
+	p.forget(id)
+}
+
+// save writes the snapshot of the player to the store, if any.
+func (p *PlayerManager) save(player *Player) {
+	p.mu.RLock()
+	store := p.store
+	p.mu.RUnlock()
+
+	if store == nil || player.snapshot == nil {
+		return
+	}
+
+	data, err := player.snapshot()
+	if err == nil {
+		err = store.Save(player.ID(), data)
+	}
+	if err != nil {
+		xlog.Write().Warn("player snapshot failed", zap.String("id", player.ID()), zap.Error(err))
+	}
 }
 
 // Rang iterates over all players and applies the provided function to each player.
+// The function runs on a snapshot of the players taken under short shard locks, so a slow
+// write does not block Add, Remove or Delete, and the function may itself call them.
 func (p *PlayerManager) Rang(fn func(*Player)) error {
-	p.players.Iterator(func(_ string, player *Player) bool {
+	for _, player := range p.Players() {
 		fn(player)
-		return true
-	})
+	}
 
 	return nil
 }
 
 // Broadcast sends a message to all players.
 // It can be used to send game updates, notifications, etc.
+// Players whose connection is gone are skipped by all the broadcasts, see Dead.
 func (p *PlayerManager) Broadcast(msg BroadcastMessage) error {
 	return p.Rang(func(player *Player) {
-		if msg.Code == 0 {
-			player.Agent().Write(msg.Data)
-			return
-		}
-
-		player.Agent().WriteWithCode(uint(msg.Code), msg.Data)
+		p.send(player, msg)
 	})
 }
 
+// Send writes the message to a player of the manager, e.g. to broadcast to the players of a room.
+// A player whose connection is gone is skipped and recorded for eviction, see Dead.
+func (p *PlayerManager) Send(player *Player, msg BroadcastMessage) {
+	p.send(player, msg)
+}
+
+// send writes the message to the player, players whose connection is gone are skipped
+// and recorded for eviction, see Dead.
+func (p *PlayerManager) send(player *Player, msg BroadcastMessage) {
+	agent := player.Agent()
+	if !p.alive(player, agent) {
+		return
+	}
+
+	if msg.Code == 0 {
+		agent.Write(msg.Data)
+		return
+	}
+
+	agent.WriteWithCode(uint(msg.Code), msg.Data)
+}
+
+// alive reports whether the agent of the player can be written to, it records the player otherwise.
+func (p *PlayerManager) alive(player *Player, agent network.Agent) bool {
+	if agent == nil {
+		return false
+	}
+	if agent.IsAlive() {
+		return true
+	}
+
+	p.deadMu.Lock()
+	p.dead[player.ID()] = struct{}{}
+	p.deadMu.Unlock()
+	return false
+}
+
+// Dead returns the ids of the players skipped by broadcasts because their connection is gone,
+// since the last call. They are still registered and should be removed by the caller.
+func (p *PlayerManager) Dead() []string {
+	p.deadMu.Lock()
+	defer p.deadMu.Unlock()
+
+	ids := make([]string, 0, len(p.dead))
+	for id := range p.dead {
+		ids = append(ids, id)
+	}
+	clear(p.dead)
+	return ids
+}
+
+// forget drops the player from the dead players, so that the set only holds registered players.
+func (p *PlayerManager) forget(id string) {
+	p.deadMu.Lock()
+	delete(p.dead, id)
+	p.deadMu.Unlock()
+}
+
+// NewGroup returns the group with the name, creating it if it does not exist yet.
+func (p *PlayerManager) NewGroup(name string) *Group {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if g, ok := p.groups[name]; ok {
+		return g
+	}
+
+	g := newGroup(name, p)
+	p.groups[name] = g
+	return g
+}
+
+// Group returns the group with the name.
+func (p *PlayerManager) Group(name string) (*Group, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	g, ok := p.groups[name]
+	return g, ok
+}
+
+// RemoveGroup removes the group with the name, its members stay registered in the manager.
+func (p *PlayerManager) RemoveGroup(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.groups, name)
+}
+
+// BroadcastSorted sends a message to all players like Broadcast, in the order given by less.
+func (p *PlayerManager) BroadcastSorted(msg BroadcastMessage, less func(a, b *Player) bool) error {
+	for _, player := range p.PlayersSorted(less) {
+		p.send(player, msg)
+	}
+
+	return nil
+}
+
 // BroadcastExcepts sends a message to all players except the specified ones.
 func (p *PlayerManager) BroadcastExcepts(msg BroadcastMessage, ids ...string) error {
 	return p.Rang(func(player *Player) {
@@ -200,12 +411,7 @@ func (p *PlayerManager) BroadcastExcepts(msg BroadcastMessage, ids ...string) er
 			return
 		}
 
-		if msg.Code == 0 {
-			player.Agent().Write(msg.Data)
-			return
-		}
-
-		player.Agent().WriteWithCode(uint(msg.Code), msg.Data)
+		p.send(player, msg)
 	})
 }
 
@@ -217,12 +423,7 @@ func (p *PlayerManager) BroadcastByIds(msg BroadcastMessage, ids ...string) erro
 			return
 		}
 
-		if msg.Code == 0 {
-			player.Agent().Write(msg.Data)
-			return
-		}
-
-		player.Agent().WriteWithCode(uint(msg.Code), msg.Data)
+		p.send(player, msg)
 	})
 }
 
@@ -234,12 +435,48 @@ func (p *PlayerManager) BroadcastByFunc(msg BroadcastMessage, fn func(*Player) b
 			return
 		}
 
-		if msg.Code == 0 {
-			player.Agent().Write(msg.Data)
+		p.send(player, msg)
+	})
+}
+
+// BroadcastRaw sends a message to all players, marshaling it only once.
+// The message is encoded with the processor of the first player and the resulting frames are
+// written to every connection, so all players must share the same processor.
+func (p *PlayerManager) BroadcastRaw(code uint16, data any) error {
+	var (
+		frames [][]byte
+		err    error
+	)
+	p.Rang(func(player *Player) {
+		if err != nil {
 			return
 		}
 
-		player.Agent().WriteWithCode(uint(msg.Code), msg.Data)
+		agent := player.Agent()
+		if !p.alive(player, agent) {
+			return
+		}
+		if frames == nil {
+			if frames, err = agent.Marshal(uint(code), data); err != nil {
+				return
+			}
+		}
+
+		agent.WriteRaw(frames...)
+	})
+
+	return err
+}
+
+// Flush writes the messages buffered by the agents of all players, see network.Agent.Buffer.
+// It is typically called at the end of a frame loop tick, see frame.FrameLoop.WithTickEnd.
+func (p *PlayerManager) Flush() {
+	p.Rang(func(player *Player) {
+		agent := player.Agent()
+		if !p.alive(player, agent) {
+			return
+		}
+		agent.Flush()
 	})
 }
 
@@ -260,3 +497,17 @@ func (p *PlayerManager) Close() {
 	})
 	p.players.Clear()
 }
+
+// CloseWithReason tells all players why they are disconnected, then closes their connections
+// and cleans up resources. See network.Agent.CloseWithReason.
+func (p *PlayerManager) CloseWithReason(code uint16, msg any, reason string) {
+	if p.closed.Swap(true) {
+		return
+	}
+
+	p.players.Iterator(func(_ string, player *Player) bool {
+		player.CloseWithReason(code, msg, reason)
+		return true
+	})
+	p.players.Clear()
+}
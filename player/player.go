@@ -1,6 +1,9 @@
 package player
 
 import (
+	"sync/atomic"
+	"time"
+
 	"github.com/czx-lab/czx/network"
 )
 
@@ -11,6 +14,11 @@ type Player struct {
 	agent          network.Agent
 	heartbeatLogic func(network.Agent)
 	heartbeat      *Heartbeat
+	// lastSeen is the unix nano time of the last inbound traffic
+	lastSeen atomic.Int64
+	// snapshot and restore persist the player data through the PlayerStore of the manager
+	snapshot func() ([]byte, error)
+	restore  func([]byte) error
 }
 
 func NewPlayer(agent network.Agent) *Player {
@@ -58,6 +66,18 @@ func (p *Player) WithData(data any) {
 	p.data = data
 }
 
+// OnSnapshot sets the function serializing the player data when the player is removed from
+// a PlayerManager with a PlayerStore.
+func (p *Player) OnSnapshot(fn func() ([]byte, error)) {
+	p.snapshot = fn
+}
+
+// OnRestore sets the function deserializing the player data when the player is resumed
+// by a PlayerManager with a PlayerStore holding a snapshot.
+func (p *Player) OnRestore(fn func([]byte) error) {
+	p.restore = fn
+}
+
 // Heartbeat sends a heartbeat signal to the player agent.
 // It can be used to check if the player is still connected or to perform any periodic task.
 func (p *Player) SetHeartbeatLogic(logic func(network.Agent)) {
@@ -73,6 +93,17 @@ func (p *Player) Heartbeat() {
 	p.heartbeatLogic(p.agent)
 }
 
+// Alive marks the player as alive, it should be called on every inbound message of the player.
+// Players that are not marked alive within HeartbeatConf.Timeout are evicted by the heartbeat manager.
+func (p *Player) Alive() {
+	p.lastSeen.Store(time.Now().UnixNano())
+}
+
+// LastSeen returns the last time the player was marked alive.
+func (p *Player) LastSeen() time.Time {
+	return time.Unix(0, p.lastSeen.Load())
+}
+
 // StopHeartbeat stops sending heartbeat signals to the player agent
 // This is typically called when the player is no longer needed or when the game session ends.
 func (p *Player) StopHeartbeat() {
@@ -94,6 +125,17 @@ func (p *Player) Close() {
 	p.StopHeartbeat()
 }
 
+// CloseWithReason sends a final message with the code to the player, closes the connection
+// with the reason and cleans up resources. See network.Agent.CloseWithReason.
+func (p *Player) CloseWithReason(code uint16, msg any, reason string) {
+	if p.agent != nil {
+		p.agent.CloseWithReason(code, msg, reason)
+	}
+
+	// Unregister from heartbeat manager
+	p.StopHeartbeat()
+}
+
 // Destroy cleans up the player resources and unregisters from the heartbeat manager
 // This is typically called when the player is no longer needed or when the game session ends.
 func (p *Player) Destroy() {
@@ -1,9 +1,14 @@
 package player
 
 import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/czx-lab/czx/container/cmap"
 	"github.com/czx-lab/czx/network"
 )
 
@@ -51,4 +56,368 @@ func TestPlayer(t *testing.T) {
 
 		t.Log("manager closed")
 	})
+	t.Run("TestHeartbeatTimeout", func(t *testing.T) {
+		evicted := make(chan *Player, 1)
+		hb := NewHeartbeat(HeartbeatConf{
+			Option:  cmap.Option[*Player]{Count: 2},
+			Timeout: 50 * time.Millisecond,
+			OnTimeout: func(p *Player) {
+				evicted <- p
+			},
+		}, nil)
+
+		p := NewPlayer(nil)
+		p.WithID("player_id_2")
+		hb.Register(p)
+		hb.Start(10 * time.Millisecond)
+		defer hb.Stop()
+
+		select {
+		case got := <-evicted:
+			if got != p {
+				t.Fatalf("unexpected player evicted: %v", got.ID())
+			}
+		case <-time.After(time.Second):
+			t.Fatal("player was not evicted")
+		}
+	})
+	t.Run("TestHeartbeatStagger", func(t *testing.T) {
+		hb := NewHeartbeat(HeartbeatConf{
+			Option:  cmap.Option[*Player]{Count: 4, Hash: func(p *Player) int { return cmap.HashString(p.ID()) }},
+			Stagger: true,
+		}, nil)
+
+		var mu sync.Mutex
+		pings := make(map[string]time.Time)
+		for i := range 32 {
+			p := NewPlayer(nil)
+			p.WithID(strconv.Itoa(i))
+			p.SetHeartbeatLogic(func(network.Agent) {
+				mu.Lock()
+				defer mu.Unlock()
+				if _, ok := pings[p.ID()]; !ok {
+					pings[p.ID()] = time.Now()
+				}
+			})
+			hb.Register(p)
+		}
+		hb.Start(200 * time.Millisecond)
+		time.Sleep(250 * time.Millisecond)
+		hb.Stop()
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(pings) != 32 {
+			t.Fatalf("%d players pinged within the interval, want 32", len(pings))
+		}
+		var first, last time.Time
+		for _, at := range pings {
+			if first.IsZero() || at.Before(first) {
+				first = at
+			}
+			if at.After(last) {
+				last = at
+			}
+		}
+		// 4 slots fired 50ms apart
+		if last.Sub(first) < 100*time.Millisecond {
+			t.Fatalf("heartbeats were not staggered: all sent within %v", last.Sub(first))
+		}
+	})
+}
+
+func TestBroadcastSkipsDead(t *testing.T) {
+	m := NewPlayerManager(&ManagerConf{Option: cmap.Option[string]{Count: 4}}, nil)
+	for i := range 4 {
+		p := NewPlayer(&benchAgent{conn: &benchConn{}, dead: i%2 == 1})
+		p.WithID(strconv.Itoa(i))
+		m.Add(p)
+	}
+
+	m.Broadcast(BroadcastMessage{Code: 1, Data: "hello"})
+	m.BroadcastRaw(1, "hello")
+
+	dead := m.Dead()
+	slices.Sort(dead)
+	if !slices.Equal(dead, []string{"1", "3"}) {
+		t.Fatalf("got %v, want [1 3]", dead)
+	}
+	if len(m.Dead()) != 0 {
+		t.Fatal("dead players should be reported once")
+	}
+
+	// Players leaving the manager or coming back are not reported
+	m.Broadcast(BroadcastMessage{Code: 1, Data: "hello"})
+	m.Delete("1")
+	p := NewPlayer(&benchAgent{conn: &benchConn{}})
+	p.WithID("3")
+	m.Delete("3")
+	m.Add(p)
+	if dead := m.Dead(); len(dead) != 0 {
+		t.Fatalf("got %v, want no dead players", dead)
+	}
+}
+
+type mapStore map[string][]byte
+
+func (s mapStore) Save(id string, data []byte) error {
+	s[id] = data
+	return nil
+}
+
+func (s mapStore) Load(id string) ([]byte, bool, error) {
+	data, ok := s[id]
+	return data, ok, nil
+}
+
+func TestPlayerStore(t *testing.T) {
+	store := mapStore{}
+	m := NewPlayerManager(&ManagerConf{Option: cmap.Option[string]{Count: 4}}, nil).WithStore(store)
+	defer m.Close()
+
+	newPlayer := func() *Player {
+		p := NewPlayer(nil)
+		p.WithID("player_id_1")
+		p.OnSnapshot(func() ([]byte, error) {
+			return json.Marshal(p.Data())
+		})
+		p.OnRestore(func(data []byte) error {
+			var score int
+			if err := json.Unmarshal(data, &score); err != nil {
+				return err
+			}
+			p.WithData(score)
+			return nil
+		})
+		return p
+	}
+
+	p := newPlayer()
+	p.WithData(42)
+	if err := m.Resume(p); err != nil {
+		t.Fatal(err)
+	}
+	m.Remove(p.ID(), true)
+	if string(store["player_id_1"]) != "42" {
+		t.Fatalf("snapshot: got %q, want 42", store["player_id_1"])
+	}
+
+	resumed := newPlayer()
+	if err := m.Resume(resumed); err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Data() != 42 {
+		t.Fatalf("restored data: got %v, want 42", resumed.Data())
+	}
+	if err := m.Resume(newPlayer()); err != ErrPlayerAdded {
+		t.Fatalf("got %v, want ErrPlayerAdded", err)
+	}
+}
+
+type (
+	benchConn struct {
+		network.Conn
+	}
+	benchAgent struct {
+		network.Agent
+		conn *benchConn
+		dead bool
+	}
+	benchMessage struct {
+		ID    int
+		Name  string
+		Items []int
+	}
+)
+
+func (c *benchConn) WriteMessage(args ...[]byte) error { return nil }
+
+func (a *benchAgent) IsAlive() bool { return !a.dead }
+
+func (a *benchAgent) Conn() network.Conn { return a.conn }
+
+func (a *benchAgent) Write(msg any) error {
+	data, err := a.Marshal(0, msg)
+	if err != nil {
+		return err
+	}
+	return a.conn.WriteMessage(data...)
+}
+
+func (a *benchAgent) WriteWithCode(code uint, msg any) error {
+	data, err := a.Marshal(code, msg)
+	if err != nil {
+		return err
+	}
+	return a.conn.WriteMessage(data...)
+}
+
+func (a *benchAgent) WriteRaw(frames ...[]byte) error { return a.conn.WriteMessage(frames...) }
+
+func (a *benchAgent) Marshal(code uint, msg any) ([][]byte, error) {
+	data, err := json.Marshal(msg)
+	return [][]byte{{byte(code)}, data}, err
+}
+
+func newBenchManager(b *testing.B, n int) *PlayerManager {
+	m := NewPlayerManager(&ManagerConf{Option: cmap.Option[string]{Count: 32}}, nil)
+	for i := range n {
+		p := NewPlayer(&benchAgent{conn: &benchConn{}})
+		p.WithID(strconv.Itoa(i))
+		if err := m.Add(p); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return m
+}
+
+func BenchmarkBroadcast(b *testing.B) {
+	m := newBenchManager(b, 10000)
+	msg := BroadcastMessage{Code: 1, Data: &benchMessage{ID: 1, Name: "broadcast", Items: []int{1, 2, 3, 4, 5}}}
+
+	for b.Loop() {
+		m.Broadcast(msg)
+	}
+}
+
+func BenchmarkBroadcastRaw(b *testing.B) {
+	m := newBenchManager(b, 10000)
+	data := &benchMessage{ID: 1, Name: "broadcast", Items: []int{1, 2, 3, 4, 5}}
+
+	for b.Loop() {
+		m.BroadcastRaw(1, data)
+	}
+}
+
+// slowAgent signals entered and blocks the writes until release is closed
+type slowAgent struct {
+	benchAgent
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (a *slowAgent) WriteWithCode(code uint, msg any) error {
+	a.entered <- struct{}{}
+	<-a.release
+	return nil
+}
+
+func TestBroadcastChurn(t *testing.T) {
+	// A single shard makes every membership change wait for a broadcast holding the lock
+	m := NewPlayerManager(&ManagerConf{Option: cmap.Option[string]{Count: 1}}, nil)
+	agent := &slowAgent{entered: make(chan struct{}), release: make(chan struct{})}
+	slow := NewPlayer(agent)
+	slow.WithID("slow")
+	m.Add(slow)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.Broadcast(BroadcastMessage{Code: 1, Data: "hello"})
+	}()
+	<-agent.entered
+
+	churned := make(chan struct{})
+	go func() {
+		defer close(churned)
+		for i := range 100 {
+			p := NewPlayer(&benchAgent{conn: &benchConn{}})
+			p.WithID(strconv.Itoa(i))
+			m.Add(p)
+			m.Delete(p.ID())
+		}
+	}()
+
+	select {
+	case <-churned:
+	case <-time.After(2 * time.Second):
+		t.Fatal("membership changes blocked by a slow broadcast")
+	}
+
+	close(agent.release)
+	wg.Wait()
+}
+
+// countAgent counts the messages written with a code
+type countAgent struct {
+	benchAgent
+	writes int
+}
+
+func (a *countAgent) WriteWithCode(code uint, msg any) error {
+	a.writes++
+	return nil
+}
+
+func TestGroupBroadcast(t *testing.T) {
+	m := NewPlayerManager(&ManagerConf{Option: cmap.Option[string]{Count: 4}}, nil)
+	add := func(id string) *countAgent {
+		agent := &countAgent{benchAgent: benchAgent{conn: &benchConn{}}}
+		p := NewPlayer(agent)
+		p.WithID(id)
+		m.Add(p)
+		return agent
+	}
+	red, blue := add("red"), add("blue")
+
+	team := m.NewGroup("team")
+	if m.NewGroup("team") != team {
+		t.Fatal("NewGroup must return the existing group")
+	}
+	team.Add("red", "offline")
+	team.Broadcast(BroadcastMessage{Code: 1, Data: "attack"})
+	if red.writes != 1 || blue.writes != 0 {
+		t.Fatalf("got red %d blue %d, want the team only", red.writes, blue.writes)
+	}
+
+	// The membership survives a reconnect
+	m.Delete("red")
+	reconnected := add("red")
+	team.Broadcast(BroadcastMessage{Code: 1, Data: "regroup"})
+	if reconnected.writes != 1 || red.writes != 1 {
+		t.Fatalf("got old %d new %d, want the reconnected player", red.writes, reconnected.writes)
+	}
+
+	m.RemoveGroup("team")
+	if _, ok := m.Group("team"); ok {
+		t.Fatal("the group must be removed")
+	}
+}
+
+// orderAgent appends its id to the shared order on every write
+type orderAgent struct {
+	benchAgent
+	id    string
+	order *[]string
+}
+
+func (a *orderAgent) WriteWithCode(code uint, msg any) error {
+	*a.order = append(*a.order, a.id)
+	return nil
+}
+
+func TestPlayersSorted(t *testing.T) {
+	m := NewPlayerManager(&ManagerConf{Option: cmap.Option[string]{Count: 8}}, nil)
+	var order []string
+	ids := []string{"d", "a", "c", "e", "b"}
+	for _, id := range ids {
+		p := NewPlayer(&orderAgent{benchAgent: benchAgent{conn: &benchConn{}}, id: id, order: &order})
+		p.WithID(id)
+		m.Add(p)
+	}
+
+	want := []string{"a", "b", "c", "d", "e"}
+	var got []string
+	for _, p := range m.PlayersSorted(ByID) {
+		got = append(got, p.ID())
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	m.BroadcastSorted(BroadcastMessage{Code: 1, Data: "turn"}, ByID)
+	if !slices.Equal(order, want) {
+		t.Fatalf("broadcast order %v, want %v", order, want)
+	}
 }
@@ -0,0 +1,10 @@
+package player
+
+// PlayerStore persists the player snapshots between a disconnection and a reconnection.
+// Implementations decide how long snapshots are kept, e.g. with a TTL in a Redis or NATS KV backend.
+type PlayerStore interface {
+	// Save stores the snapshot of the player, replacing any previous one.
+	Save(id string, data []byte) error
+	// Load returns the snapshot of the player, ok is false if there is none.
+	Load(id string) (data []byte, ok bool, err error)
+}
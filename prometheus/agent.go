@@ -1,18 +1,23 @@
 package prometheus
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"sync"
 	"sync/atomic"
 
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var (
 	once    sync.Once
 	enabled atomic.Bool
+	// registry is the registry set with UseRegistry, nil for the global default one
+	registry atomic.Pointer[prom.Registry]
 )
 
 // A Config is a prometheus config.
@@ -32,13 +37,55 @@ func Enable() {
 	enabled.Store(true)
 }
 
+// Registry returns the registry the metrics of the metrics package are registered to and
+// exposed from by Handler: the global default registry of client_golang, which already has
+// the Go runtime and process collectors, unless another one is set with UseRegistry.
+func Registry() *prom.Registry {
+	if reg := registry.Load(); reg != nil {
+		return reg
+	}
+	if reg, ok := prom.DefaultRegisterer.(*prom.Registry); ok {
+		return reg
+	}
+
+	reg := prom.NewRegistry()
+	registry.CompareAndSwap(nil, reg)
+	return registry.Load()
+}
+
+// UseRegistry registers the metrics created from now on to reg instead of the global default registry,
+// e.g. to run several instances in the tests. The Go runtime and process collectors are registered to reg.
+// A nil reg goes back to the global default registry.
+func UseRegistry(reg *prom.Registry) error {
+	if reg != nil {
+		for _, c := range []prom.Collector{
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		} {
+			if err := reg.Register(c); err != nil && !errors.As(err, &prom.AlreadyRegisteredError{}) {
+				return err
+			}
+		}
+	}
+
+	registry.Store(reg)
+	return nil
+}
+
+// Handler returns the handler exposing the metrics of Registry, to be mounted on the
+// application mux instead of running the server of Start.
+func Handler() http.Handler {
+	reg := Registry()
+	return promhttp.InstrumentMetricHandler(reg, promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+}
+
 // Start starts the Prometheus metrics server.
 func Start(c Config) {
 	defaultConfig(&c)
 	once.Do(func() {
 		Enable()
 		go func() {
-			http.Handle(c.Path, promhttp.Handler())
+			http.Handle(c.Path, Handler())
 			addr := fmt.Sprintf("%s:%d", c.Host, c.Port)
 			if err := http.ListenAndServe(addr, nil); err != nil {
 				log.Fatalf("prometheus: failed to start prometheus metrics server: %v", err)
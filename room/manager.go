@@ -2,11 +2,13 @@ package room
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 	"sync/atomic"
 
 	"github.com/czx-lab/czx/container/cmap"
 	"github.com/czx-lab/czx/container/recycler"
+	"github.com/czx-lab/czx/player"
 	"github.com/czx-lab/czx/xlog"
 
 	"go.uber.org/zap"
@@ -15,18 +17,37 @@ import (
 var ErrRoomExists = errors.New("room already exists")
 
 type RoomManager struct {
-	wg     sync.WaitGroup
-	rooms  *cmap.Shareded[string, *Room]
-	closed atomic.Bool
+	wg      sync.WaitGroup
+	rooms   *cmap.Shareded[string, *Room]
+	closed  atomic.Bool
+	metrics Metrics
+}
+
+// RoomInfo describes a room in the lobby listing, see RoomManager.Listing.
+type RoomInfo struct {
+	ID        string
+	Players   int
+	MaxPlayer int
+	// Private rooms require a password, see Room.JoinWithPassword
+	Private bool
+	Running bool
 }
 
 // NewRoomManager creates a new RoomManager instance.
 func NewRoomManager(opt cmap.Option[string], r recycler.Recycler) *RoomManager {
 	return &RoomManager{
-		rooms: cmap.NewSharded[string, *Room](opt, r),
+		rooms:   cmap.NewSharded[string, *Room](opt, r),
+		metrics: &NoopMetrics{},
 	}
 }
 
+// WithMetrics sets the metrics for the RoomManager instance.
+// It must be called before any room is added.
+func (rm *RoomManager) WithMetrics(m Metrics) *RoomManager {
+	rm.metrics = m
+	return rm
+}
+
 // Add adds a new room to the manager.
 func (rm *RoomManager) Add(room *Room) error {
 	if rm.rooms.Has(room.ID()) {
@@ -34,6 +55,8 @@ func (rm *RoomManager) Add(room *Room) error {
 	}
 
 	rm.rooms.Set(room.ID(), room)
+	rm.metrics.IncRooms()
+	room.withMetrics(rm.metrics)
 
 	rm.wg.Add(1)
 	go func() {
@@ -58,6 +81,8 @@ func (rm *RoomManager) Remove(roomID string) {
 	room.Stop()
 
 	rm.rooms.Delete(roomID)
+	rm.metrics.DecRooms()
+	room.withMetrics(&NoopMetrics{})
 }
 
 // Get retrieves a room by its ID.
@@ -90,6 +115,8 @@ func (rm *RoomManager) Stop() {
 	// Stop all rooms synchronously.
 	rm.rooms.Iterator(func(_ string, room *Room) bool {
 		room.Stop()
+		rm.metrics.DecRooms()
+		room.withMetrics(&NoopMetrics{})
 		return true
 	})
 
@@ -127,6 +154,37 @@ func (rm *RoomManager) RoomsPlayerNum() map[string]int {
 	return nums
 }
 
+// Listing returns the description of all the rooms, e.g. for a lobby.
+func (rm *RoomManager) Listing() []RoomInfo {
+	infos := make([]RoomInfo, 0, rm.rooms.Len())
+	rm.rooms.Iterator(func(_ string, room *Room) bool {
+		infos = append(infos, RoomInfo{
+			ID:        room.ID(),
+			Players:   room.players.Len(),
+			MaxPlayer: room.opt.MaxPlayer,
+			Private:   room.Private(),
+			Running:   room.Status(),
+		})
+		return true
+	})
+
+	return infos
+}
+
+// BroadcastAll sends the message to the players of every room, e.g. for a maintenance notice.
+// Rooms without a player manager are skipped, the errors of the other rooms are joined.
+func (rm *RoomManager) BroadcastAll(msg player.BroadcastMessage) error {
+	var errs []error
+	rm.rooms.Iterator(func(_ string, room *Room) bool {
+		if err := room.Broadcast(msg); err != nil && !errors.Is(err, ErrPlayersNotFound) {
+			errs = append(errs, fmt.Errorf("room %s: %w", room.ID(), err))
+		}
+		return true
+	})
+
+	return errors.Join(errs...)
+}
+
 // Returns a slice of all rooms managed by the RoomManager.
 func (rm *RoomManager) Rooms() []*Room {
 	rooms := make([]*Room, 0, rm.rooms.Len())
@@ -0,0 +1,46 @@
+package room
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/czx-lab/czx/container/cmap"
+)
+
+// BenchmarkRoomManagerParallel looks up rooms from parallel goroutines while 1 in 16 operations
+// creates and removes a room. The single shard case is the contention of a map guarded by one lock.
+func BenchmarkRoomManagerParallel(b *testing.B) {
+	const rooms = 10000
+
+	shards := map[string]int{
+		"single":  1,
+		"sharded": 0, // default shard count
+	}
+	for name, count := range shards {
+		b.Run(name, func(b *testing.B) {
+			rm := NewRoomManager(cmap.Option[string]{Count: count}, nil)
+			defer rm.Stop()
+
+			for i := range rooms {
+				rm.Add(NewRoom(RoomConf{RoomID: strconv.Itoa(i)}, nil, context.Background()))
+			}
+
+			var seq atomic.Uint64
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					n := seq.Add(1)
+					if n%16 != 0 {
+						rm.Get(strconv.Itoa(int(n % rooms)))
+						continue
+					}
+
+					id := "churn_" + strconv.FormatUint(n, 10)
+					rm.Add(NewRoom(RoomConf{RoomID: id}, nil, context.Background()))
+					rm.Remove(id)
+				}
+			})
+		})
+	}
+}
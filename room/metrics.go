@@ -0,0 +1,30 @@
+package room
+
+// Metrics defines the interface for room metrics tracking.
+type Metrics interface {
+	// Increment the count of active rooms
+	IncRooms()
+	// Decrement the count of active rooms
+	DecRooms()
+	// Add delta to the count of players in all rooms
+	AddPlayers(delta int)
+
+	// Shutdown the metrics tracking system
+	Close() error
+}
+
+type NoopMetrics struct{}
+
+// AddPlayers implements Metrics.
+func (n *NoopMetrics) AddPlayers(delta int) {}
+
+// Close implements Metrics.
+func (n *NoopMetrics) Close() error { return nil }
+
+// DecRooms implements Metrics.
+func (n *NoopMetrics) DecRooms() {}
+
+// IncRooms implements Metrics.
+func (n *NoopMetrics) IncRooms() {}
+
+var _ Metrics = (*NoopMetrics)(nil)
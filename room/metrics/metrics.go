@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/czx-lab/czx/frame"
+	"github.com/czx-lab/czx/metrics"
+	"github.com/czx-lab/czx/prometheus"
+	"github.com/czx-lab/czx/room"
+)
+
+type (
+	// RoomMetrics holds the metrics related to the rooms of a room manager
+	RoomMetrics struct {
+		activeRooms metrics.Gauge
+		players     metrics.Gauge
+	}
+	// LoopMetrics holds the metrics related to the game loops
+	LoopMetrics struct {
+		tickDuration metrics.Histogram
+		dropped      metrics.Counter
+	}
+	// MetricsConf defines the configuration for room and loop metrics
+	MetricsConf struct {
+		Namespace string
+		Subsystem string
+		// Buckets of the tick duration histogram in seconds, defaults to the prometheus default buckets
+		Buckets []float64
+	}
+)
+
+var (
+	_ room.Metrics  = (*RoomMetrics)(nil)
+	_ frame.Metrics = (*LoopMetrics)(nil)
+)
+
+// NewRoomMetrics creates the room metrics when prometheus is enabled,
+// and returns a no-op implementation otherwise.
+// The metrics include the number of active rooms and the number of players in all rooms.
+func NewRoomMetrics(conf MetricsConf) room.Metrics {
+	if !prometheus.Enabled() {
+		return &room.NoopMetrics{}
+	}
+	return &RoomMetrics{
+		activeRooms: metrics.NewGauge(&metrics.VectorOption{
+			Namespace: conf.Namespace,
+			Subsystem: conf.Subsystem,
+			Name:      "active_rooms",
+			Help:      "current number of active rooms",
+		}),
+		players: metrics.NewGauge(&metrics.VectorOption{
+			Namespace: conf.Namespace,
+			Subsystem: conf.Subsystem,
+			Name:      "room_players",
+			Help:      "current number of players in all rooms",
+		}),
+	}
+}
+
+// NewLoopMetrics creates the loop metrics when prometheus is enabled,
+// and returns a no-op implementation otherwise.
+// The metrics include the tick processing duration and the dropped inputs by reason.
+// A single instance can be shared by all the loops with the same configuration.
+func NewLoopMetrics(conf MetricsConf) frame.Metrics {
+	if !prometheus.Enabled() {
+		return &frame.NoopMetrics{}
+	}
+	return &LoopMetrics{
+		tickDuration: metrics.NewHistogram(&metrics.HistogramVecOpts{
+			VectorOption: metrics.VectorOption{
+				Namespace: conf.Namespace,
+				Subsystem: conf.Subsystem,
+				Name:      "tick_duration_seconds",
+				Help:      "loop tick processing duration in seconds",
+			},
+			Buckets: conf.Buckets,
+		}),
+		dropped: metrics.NewCounter(&metrics.VectorOption{
+			Namespace: conf.Namespace,
+			Subsystem: conf.Subsystem,
+			Name:      "dropped_inputs_total",
+			Help:      "total inputs dropped by reason",
+			Labels:    []string{"reason"}, // closed/full/unregistered/stale/past
+		}),
+	}
+}
+
+// AddPlayers implements room.Metrics.
+func (r *RoomMetrics) AddPlayers(delta int) {
+	r.players.Add(float64(delta))
+}
+
+// Close implements room.Metrics.
+func (r *RoomMetrics) Close() error {
+	return nil
+}
+
+// DecRooms implements room.Metrics.
+func (r *RoomMetrics) DecRooms() {
+	r.activeRooms.Dec()
+}
+
+// IncRooms implements room.Metrics.
+func (r *RoomMetrics) IncRooms() {
+	r.activeRooms.Inc()
+}
+
+// Close implements frame.Metrics.
+func (l *LoopMetrics) Close() error {
+	return nil
+}
+
+// IncDropped implements frame.Metrics.
+func (l *LoopMetrics) IncDropped(reason string) {
+	l.dropped.Inc(reason)
+}
+
+// ObserveTick implements frame.Metrics.
+func (l *LoopMetrics) ObserveTick(duration time.Duration) {
+	l.tickDuration.Observe(duration.Seconds())
+}
@@ -1,10 +1,28 @@
 package room
 
-type RoomProcessor interface {
-	// Join is called when a player joins the room
-	Join(playerID string) error
-	// Leave is called when a player leaves the room
-	Leave(playerID string) error
-	// Close is called when the room is closed
-	Close()
-}
+type (
+	RoomProcessor interface {
+		// Join is called when a player joins the room
+		Join(playerID string) error
+		// Leave is called when a player leaves the room
+		Leave(playerID string) error
+		// Close is called when the room is closed
+		Close()
+		// Snapshot returns the current state of the room for a player joining a running game.
+		// The message must be encoded for the client, it is written as is to the connection.
+		Snapshot() ([]byte, error)
+	}
+
+	// JoinGuard is implemented by the processors checking whether a player may enter the room,
+	// e.g. against a ban list or the client version. A rejected player never touches the room.
+	JoinGuard interface {
+		// CanJoin is called by Room.Join before the player is added, an error rejects the player.
+		CanJoin(playerID string) error
+	}
+
+	// LeaveHook is implemented by the processors notified once a player is out of the room.
+	LeaveHook interface {
+		// Left is called by Room.Leave after the player is removed and Leave returned.
+		Left(playerID string)
+	}
+)
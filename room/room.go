@@ -2,13 +2,19 @@ package room
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"errors"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/czx-lab/czx/container/cmap"
 	"github.com/czx-lab/czx/container/recycler"
 	"github.com/czx-lab/czx/frame"
+	"github.com/czx-lab/czx/player"
+	"github.com/czx-lab/czx/xlog"
+	"go.uber.org/zap"
 )
 
 var (
@@ -18,6 +24,14 @@ var (
 	ErrNotRunning   = errors.New("room is not running")
 	ErrRunning      = errors.New("room is already running")
 	ErrLoopNotFound = errors.New("loop not found")
+	// ErrPlayersNotFound is returned when the room has no player manager to reach the players
+	ErrPlayersNotFound = errors.New("player manager not found")
+	ErrPlayerNotFound  = errors.New("player not found")
+	ErrNoProcessor     = errors.New("room processor not found")
+	// ErrNoPriority is returned when the room loop cannot queue messages by priority
+	ErrNoPriority = errors.New("loop does not support priorities")
+	// ErrWrongPassword is returned when joining a private room without its password
+	ErrWrongPassword = errors.New("wrong room password")
 )
 
 const (
@@ -25,6 +39,8 @@ const (
 	defaultRoomID = "1"
 	// default max player count
 	defaultMaxPlayer = 5
+	// default maximum time Stop waits for the loop
+	defaultDrainTimeout = 5 * time.Second
 )
 
 type (
@@ -32,14 +48,25 @@ type (
 		// max player count
 		MaxPlayer int
 		RoomID    string // room id
+		// SnapshotOnJoin sends the processor snapshot to the players joining the room while it runs,
+		// it requires a player manager, see Room.WithPlayers.
+		SnapshotOnJoin bool
+		// Password makes the room private, the players join it with JoinWithPassword.
+		// Only its hash is kept by the room, an empty password is a public room.
+		Password string
+		// DrainOnStop stops the loop before the room processor is closed, so that the messages
+		// the loop still buffers, e.g. the last player actions, reach the game before it ends.
+		DrainOnStop bool
+		// DrainTimeout is the maximum time Stop waits for the loop to process its last messages,
+		// the loop finishes in the background past it. Zero defaults to 5 seconds.
+		DrainTimeout time.Duration
 	}
 	Room struct {
 		opt RoomConf
 		// mu is used to protect the room state and the loop
 		mu sync.RWMutex
-		// loop is used to run the room loop
-		// and send messages to Kafka
-		// and receive messages from Kafka
+		// loop runs the room logic, the room has no loop of its own:
+		// ticking and input intake are done by the frame package loops
 		loop frame.LoopFace
 		// running is used to indicate whether the room is running or not
 		running atomic.Bool
@@ -52,6 +79,12 @@ type (
 		// data is used to store the room data
 		data any
 		ctx  context.Context
+		// metrics is set by the room manager the room is added to
+		metrics Metrics
+		// manager gives access to the agents of the players in the room
+		manager *player.PlayerManager
+		// password is the hash of RoomConf.Password, nil for a public room
+		password []byte
 	}
 )
 
@@ -63,12 +96,19 @@ func NewRoom(opt RoomConf, r recycler.Recycler, ctx context.Context) *Room {
 		opt:     opt,
 		players: ps.WithRecycler(r),
 		ctx:     ctx,
+		metrics: &NoopMetrics{},
+	}
+	if len(opt.Password) > 0 {
+		sum := sha256.Sum256([]byte(opt.Password))
+		room.password = sum[:]
+		room.opt.Password = ""
 	}
 
 	return room
 }
 
-// WithLoop is used to set the room loop
+// WithLoop is used to set the room loop, a frame.FrameLoop for frame sync
+// or a frame.Normal for state sync. The previous loop, if any, is stopped.
 func (r *Room) WithLoop(loop frame.LoopFace) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -79,6 +119,17 @@ func (r *Room) WithLoop(loop frame.LoopFace) {
 	r.loop = loop
 }
 
+// withMetrics swaps the room metrics, moving the current players from the old metrics to the new ones.
+func (r *Room) withMetrics(m Metrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.players.Len()
+	r.metrics.AddPlayers(-n)
+	r.metrics = m
+	r.metrics.AddPlayers(n)
+}
+
 // Loop returns the room loop
 func (r *Room) Loop() frame.LoopFace {
 	r.mu.RLock()
@@ -96,6 +147,14 @@ func (r *Room) WithProcessor(proc RoomProcessor) {
 	r.processor = proc
 }
 
+// WithPlayers sets the player manager used to reach the agents of the players in the room.
+func (r *Room) WithPlayers(manager *player.PlayerManager) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.manager = manager
+}
+
 func (r *Room) ID() string {
 	return r.opt.RoomID
 }
@@ -136,9 +195,70 @@ func (r *Room) WriteMessage(msg frame.Message) error {
 	return loop.Write(msg)
 }
 
+// WriteMessageWithPriority sends a message to the room loop ahead of the messages of lower priority,
+// e.g. for admin commands or disconnects. The loop must implement frame.PriorityWriter,
+// like a frame.Normal created with NormalConf.Priority.
+func (r *Room) WriteMessageWithPriority(msg frame.Message, priority int) error {
+	if !r.running.Load() {
+		return ErrNotRunning
+	}
+
+	r.mu.RLock()
+	loop := r.loop
+	r.mu.RUnlock()
+
+	if loop == nil {
+		return ErrLoopNotFound
+	}
+
+	pw, ok := loop.(frame.PriorityWriter)
+	if !ok {
+		return ErrNoPriority
+	}
+	return pw.WriteWithPriority(msg, priority)
+}
+
+// Private reports whether the room is protected by a password.
+func (r *Room) Private() bool {
+	return r.password != nil
+}
+
+// JoinWithPassword adds a player to a private room like Join, once the password matches.
+// Public rooms accept any password.
+func (r *Room) JoinWithPassword(playerID, password string) error {
+	if r.Private() {
+		sum := sha256.Sum256([]byte(password))
+		if subtle.ConstantTimeCompare(sum[:], r.password) != 1 {
+			return ErrWrongPassword
+		}
+	}
+
+	return r.join(playerID)
+}
+
 // Join is used to add a player to the room
 // and to prevent multiple calls to Join()
+// A processor implementing JoinGuard is consulted first.
+// Private rooms are joined with JoinWithPassword, Join returns ErrWrongPassword for them.
 func (r *Room) Join(playerID string) error {
+	if r.Private() {
+		return ErrWrongPassword
+	}
+
+	return r.join(playerID)
+}
+
+func (r *Room) join(playerID string) error {
+	r.mu.RLock()
+	guard, _ := r.processor.(JoinGuard)
+	r.mu.RUnlock()
+
+	if guard != nil {
+		if err := guard.CanJoin(playerID); err != nil {
+			return err
+		}
+	}
+
 	r.mu.Lock()
 
 	if r.players.Has(playerID) {
@@ -151,6 +271,7 @@ func (r *Room) Join(playerID string) error {
 	}
 
 	r.players.Set(playerID, struct{}{})
+	r.metrics.AddPlayers(1)
 
 	proc := r.processor
 	r.mu.Unlock()
@@ -161,22 +282,89 @@ func (r *Room) Join(playerID string) error {
 
 	if err := proc.Join(playerID); err != nil {
 		r.mu.Lock()
-		r.players.Delete(playerID)
+		if r.players.Has(playerID) {
+			r.players.Delete(playerID)
+			r.metrics.AddPlayers(-1)
+		}
 		r.mu.Unlock()
 
 		// If the player is already in the room, remove it
 		return err
 	}
 
+	if r.opt.SnapshotOnJoin && r.running.Load() {
+		if err := r.SendSnapshot(playerID); err != nil {
+			xlog.Write().Warn("room snapshot failed", zap.String("room", r.ID()), zap.String("player", playerID), zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// SendSnapshot writes the processor snapshot to the player, so that a player joining
+// a running game receives the current state.
+func (r *Room) SendSnapshot(playerID string) error {
+	r.mu.RLock()
+	proc, manager := r.processor, r.manager
+	has := r.players.Has(playerID)
+	r.mu.RUnlock()
+
+	if proc == nil {
+		return ErrNoProcessor
+	}
+	if manager == nil {
+		return ErrPlayersNotFound
+	}
+	if !has {
+		return ErrPlayerNotFound
+	}
+	p, ok := manager.Get(playerID)
+	if !ok || p.Agent() == nil {
+		return ErrPlayerNotFound
+	}
+
+	data, err := proc.Snapshot()
+	if err != nil {
+		return err
+	}
+	return p.Agent().WriteRaw(data)
+}
+
+// Broadcast sends the message to the players in the room through the player manager,
+// see Room.WithPlayers. Players that are not registered in the manager or without a live
+// connection are skipped.
+func (r *Room) Broadcast(msg player.BroadcastMessage) error {
+	r.mu.RLock()
+	manager := r.manager
+	r.mu.RUnlock()
+
+	if manager == nil {
+		return ErrPlayersNotFound
+	}
+
+	for _, id := range r.Players() {
+		p, ok := manager.Get(id)
+		if !ok {
+			continue
+		}
+
+		manager.Send(p, msg)
+	}
+
 	return nil
 }
 
 // Leave is used to remove a player from the room
 // and to prevent multiple calls to Leave()
+// A processor implementing LeaveHook is notified once the player is out.
 func (r *Room) Leave(playerID string) error {
 	r.mu.Lock()
 
-	r.players.Delete(playerID)
+	left := r.players.Has(playerID)
+	if left {
+		r.players.Delete(playerID)
+		r.metrics.AddPlayers(-1)
+	}
 	if r.processor == nil {
 		r.mu.Unlock()
 		return nil
@@ -185,7 +373,11 @@ func (r *Room) Leave(playerID string) error {
 	proc := r.processor
 	r.mu.Unlock()
 
-	return proc.Leave(playerID)
+	err := proc.Leave(playerID)
+	if hook, ok := proc.(LeaveHook); ok && left {
+		hook.Left(playerID)
+	}
+	return err
 }
 
 // Check if the room is running
@@ -216,44 +408,80 @@ func (r *Room) Start() error {
 	return nil
 }
 
-// stop the room loop and release resources
+// stop the room loop and release resources.
+// With DrainOnStop the loop is stopped first, it processes the messages it still buffers,
+// so the last player actions reach the game before the room processor is closed.
 func (r *Room) stop() {
-	if !r.running.Load() {
+	// Only the call switching the room off stops it
+	if !r.running.CompareAndSwap(true, false) {
 		return
 	}
 
-	r.running.Store(false)
-
 	r.mu.RLock()
+	loop := r.loop
 	proc := r.processor
 	r.mu.RUnlock()
 
+	if r.opt.DrainOnStop {
+		r.stopLoop(loop)
+	}
 	if proc != nil {
 		proc.Close()
 	}
+	if !r.opt.DrainOnStop {
+		r.stopLoop(loop)
+	}
+}
+
+// stopLoop stops the loop, waiting at most DrainTimeout for it to process its last messages.
+func (r *Room) stopLoop(loop frame.LoopFace) {
+	if loop == nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		loop.Stop()
+	}()
+
+	t := time.NewTimer(r.opt.DrainTimeout)
+	defer t.Stop()
+
+	select {
+	case <-done:
+	case <-t.C:
+		xlog.Write().Warn("room loop drain timeout exceeded", zap.String("room", r.ID()), zap.Duration("timeout", r.opt.DrainTimeout))
+	}
 }
 
 // Stop the room loop and release resources
-// Stop the loop and release resources
 func (r *Room) Stop() {
-	// Check if the room is running
-	// and stop the loop if it is
-	// This is to prevent multiple calls to Stop()
-	status := r.Status()
 	r.stop()
+}
 
-	if !status {
-		return
-	}
-
-	// Stop the loop synchronously to ensure proper cleanup.
+// StopWithReason stops the room like Stop, then closes the connections of its players with the code,
+// the final message and the reason, see network.Agent.CloseWithReason. Stop keeps the connections
+// open since the players usually go back to the lobby when a game ends, StopWithReason is meant for
+// the rooms shut down by the server, e.g. for maintenance. It requires a player manager, see Room.WithPlayers.
+func (r *Room) StopWithReason(code uint16, msg any, reason string) error {
 	r.mu.RLock()
-	loop := r.loop
+	manager := r.manager
 	r.mu.RUnlock()
 
-	if loop != nil {
-		loop.Stop()
+	ids := r.Players()
+	r.stop()
+
+	if manager == nil {
+		return ErrPlayersNotFound
+	}
+	for _, id := range ids {
+		if p, ok := manager.Get(id); ok {
+			p.CloseWithReason(code, msg, reason)
+		}
 	}
+
+	return nil
 }
 
 // Number of players in the room
@@ -299,4 +527,7 @@ func defaultConf(conf *RoomConf) {
 	if len(conf.RoomID) == 0 {
 		conf.RoomID = defaultRoomID
 	}
+	if conf.DrainTimeout <= 0 {
+		conf.DrainTimeout = defaultDrainTimeout
+	}
 }
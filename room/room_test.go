@@ -0,0 +1,252 @@
+package room
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/czx-lab/czx/container/cmap"
+	"github.com/czx-lab/czx/frame"
+	"github.com/czx-lab/czx/network"
+	"github.com/czx-lab/czx/player"
+)
+
+var errBanned = errors.New("banned")
+
+// guardProc rejects the banned players and records the calls
+type guardProc struct {
+	banned string
+	calls  []string
+}
+
+func (p *guardProc) CanJoin(playerID string) error {
+	if playerID == p.banned {
+		return errBanned
+	}
+	return nil
+}
+
+func (p *guardProc) Join(playerID string) error {
+	p.calls = append(p.calls, "join:"+playerID)
+	return nil
+}
+
+func (p *guardProc) Leave(playerID string) error {
+	p.calls = append(p.calls, "leave:"+playerID)
+	return nil
+}
+
+func (p *guardProc) Left(playerID string) { p.calls = append(p.calls, "left:"+playerID) }
+
+func (p *guardProc) Close()                    {}
+func (p *guardProc) Snapshot() ([]byte, error) { return nil, nil }
+
+func TestRoomJoinGuard(t *testing.T) {
+	proc := &guardProc{banned: "cheater"}
+	r := NewRoom(RoomConf{RoomID: "1", MaxPlayer: 2}, nil, context.Background())
+	r.WithProcessor(proc)
+
+	if err := r.Join("cheater"); err != errBanned {
+		t.Fatalf("got %v, want errBanned", err)
+	}
+	if r.players.Has("cheater") {
+		t.Fatal("a rejected player must not enter the room")
+	}
+
+	if err := r.Join("player_1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Leave("player_1"); err != nil {
+		t.Fatal(err)
+	}
+	// Not in the room anymore, the hook is not called again
+	r.Leave("player_1")
+
+	want := []string{"join:player_1", "leave:player_1", "left:player_1", "leave:player_1"}
+	if !slices.Equal(proc.calls, want) {
+		t.Fatalf("got %v, want %v", proc.calls, want)
+	}
+}
+
+func TestRoomPassword(t *testing.T) {
+	rm := NewRoomManager(cmap.Option[string]{}, nil)
+	defer rm.Stop()
+
+	private := NewRoom(RoomConf{RoomID: "private", Password: "secret"}, nil, context.Background())
+	public := NewRoom(RoomConf{RoomID: "public"}, nil, context.Background())
+	rm.Add(private)
+	rm.Add(public)
+
+	if err := private.Join("player_1"); err != ErrWrongPassword {
+		t.Fatalf("got %v, want ErrWrongPassword", err)
+	}
+	if err := private.JoinWithPassword("player_1", "guess"); err != ErrWrongPassword {
+		t.Fatalf("got %v, want ErrWrongPassword", err)
+	}
+	if err := private.JoinWithPassword("player_1", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := public.Join("player_1"); err != nil {
+		t.Fatal(err)
+	}
+	if private.opt.Password != "" {
+		t.Fatal("the plain password must not be kept")
+	}
+
+	listing := rm.Listing()
+	slices.SortFunc(listing, func(a, b RoomInfo) int { return strings.Compare(a.ID, b.ID) })
+	want := []RoomInfo{
+		{ID: "private", Players: 1, MaxPlayer: defaultMaxPlayer, Private: true},
+		{ID: "public", Players: 1, MaxPlayer: defaultMaxPlayer},
+	}
+	if !slices.Equal(listing, want) {
+		t.Fatalf("got %+v, want %+v", listing, want)
+	}
+}
+
+// stopProc records the processed messages and the closing of the room
+type stopProc struct {
+	guardProc
+	events *[]string
+}
+
+func (p *stopProc) Close()                    { *p.events = append(*p.events, "close") }
+func (p *stopProc) OnClose()                  {}
+func (p *stopProc) Process(msg frame.Message) { *p.events = append(*p.events, string(msg.Data)) }
+
+func TestRoomStopDrains(t *testing.T) {
+	var events []string
+	proc := &stopProc{events: &events}
+	r := NewRoom(RoomConf{RoomID: "1", DrainOnStop: true}, nil, context.Background())
+	r.WithProcessor(proc)
+	r.WithLoop(frame.NewNormal(frame.NormalConf{}).WithProc(proc))
+	// The loop is not ticking, the messages stay buffered until Stop
+	r.running.Store(true)
+
+	for _, data := range []string{"move", "result"} {
+		if err := r.WriteMessage(frame.Message{Data: []byte(data)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.Stop()
+	r.Stop()
+
+	want := []string{"move", "result", "close"}
+	if !slices.Equal(events, want) {
+		t.Fatalf("got %v, want %v", events, want)
+	}
+}
+
+// slowProc takes a while to process every message
+type slowProc struct {
+	stopProc
+	delay time.Duration
+}
+
+func (p *slowProc) Process(msg frame.Message) { time.Sleep(p.delay) }
+
+func TestRoomStopDrainTimeout(t *testing.T) {
+	var events []string
+	proc := &slowProc{stopProc: stopProc{events: &events}, delay: time.Second}
+	r := NewRoom(RoomConf{RoomID: "1", DrainOnStop: true, DrainTimeout: 50 * time.Millisecond}, nil, context.Background())
+	r.WithProcessor(proc)
+	r.WithLoop(frame.NewNormal(frame.NormalConf{}).WithProc(proc))
+	r.running.Store(true)
+	r.WriteMessage(frame.Message{Data: []byte("move")})
+
+	start := time.Now()
+	r.Stop()
+	if took := time.Since(start); took > 500*time.Millisecond {
+		t.Fatalf("Stop took %v, want it bounded by the drain timeout", took)
+	}
+	if !slices.Equal(events, []string{"close"}) {
+		t.Fatalf("got %v, want the processor closed", events)
+	}
+}
+
+// countAgent counts the messages written to the player and records the close reason
+type countAgent struct {
+	network.Agent
+	writes int
+	reason string
+}
+
+func (a *countAgent) CloseWithReason(code uint16, msg any, reason string) { a.reason = reason }
+
+func (a *countAgent) IsAlive() bool { return true }
+func (a *countAgent) WriteWithCode(code uint, msg any) error {
+	a.writes++
+	return nil
+}
+
+func TestRoomManagerBroadcastAll(t *testing.T) {
+	rm := NewRoomManager(cmap.Option[string]{}, nil)
+	defer rm.Stop()
+
+	players := player.NewPlayerManager(&player.ManagerConf{}, nil)
+	agents := make(map[string]*countAgent)
+	for _, id := range []string{"player_1", "player_2", "lobby"} {
+		agents[id] = &countAgent{}
+		p := player.NewPlayer(agents[id])
+		p.WithID(id)
+		players.Add(p)
+	}
+
+	first := NewRoom(RoomConf{RoomID: "first"}, nil, context.Background())
+	second := NewRoom(RoomConf{RoomID: "second"}, nil, context.Background())
+	// A room without player manager is skipped
+	empty := NewRoom(RoomConf{RoomID: "empty"}, nil, context.Background())
+	first.WithPlayers(players)
+	second.WithPlayers(players)
+	for _, r := range []*Room{first, second, empty} {
+		r.WithProcessor(&guardProc{})
+		rm.Add(r)
+	}
+	first.Join("player_1")
+	// Not registered in the player manager, e.g. while reconnecting
+	first.Join("ghost")
+	second.Join("player_2")
+	empty.Join("lobby")
+
+	if err := rm.BroadcastAll(player.BroadcastMessage{Code: 1, Data: "maintenance"}); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]int{"player_1": 1, "player_2": 1, "lobby": 0} {
+		if agents[id].writes != want {
+			t.Fatalf("%s writes = %d, want %d", id, agents[id].writes, want)
+		}
+	}
+
+	if err := empty.Broadcast(player.BroadcastMessage{Code: 1}); err != ErrPlayersNotFound {
+		t.Fatalf("got %v, want ErrPlayersNotFound", err)
+	}
+}
+
+func TestRoomStopWithReason(t *testing.T) {
+	players := player.NewPlayerManager(&player.ManagerConf{}, nil)
+	inRoom, lobby := &countAgent{}, &countAgent{}
+	for id, agent := range map[string]*countAgent{"player_1": inRoom, "lobby": lobby} {
+		p := player.NewPlayer(agent)
+		p.WithID(id)
+		players.Add(p)
+	}
+
+	r := NewRoom(RoomConf{RoomID: "1"}, nil, context.Background())
+	r.WithProcessor(&guardProc{})
+	r.WithPlayers(players)
+	r.Join("player_1")
+	r.running.Store(true)
+
+	if err := r.StopWithReason(4000, nil, "maintenance"); err != nil {
+		t.Fatal(err)
+	}
+	if r.Status() {
+		t.Fatal("the room must be stopped")
+	}
+	if inRoom.reason != "maintenance" || lobby.reason != "" {
+		t.Fatalf("got %q and %q, want only the room player closed", inRoom.reason, lobby.reason)
+	}
+}
@@ -59,7 +59,22 @@ type CronExpr struct {
 // The fields are represented as bit masks, where each bit represents a value in the range of the field.
 // The function uses bitwise operations to parse the cron expression and set the appropriate bits in the fields.
 // The function also checks for valid ranges and increments for each field and returns an error if any of the fields are invalid.
-func NewCronExpr(expr string) (cronExpr *CronExpr, err error) {
+func NewCronExpr(expr string) (*CronExpr, error) {
+	cronExpr := new(CronExpr)
+	if err := cronExpr.parse(expr); err != nil {
+		return nil, err
+	}
+	return cronExpr, nil
+}
+
+// ValidateCron checks a cron expression like NewCronExpr, e.g. before saving it from a config UI.
+func ValidateCron(expr string) error {
+	var e CronExpr
+	return e.parse(expr)
+}
+
+// parse sets the fields of the expression, see NewCronExpr.
+func (e *CronExpr) parse(expr string) (err error) {
 	fields := strings.Fields(expr)
 	if len(fields) != 5 && len(fields) != 6 {
 		err = fmt.Errorf("invalid expr %v: expected 5 or 6 fields, got %v", expr, len(fields))
@@ -70,34 +85,33 @@ func NewCronExpr(expr string) (cronExpr *CronExpr, err error) {
 		fields = append([]string{"0"}, fields...)
 	}
 
-	cronExpr = new(CronExpr)
 	// Seconds
-	cronExpr.sec, err = parseCronField(fields[0], 0, 59)
+	e.sec, err = parseCronField(fields[0], 0, 59)
 	if err != nil {
 		goto onError
 	}
 	// Minutes
-	cronExpr.min, err = parseCronField(fields[1], 0, 59)
+	e.min, err = parseCronField(fields[1], 0, 59)
 	if err != nil {
 		goto onError
 	}
 	// Hours
-	cronExpr.hour, err = parseCronField(fields[2], 0, 23)
+	e.hour, err = parseCronField(fields[2], 0, 23)
 	if err != nil {
 		goto onError
 	}
 	// Day of month
-	cronExpr.dom, err = parseCronField(fields[3], 1, 31)
+	e.dom, err = parseCronField(fields[3], 1, 31)
 	if err != nil {
 		goto onError
 	}
 	// Month
-	cronExpr.month, err = parseCronField(fields[4], 1, 12)
+	e.month, err = parseCronField(fields[4], 1, 12)
 	if err != nil {
 		goto onError
 	}
 	// Day of week
-	cronExpr.dow, err = parseCronField(fields[5], 0, 6)
+	e.dow, err = parseCronField(fields[5], 0, 6)
 	if err != nil {
 		goto onError
 	}
@@ -299,3 +313,180 @@ retry:
 
 	return t
 }
+
+// NextN returns the next n times that match the cron expression after the given time t.
+// It returns fewer times if the expression stops matching, see Next.
+func (e *CronExpr) NextN(t time.Time, n int) []time.Time {
+	times := make([]time.Time, 0, max(n, 0))
+	for range n {
+		t = e.Next(t)
+		if t.IsZero() {
+			break
+		}
+		times = append(times, t)
+	}
+	return times
+}
+
+var (
+	weekdayNames = [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+	monthNames   = [13]string{"", "January", "February", "March", "April", "May", "June",
+		"July", "August", "September", "October", "November", "December"}
+)
+
+// Describe returns a human readable description of the expression for display,
+// e.g. "every 5 minutes on weekdays" for "*/5 * * * 1-5".
+func (e *CronExpr) Describe() string {
+	desc := e.describeTime()
+	days := e.describeDays()
+
+	// "at 12:00" alone does not say it happens every day
+	if strings.HasPrefix(desc, "at ") && e.dom == 0xfffffffe && e.dow == 0x7f {
+		desc = "every day " + desc
+	}
+	if days == "" {
+		return desc
+	}
+	return desc + " " + days
+}
+
+// describeTime describes the seconds, minutes and hours of the expression.
+func (e *CronExpr) describeTime() string {
+	sec := fieldValues(e.sec, 0, 59)
+	min := fieldValues(e.min, 0, 59)
+	hour := fieldValues(e.hour, 0, 23)
+
+	allMin, allHour := len(min) == 60, len(hour) == 24
+	atSec := ""
+	if len(sec) == 1 && sec[0] != 0 {
+		atSec = fmt.Sprintf(" at second %d", sec[0])
+	}
+
+	switch {
+	case allHour && allMin && len(sec) == 60:
+		return "every second"
+	case allHour && allMin && fieldStep(sec, 0, 59) > 1:
+		return fmt.Sprintf("every %d seconds", fieldStep(sec, 0, 59))
+	case allHour && allMin && len(sec) == 1:
+		return "every minute" + atSec
+	case allHour && fieldStep(min, 0, 59) > 1 && len(sec) == 1:
+		return fmt.Sprintf("every %d minutes", fieldStep(min, 0, 59)) + atSec
+	case allHour && len(min) == 1 && len(sec) == 1:
+		return fmt.Sprintf("every hour at minute %d", min[0]) + atSec
+	case fieldStep(hour, 0, 23) > 1 && len(min) == 1 && len(sec) == 1:
+		desc := fmt.Sprintf("every %d hours", fieldStep(hour, 0, 23))
+		if min[0] != 0 {
+			desc += fmt.Sprintf(" at minute %d", min[0])
+		}
+		return desc + atSec
+	case len(hour) == 1 && len(min) == 1 && len(sec) == 1:
+		if sec[0] != 0 {
+			return fmt.Sprintf("at %02d:%02d:%02d", hour[0], min[0], sec[0])
+		}
+		return fmt.Sprintf("at %02d:%02d", hour[0], min[0])
+	}
+
+	// Any other combination lists the values of the restricted fields, the second 0 is implied
+	var parts []string
+	for _, f := range []struct {
+		name string
+		vals []int
+		all  bool
+	}{
+		{"second", sec, len(sec) == 60 || atSec == "" && len(sec) == 1},
+		{"minute", min, allMin},
+		{"hour", hour, allHour},
+	} {
+		if !f.all {
+			parts = append(parts, f.name+" "+joinValues(f.vals, strconv.Itoa, "-"))
+		}
+	}
+	return "at " + strings.Join(parts, ", ")
+}
+
+// describeDays describes the days and months of the expression, it is empty for every day.
+func (e *CronExpr) describeDays() string {
+	dom := fieldValues(e.dom, 1, 31)
+	dow := fieldValues(e.dow, 0, 6)
+	month := fieldValues(e.month, 1, 12)
+
+	var parts []string
+	if len(dom) < 31 {
+		name := "day"
+		if len(dom) > 1 {
+			name = "days"
+		}
+		parts = append(parts, fmt.Sprintf("on %s %s of the month", name, joinValues(dom, strconv.Itoa, "-")))
+	}
+	if len(dow) < 7 {
+		switch e.dow {
+		case 0x3e:
+			parts = append(parts, "on weekdays")
+		case 0x41:
+			parts = append(parts, "on weekends")
+		default:
+			parts = append(parts, "on "+joinValues(dow, func(v int) string { return weekdayNames[v] }, " to "))
+		}
+	}
+
+	// The day of month and the day of week match either, see matchDay
+	desc := strings.Join(parts, " or ")
+	if len(month) < 12 {
+		in := "in " + joinValues(month, func(v int) string { return monthNames[v] }, " to ")
+		if desc == "" {
+			return in
+		}
+		desc += " " + in
+	}
+	return desc
+}
+
+// fieldValues returns the values set in the field mask between min and max.
+func fieldValues(mask uint64, min, max int) []int {
+	var vals []int
+	for v := min; v <= max; v++ {
+		if mask&(1<<uint(v)) != 0 {
+			vals = append(vals, v)
+		}
+	}
+	return vals
+}
+
+// fieldStep returns n if the values are min, min+n, min+2n... up to max like with */n, zero otherwise.
+func fieldStep(vals []int, min, max int) int {
+	if len(vals) < 2 || vals[0] != min {
+		return 0
+	}
+
+	n := vals[1] - vals[0]
+	for i := 2; i < len(vals); i++ {
+		if vals[i]-vals[i-1] != n {
+			return 0
+		}
+	}
+	// The values must reach the end of the range
+	if vals[len(vals)-1]+n <= max {
+		return 0
+	}
+	return n
+}
+
+// joinValues formats the values as a list, runs of 3 or more consecutive values are written as ranges.
+func joinValues(vals []int, name func(int) string, to string) string {
+	var parts []string
+	for i := 0; i < len(vals); {
+		j := i
+		for j+1 < len(vals) && vals[j+1] == vals[j]+1 {
+			j++
+		}
+
+		if j-i >= 2 {
+			parts = append(parts, name(vals[i])+to+name(vals[j]))
+			i = j + 1
+			continue
+		}
+		parts = append(parts, name(vals[i]))
+		i++
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,142 @@
+package timer
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+type (
+	// heapEntry is a timer scheduled on a heapScheduler.
+	heapEntry struct {
+		at    time.Time
+		fire  func()
+		index int // index in the heap, -1 once fired or cancelled
+	}
+	entries []*heapEntry
+
+	// heapScheduler multiplexes all the timers of a dispatcher onto a single goroutine and
+	// a single runtime timer, ordered by a min-heap on their deadline.
+	heapScheduler struct {
+		mu      sync.Mutex
+		entries entries
+		wake    chan struct{}
+		done    chan struct{}
+		once    sync.Once
+		wg      sync.WaitGroup
+	}
+)
+
+func newHeapScheduler() *heapScheduler {
+	s := &heapScheduler{
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s
+}
+
+// schedule calls fire from the scheduler goroutine once d has elapsed.
+func (s *heapScheduler) schedule(d time.Duration, fire func()) *heapEntry {
+	e := &heapEntry{at: time.Now().Add(d), fire: fire}
+
+	s.mu.Lock()
+	heap.Push(&s.entries, e)
+	first := e.index == 0
+	s.mu.Unlock()
+
+	// The scheduler only needs to recompute its deadline if the new timer is the earliest
+	if first {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return e
+}
+
+// cancel removes the entry, it reports false if it already fired.
+func (s *heapScheduler) cancel(e *heapEntry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e.index < 0 {
+		return false
+	}
+	heap.Remove(&s.entries, e.index)
+	return true
+}
+
+func (s *heapScheduler) run() {
+	defer s.wg.Done()
+
+	t := time.NewTimer(time.Hour)
+	defer t.Stop()
+
+	for {
+		s.mu.Lock()
+		var due []*heapEntry
+		now := time.Now()
+		for len(s.entries) > 0 && !s.entries[0].at.After(now) {
+			due = append(due, heap.Pop(&s.entries).(*heapEntry))
+		}
+		wait := time.Hour
+		if len(s.entries) > 0 {
+			wait = s.entries[0].at.Sub(now)
+		}
+		s.mu.Unlock()
+
+		for _, e := range due {
+			e.fire()
+		}
+		if len(due) > 0 {
+			// Firing may have taken a while, look for newly due timers first
+			continue
+		}
+
+		t.Reset(wait)
+		select {
+		case <-t.C:
+		case <-s.wake:
+			t.Stop()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// stop stops the scheduler goroutine, the pending timers never fire.
+func (s *heapScheduler) stop() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	s.wg.Wait()
+}
+
+// heap.Interface
+func (h entries) Len() int           { return len(h) }
+func (h entries) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h entries) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *entries) Push(x any) {
+	e := x.(*heapEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *entries) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*h = old[:n-1]
+	return e
+}
@@ -3,14 +3,26 @@ package timer
 import (
 	"sync"
 	"time"
+
+	"github.com/czx-lab/czx/xlog"
+	"go.uber.org/zap"
 )
 
+// atCheckInterval is the longest wait of AtFunc before checking the wall clock again
+const atCheckInterval = time.Minute
+
 type (
 	// Timer is a struct that holds a time.Timer and a callback function.
 	// The Timer struct is used to manage timers in the dispatcher.
 	Timer struct {
-		t  *time.Timer
-		cb func()
+		// mu protects the scheduling state, AtFunc re-arms the timer from the firing goroutine
+		mu      sync.Mutex
+		t       *time.Timer
+		cb      func()
+		stopped bool
+		// entry is set instead of t when the dispatcher uses the heap scheduler
+		entry *heapEntry
+		heap  *heapScheduler
 	}
 
 	// Dispatcher is a struct that holds a channel for timers.
@@ -21,6 +33,8 @@ type (
 		wg        sync.WaitGroup
 		done      chan struct{}
 		once      sync.Once
+		// heap is the shared scheduler, nil when every timer has its own runtime timer
+		heap *heapScheduler
 	}
 
 	// Cron is a struct that holds a channel for timers and a callback function.
@@ -42,12 +56,26 @@ func NewDispatcher(l int) *Dispatcher {
 	return disp
 }
 
+// WithHeap schedules all the timers of the dispatcher on a single goroutine ordered by a min-heap,
+// instead of one runtime timer per AfterFunc. It pays off with thousands of concurrent timers.
+// Timers still pending when the dispatcher stops never fire. It must be called before scheduling timers.
+func (disp *Dispatcher) WithHeap() *Dispatcher {
+	disp.heap = newHeapScheduler()
+	return disp
+}
+
 // The Stop method is used to stop the timer and execute the callback function.
 // It is called when the timer is no longer needed.
 func (t *Timer) Stop() {
+	t.mu.Lock()
+	t.stopped = true
 	if t.t != nil {
 		t.t.Stop()
 	}
+	if t.entry != nil {
+		t.heap.cancel(t.entry)
+	}
+	t.mu.Unlock()
 
 	t.cb = nil
 }
@@ -65,18 +93,66 @@ func (t *Timer) exec() {
 func (disp *Dispatcher) AfterFunc(d time.Duration, cb func()) *Timer {
 	t := new(Timer)
 	t.cb = cb
-	t.t = time.AfterFunc(d, func() {
-		select {
-		case disp.chanTimer <- t:
-		case <-disp.done:
-			t.exec()
+	disp.arm(t, d, func() {
+		disp.dispatch(t)
+	})
+
+	return t
+}
+
+// AtFunc creates a new Timer that will execute the callback function at the wall clock time at.
+// The wall clock is checked again before firing, at least every minute, so the timer follows
+// clock adjustments. If at is in the past, the callback is not executed and a stopped Timer is returned.
+func (disp *Dispatcher) AtFunc(at time.Time, cb func()) *Timer {
+	// Strip the monotonic reading so that durations are computed on the wall clock
+	at = at.Round(0)
+
+	t := new(Timer)
+	if time.Until(at) <= 0 {
+		xlog.Write().Warn("timer scheduled in the past", zap.Time("at", at))
+		t.stopped = true
+		return t
+	}
+
+	t.cb = cb
+	var check func()
+	check = func() {
+		if d := time.Until(at); d > 0 {
+			disp.arm(t, min(d, atCheckInterval), check)
 			return
 		}
-	})
+		disp.dispatch(t)
+	}
+	check()
 
 	return t
 }
 
+// arm schedules fire after d, on the heap scheduler if the dispatcher uses one.
+func (disp *Dispatcher) arm(t *Timer, d time.Duration, fire func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stopped {
+		return
+	}
+	if disp.heap != nil {
+		t.heap = disp.heap
+		t.entry = disp.heap.schedule(d, fire)
+		return
+	}
+	t.t = time.AfterFunc(d, fire)
+}
+
+// dispatch hands the expired timer over to the dispatcher goroutine.
+func (disp *Dispatcher) dispatch(t *Timer) {
+	select {
+	case disp.chanTimer <- t:
+	case <-disp.done:
+		t.exec()
+	}
+}
+
 // Start the dispatcher and listen for timers
 // The Start method is used to start the dispatcher and listen for timers.
 // It is called when the dispatcher is started and runs in a separate goroutine.
@@ -110,6 +186,10 @@ func (disp *Dispatcher) Stop() {
 		close(disp.done)
 		disp.wg.Wait()
 
+		if disp.heap != nil {
+			disp.heap.stop()
+		}
+
 		close(disp.chanTimer)
 	})
 }
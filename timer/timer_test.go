@@ -0,0 +1,151 @@
+package timer
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHeapDispatcher(t *testing.T) {
+	disp := NewDispatcher(10).WithHeap()
+	go disp.Start()
+	defer disp.Stop()
+
+	var mu sync.Mutex
+	var fired []int
+	var wg sync.WaitGroup
+	for _, i := range []int{3, 1, 2} {
+		wg.Add(1)
+		disp.AfterFunc(time.Duration(i)*10*time.Millisecond, func() {
+			mu.Lock()
+			fired = append(fired, i)
+			mu.Unlock()
+			wg.Done()
+		})
+	}
+	cancelled := disp.AfterFunc(15*time.Millisecond, func() {
+		t.Error("stopped timer fired")
+	})
+	cancelled.Stop()
+
+	wg.Wait()
+	time.Sleep(10 * time.Millisecond)
+	if !slices.Equal(fired, []int{1, 2, 3}) {
+		t.Fatalf("fired %v, want [1 2 3]", fired)
+	}
+}
+
+func TestAtFunc(t *testing.T) {
+	disp := NewDispatcher(10)
+	go disp.Start()
+	defer disp.Stop()
+
+	fired := make(chan time.Time, 1)
+	at := time.Now().Add(20 * time.Millisecond)
+	disp.AtFunc(at, func() {
+		fired <- time.Now()
+	})
+
+	select {
+	case got := <-fired:
+		if got.Before(at) {
+			t.Fatalf("fired at %v, before %v", got, at)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timer did not fire")
+	}
+
+	past := disp.AtFunc(time.Now().Add(-time.Second), func() {
+		t.Error("timer in the past fired")
+	})
+	past.Stop()
+	time.Sleep(10 * time.Millisecond)
+}
+
+// go test -run none -bench BenchmarkDispatcher -benchmem ./timer
+func BenchmarkDispatcher(b *testing.B) {
+	const count = 10000
+
+	for _, name := range []string{"Runtime", "Heap"} {
+		b.Run(name, func(b *testing.B) {
+			disp := NewDispatcher(count)
+			if name == "Heap" {
+				disp.WithHeap()
+			}
+			go disp.Start()
+			defer disp.Stop()
+
+			b.ReportAllocs()
+			for range b.N {
+				var wg sync.WaitGroup
+				wg.Add(count)
+				for i := range count {
+					disp.AfterFunc(time.Duration(i%10)*time.Millisecond, wg.Done)
+				}
+				wg.Wait()
+			}
+		})
+	}
+}
+
+func TestCronDescribe(t *testing.T) {
+	tests := map[string]string{
+		"* * * * * *":        "every second",
+		"*/5 * * * * *":      "every 5 seconds",
+		"* * * * *":          "every minute",
+		"*/5 * * * 1-5":      "every 5 minutes on weekdays",
+		"30 15 * * * *":      "every hour at minute 15 at second 30",
+		"0 */2 * * *":        "every 2 hours",
+		"0 0 12 * * *":       "every day at 12:00",
+		"0 15 10 * * 1-5":    "at 10:15 on weekdays",
+		"0 0 * * 0,6":        "at 00:00 on weekends",
+		"0 9 1 * *":          "at 09:00 on day 1 of the month",
+		"0 20 * 1,3 5":       "at 20:00 on Friday in January, March",
+		"0 0-30 9,17 * * *":  "every day at minute 0-30, hour 9, 17",
+		"0 0 8 1-15 * 1,3,5": "at 08:00 on days 1-15 of the month or on Monday, Wednesday, Friday",
+		"0 0 0 * 6-8 *":      "every day at 00:00 in June to August",
+		"10 0 0 * * 2-4":     "at 00:00:10 on Tuesday to Thursday",
+		"0 0 12 * * 1-2":     "at 12:00 on Monday, Tuesday",
+	}
+	for expr, want := range tests {
+		if err := ValidateCron(expr); err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		e, _ := NewCronExpr(expr)
+		if got := e.Describe(); got != want {
+			t.Errorf("%s: got %q, want %q", expr, got, want)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * * *", "*/0 * * * *", "5-1 * * * *"} {
+		if ValidateCron(expr) == nil {
+			t.Errorf("%q: invalid expression accepted", expr)
+		}
+	}
+}
+
+func TestCronNextN(t *testing.T) {
+	e, err := NewCronExpr("0 30 9 * * 1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Friday
+	start := time.Date(2025, time.January, 3, 10, 0, 0, 0, time.UTC)
+	got := e.NextN(start, 3)
+	want := []time.Time{
+		time.Date(2025, time.January, 6, 9, 30, 0, 0, time.UTC),
+		time.Date(2025, time.January, 7, 9, 30, 0, 0, time.UTC),
+		time.Date(2025, time.January, 8, 9, 30, 0, 0, time.UTC),
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// February 30th never happens
+	never, _ := NewCronExpr("0 0 0 30 2 *")
+	if got := never.NextN(start, 5); len(got) != 0 {
+		t.Fatalf("got %v, want none", got)
+	}
+}
@@ -3,11 +3,16 @@ package xnats
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/nats-io/nats.go"
 )
 
+// ErrRequestTimeout is returned when a request gets no reply within its timeout.
+var ErrRequestTimeout = errors.New("nats request timeout")
+
 type JetStream struct {
+	nc *nats.Conn
 	js nats.JetStreamContext
 }
 
@@ -17,7 +22,7 @@ func NewJetStream(nc *nats.Conn, opts ...nats.JSOpt) (*JetStream, error) {
 		return nil, err
 	}
 
-	return &JetStream{js: js}, nil
+	return &JetStream{nc: nc, js: js}, nil
 }
 
 // GetJetStreamContext returns the underlying JetStream context.
@@ -103,3 +108,25 @@ func (js *JetStream) Subscribe(subject string, handler nats.MsgHandler, opts ...
 func (js *JetStream) QueueSubscribe(subject, queue string, handler nats.MsgHandler, opts ...nats.SubOpt) (*nats.Subscription, error) {
 	return js.js.QueueSubscribe(subject, queue, handler, opts...)
 }
+
+// Request sends a request to the specified subject and waits for the reply until the timeout expires.
+// It returns ErrRequestTimeout if no reply is received in time.
+func (js *JetStream) Request(subject string, data []byte, timeout time.Duration) (*nats.Msg, error) {
+	msg, err := js.nc.Request(subject, data, timeout)
+	if errors.Is(err, nats.ErrTimeout) {
+		return nil, ErrRequestTimeout
+	}
+
+	return msg, err
+}
+
+// Responder subscribes to the specified subject and replies to every request with the handler result.
+// Messages without a reply subject are ignored.
+func (js *JetStream) Responder(subject string, handler func([]byte) []byte) (*nats.Subscription, error) {
+	return js.nc.Subscribe(subject, func(msg *nats.Msg) {
+		if msg.Reply == "" {
+			return
+		}
+		msg.Respond(handler(msg.Data))
+	})
+}
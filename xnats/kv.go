@@ -0,0 +1,179 @@
+package xnats
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+type (
+	// Entry is a key-value entry delivered by a KV watcher.
+	Entry struct {
+		Key       string
+		Value     []byte
+		Revision  uint64
+		Created   time.Time
+		Operation nats.KeyValueOp
+	}
+	// KV wraps a JetStream key-value bucket.
+	KV struct {
+		mu       sync.Mutex
+		kv       nats.KeyValue
+		watchers map[*watch]struct{}
+	}
+	// watch is a watcher forwarding its updates, done releases the forwarding goroutine
+	// even if the consumer stopped reading.
+	watch struct {
+		w    nats.KeyWatcher
+		done chan struct{}
+		once sync.Once
+	}
+)
+
+// Bucket binds to an existing key-value bucket.
+func (js *JetStream) Bucket(name string) (*KV, error) {
+	kv, err := js.js.KeyValue(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KV{kv: kv}, nil
+}
+
+// CreateBucket creates a key-value bucket with the given configuration, use History and TTL to
+// control how many revisions are kept per key and how long they live.
+// If the bucket already exists, it binds to it without error.
+func (js *JetStream) CreateBucket(conf *nats.KeyValueConfig) (*KV, error) {
+	kv, err := js.js.KeyValue(conf.Bucket)
+	if err == nil {
+		return &KV{kv: kv}, nil // Bucket already exists
+	}
+	if !errors.Is(err, nats.ErrBucketNotFound) {
+		return nil, err // Some other error occurred
+	}
+
+	kv, err = js.js.CreateKeyValue(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KV{kv: kv}, nil
+}
+
+// GetKeyValue returns the underlying key-value store.
+func (kv *KV) GetKeyValue() nats.KeyValue {
+	return kv.kv
+}
+
+// Get returns the latest value for the key.
+func (kv *KV) Get(key string) ([]byte, error) {
+	entry, err := kv.kv.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.Value(), nil
+}
+
+// Put stores the value for the key and returns its revision.
+func (kv *KV) Put(key string, value []byte) (uint64, error) {
+	return kv.kv.Put(key, value)
+}
+
+// Delete deletes the key, previous revisions are kept according to the bucket history.
+func (kv *KV) Delete(key string, opts ...nats.DeleteOpt) error {
+	return kv.kv.Delete(key, opts...)
+}
+
+// Watch watches the key for updates, wildcards are supported.
+// The current values are delivered first, followed by the updates.
+// The returned channel is closed when the watch is stopped with the returned function or the KV is closed.
+func (kv *KV) Watch(key string, opts ...nats.WatchOpt) (<-chan Entry, func() error, error) {
+	w, err := kv.kv.Watch(key, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wt := &watch{w: w, done: make(chan struct{})}
+	kv.mu.Lock()
+	if kv.watchers == nil {
+		kv.watchers = make(map[*watch]struct{})
+	}
+	kv.watchers[wt] = struct{}{}
+	kv.mu.Unlock()
+
+	ch := make(chan Entry)
+	go func() {
+		defer close(ch)
+		// The watcher may also end on its own, e.g. when the connection is closed
+		defer kv.forget(wt)
+
+		for {
+			select {
+			case <-wt.done:
+				return
+			case entry, ok := <-w.Updates():
+				if !ok {
+					return
+				}
+				// A nil entry marks the end of the initial values
+				if entry == nil {
+					continue
+				}
+
+				select {
+				case ch <- Entry{
+					Key:       entry.Key(),
+					Value:     entry.Value(),
+					Revision:  entry.Revision(),
+					Created:   entry.Created(),
+					Operation: entry.Operation(),
+				}:
+				case <-wt.done:
+					return
+				}
+			}
+		}
+	}()
+
+	stop := func() error {
+		kv.forget(wt)
+		return wt.stop()
+	}
+	return ch, stop, nil
+}
+
+// forget removes the watch from the watchers of the KV.
+func (kv *KV) forget(wt *watch) {
+	kv.mu.Lock()
+	delete(kv.watchers, wt)
+	kv.mu.Unlock()
+}
+
+// stop stops the watcher and releases the forwarding goroutine, only the first call has effect.
+func (wt *watch) stop() error {
+	var err error
+	wt.once.Do(func() {
+		close(wt.done)
+		err = wt.w.Stop()
+	})
+	return err
+}
+
+// Close stops all the watchers of the KV.
+func (kv *KV) Close() error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	var errs []error
+	for wt := range kv.watchers {
+		if err := wt.stop(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	clear(kv.watchers)
+
+	return errors.Join(errs...)
+}
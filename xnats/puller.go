@@ -0,0 +1,77 @@
+package xnats
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Puller wraps a durable JetStream pull subscription.
+// Messages are only delivered when requested with Fetch, which lets workers apply backpressure.
+type Puller struct {
+	sub *nats.Subscription
+}
+
+// PullSubscribe creates a durable pull subscription on the specified subject.
+func (js *JetStream) PullSubscribe(subject, durable string, opts ...nats.SubOpt) (*Puller, error) {
+	sub, err := js.js.PullSubscribe(subject, durable, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Puller{sub: sub}, nil
+}
+
+// GetSubscription returns the underlying subscription.
+func (p *Puller) GetSubscription() *nats.Subscription {
+	return p.sub
+}
+
+// Fetch pulls up to batch messages, waiting at most maxWait.
+// It returns an empty slice without error if no message is available in time.
+func (p *Puller) Fetch(batch int, maxWait time.Duration) ([]*nats.Msg, error) {
+	msgs, err := p.sub.Fetch(batch, nats.MaxWait(maxWait))
+	if errors.Is(err, nats.ErrTimeout) {
+		return msgs, nil
+	}
+
+	return msgs, err
+}
+
+// Ack acknowledges all the messages, it returns the first error encountered.
+func (p *Puller) Ack(msgs ...*nats.Msg) error {
+	for _, msg := range msgs {
+		if err := msg.Ack(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Nak negatively acknowledges all the messages so they are redelivered,
+// it returns the first error encountered.
+func (p *Puller) Nak(msgs ...*nats.Msg) error {
+	for _, msg := range msgs {
+		if err := msg.Nak(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NakWithDelay negatively acknowledges all the messages so they are redelivered after delay,
+// it returns the first error encountered.
+func (p *Puller) NakWithDelay(delay time.Duration, msgs ...*nats.Msg) error {
+	for _, msg := range msgs {
+		if err := msg.NakWithDelay(delay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unsubscribe removes the subscription, the durable consumer is kept on the server.
+func (p *Puller) Unsubscribe() error {
+	return p.sub.Unsubscribe()
+}